@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/jagottsicher/myGoWebApplication/internal/handlers"
+)
+
+// startCalendarSync starts importing the calendars of other booking portals periodically.
+// The returned channel is closed after stop has been closed and a running sync has been cancelled.
+func startCalendarSync(stop <-chan struct{}) <-chan struct{} {
+	return handlers.Repo.Calendars.Start(stop)
+}
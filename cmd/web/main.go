@@ -1,30 +1,39 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/jagottsicher/myGoWebApplication/internal/config"
 	"github.com/jagottsicher/myGoWebApplication/internal/driver"
 	"github.com/jagottsicher/myGoWebApplication/internal/handlers"
 	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/mailer"
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
 	"github.com/jagottsicher/myGoWebApplication/internal/render"
+	"github.com/jagottsicher/myGoWebApplication/internal/sessionstore"
 )
 
-const portNumber = ":8080"
 const versionNumber = "v1.0.176"
+const mailQueueSize = 100
 
 var app config.AppConfig
 var session *scs.SessionManager
 var infoLog *log.Logger
 var errorLog *log.Logger
+var mailSender mailer.Mailer
+var serverConfig config.ServerConfig
 
 // main is the main function
 func main() {
@@ -33,25 +42,126 @@ func main() {
 		log.Fatal(err)
 	}
 
-	defer db.SQL.Close()
+	fmt.Println("Starting E-Mail worker")
+	mailDone := startMailWorker()
 
-	defer close(app.MailChan)
+	fmt.Println("Starting calendar sync")
+	calendarStop := make(chan struct{})
+	calendarDone := startCalendarSync(calendarStop)
 
-	fmt.Println("Starting E-Mail listener")
-	listenForMail()
+	srv := &http.Server{
+		Addr:              serverConfig.Addr,
+		Handler:           routes(&app),
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
+		ErrorLog:          errorLog,
+	}
+	servers := []*http.Server{srv}
+
+	if serverConfig.TLS() {
+		certs, err := newCertReloader(serverConfig.TLSCert, serverConfig.TLSKey)
+		if err != nil {
+			log.Fatal("can't load tls certificate: ", err)
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	// SIGINT for Ctrl+C, SIGTERM is sent on container restarts
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		if serverConfig.TLS() {
+			fmt.Println(fmt.Sprintf("Starting application with https on %s", serverConfig.Addr))
+			serverErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		fmt.Println(fmt.Sprintf("Starting application on %s", serverConfig.Addr))
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	if serverConfig.RedirectAddr != "" {
+		redirectSrv := &http.Server{
+			Addr:              serverConfig.RedirectAddr,
+			Handler:           redirectToHTTPS(serverConfig.Addr),
+			ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+			ReadTimeout:       serverConfig.ReadTimeout,
+			WriteTimeout:      serverConfig.WriteTimeout,
+			IdleTimeout:       serverConfig.IdleTimeout,
+			ErrorLog:          errorLog,
+		}
+		servers = append(servers, redirectSrv)
+
+		go func() {
+			fmt.Println(fmt.Sprintf("Redirecting http on %s to https", serverConfig.RedirectAddr))
+			serverErr <- redirectSrv.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			errorLog.Println(err)
+		}
+	case <-ctx.Done():
+		infoLog.Println("Shutting down ...")
+	}
 
-	fmt.Println(fmt.Sprintf("Starting application on port %s", portNumber))
+	shutdown(servers, db, mailDone, calendarStop, calendarDone)
 
-	srv := &http.Server{
-		Addr:    portNumber,
-		Handler: routes(&app),
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		os.Exit(1)
+	}
+}
+
+// shutdown stops accepting new requests, waits for running requests to finish,
+// sends all pending e-mails, stops the calendar sync and closes the database connection pool
+func shutdown(servers []*http.Server, db *driver.DB, mailDone <-chan struct{}, calendarStop chan<- struct{}, calendarDone <-chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			errorLog.Println(err)
+		}
+	}
+
+	// no handler is running anymore, so nobody sends to the mail channel
+	close(app.MailChan)
+
+	select {
+	case <-mailDone:
+		infoLog.Println("All pending e-mails sent")
+	case <-ctx.Done():
+		errorLog.Println("Timeout while sending pending e-mails")
+	}
+
+	// a running calendar sync is cancelled, its transaction is rolled back
+	close(calendarStop)
+
+	select {
+	case <-calendarDone:
+	case <-ctx.Done():
+		errorLog.Println("Timeout while stopping the calendar sync")
+	}
+
+	if store, ok := session.Store.(*sessionstore.PostgresStore); ok {
+		store.StopCleanup()
 	}
 
-	err = srv.ListenAndServe()
+	err := db.SQL.Close()
 	if err != nil {
-		log.Fatalln(err)
+		errorLog.Println(err)
 	}
 
+	infoLog.Println("Shutdown complete")
 }
 
 func run() (*driver.DB, error) {
@@ -63,34 +173,34 @@ func run() (*driver.DB, error) {
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
 
-	// read flags as arguments from the command line
-	inProduction := flag.Bool("production", true, "Application is in production mode")
-	useCache := flag.Bool("cache", true, "Use template cache")
-	dbHost := flag.String("dbhost", "localhost", "Database host")
-	dbName := flag.String("dbname", "", "Database name")
-	dbUser := flag.String("dbuser", "", "Database user")
-	dbPass := flag.String("dbpass", "", "Database password")
-	dbPort := flag.String("dbport", "5432", "Database port")
-	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
-	version := flag.Bool("version", false, "Prints the version number")
-
-	flag.Parse()
-
-	if *dbName == "" || *dbUser == "" {
-		fmt.Println("Required flags missing - no user credentials for db access?")
-		os.Exit(1)
+	// read the settings from config file, environment and command line flags
+	settings, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
 
-	if *version == true {
+	if settings.Version {
 		fmt.Println(versionNumber)
 	}
 
-	mailChan := make(chan models.MailData)
+	mailChan := make(chan models.MailData, mailQueueSize)
 	app.MailChan = mailChan
 
-	// don't forget to change to true in Production!
-	app.InProduction = *inProduction
-	app.UseCache = *useCache
+	app.InProduction = settings.InProduction
+	app.UseCache = settings.UseCache
+	app.DBTimeout = settings.Database.Timeout
+	app.ShutdownTimeout = settings.ShutdownTimeout
+	app.BaseURL = strings.TrimSuffix(settings.BaseURL, "/")
+	app.Mail = settings.Mail
+	app.CalendarSync = settings.CalendarSync
+	app.Images = settings.Images
+	serverConfig = settings.Server
+
+	smtpMailer, err := mailer.NewSMTPMailer(app.Mail)
+	if err != nil {
+		return nil, err
+	}
+	mailSender = smtpMailer
 
 	infoLog = log.New(os.Stdout, "[INFO]\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -99,7 +209,7 @@ func run() (*driver.DB, error) {
 	app.ErrorLog = errorLog
 
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Lifetime = settings.Session.Lifetime
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Secure = app.InProduction
@@ -108,13 +218,17 @@ func run() (*driver.DB, error) {
 
 	// connecting to database
 	log.Println("Connecting to database...")
-	connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
-	db, err := driver.ConnectSQL(connectionString)
+	db, err := driver.ConnectSQL(settings.Database.DSN())
 	if err != nil {
 		log.Fatal("No connection to database! Terminating ...")
 	}
 	log.Println("Successfully connected to database.")
 
+	// the memory store of scs is the default
+	if settings.Session.Store == config.SessionStorePostgres {
+		session.Store = sessionstore.NewPostgresStore(db.SQL, settings.Session.CleanupInterval, errorLog)
+	}
+
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
 		log.Fatal("cannot create template cache")
@@ -123,6 +237,14 @@ func run() (*driver.DB, error) {
 
 	app.TemplateCache = tc
 
+	mtc, mttc, err := render.CreateMailTemplateCache()
+	if err != nil {
+		return nil, err
+	}
+
+	app.MailTemplateCache = mtc
+	app.MailTextTemplateCache = mttc
+
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandlers(repo)
 
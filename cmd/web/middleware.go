@@ -1,9 +1,15 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/jagottsicher/myGoWebApplication/internal/handlers"
 	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
 	"github.com/justinas/nosurf"
 )
 
@@ -18,6 +24,18 @@ func NoSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	// requests authenticated by api token don't use the session cookie, so they can't be forged
+	csrfHandler.ExemptFunc(isAPITokenRequest)
+
+	// clients of the json api get a json error
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			helpers.JSONError(w, http.StatusBadRequest, "invalid or missing csrf token")
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}))
+
 	return csrfHandler
 }
 
@@ -29,11 +47,140 @@ func SessionLoad(next http.Handler) http.Handler {
 // Auth redirects non-authenticated requests
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !helpers.IsAuthenticated(r) {
+		ok, err := sessionUserValid(r)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if !ok {
 			session.Put(r.Context(), "error", "Log in first!")
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
+
+		// users have to set up two-factor authentication first if it is required
+		if session.GetBool(r.Context(), "totp_setup_required") && r.URL.Path != "/admin/2fa" {
+			session.Put(r.Context(), "warning", "Please set up two-factor authentication first!")
+			http.Redirect(w, r, "/admin/2fa", http.StatusSeeOther)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
+
+// sessionUserValid reports whether the session belongs to a user who still exists, is active and has
+// a valid role. The role is taken from the database, so changes apply to sessions at once. Sessions of
+// deleted or deactivated users are destroyed.
+func sessionUserValid(r *http.Request) (bool, error) {
+	if !session.Exists(r.Context(), "user_id") {
+		return false, nil
+	}
+
+	user, err := handlers.Repo.DB.GetUserByID(r.Context(), session.GetInt(r.Context(), "user_id"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (!user.Active || !models.ValidRole(user.Role))) {
+		return false, session.Destroy(r.Context())
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if session.GetInt(r.Context(), "user_role") != user.Role {
+		session.Put(r.Context(), "user_role", user.Role)
+	}
+
+	return true, nil
+}
+
+// RequirePermission redirects requests of users without the permission p back to the dashboard
+func RequirePermission(p models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !helpers.Can(r, p) {
+				session.Put(r.Context(), "error", "You are not allowed to do that!")
+				http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isAPITokenRequest reports whether r is a json api request with an api token
+func isAPITokenRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") && helpers.BearerToken(r) != ""
+}
+
+// APITokenAuth authenticates json api requests having an "Authorization: Bearer" header by their api token.
+// Tokens with read scope can only be used for safe methods. Requests without token are passed on unchanged.
+func APITokenAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := helpers.BearerToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t, err := handlers.Repo.DB.APITokenByHash(r.Context(), helpers.HashToken(token))
+		if errors.Is(err, repository.ErrInvalidToken) || (err == nil && (!t.User.Active || !models.ValidRole(t.User.Role))) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			helpers.JSONError(w, http.StatusUnauthorized, "invalid api token")
+			return
+		}
+		if err != nil {
+			helpers.APIServerError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if t.Scope != models.ScopeWrite {
+				helpers.JSONError(w, http.StatusForbidden, "the api token is read-only")
+				return
+			}
+		}
+
+		err = handlers.Repo.DB.TouchAPIToken(r.Context(), t.ID)
+		if err != nil {
+			app.ErrorLog.Println("can't update last use of api token:", err)
+		}
+
+		next.ServeHTTP(w, r.WithContext(helpers.WithAPIToken(r.Context(), t)))
+	})
+}
+
+// APIAuth responds with 401 to json api requests which are neither authenticated by session nor by api token
+func APIAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// requests with api token have been checked by APITokenAuth already
+		if _, byToken := helpers.APIToken(r); byToken {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, err := sessionUserValid(r)
+		if err != nil {
+			helpers.APIServerError(w, err)
+			return
+		}
+		if !ok || session.GetBool(r.Context(), "totp_setup_required") {
+			helpers.JSONError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// APIRequirePermission responds with 403 to json api requests of users without the permission p
+func APIRequirePermission(p models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !helpers.Can(r, p) {
+				helpers.JSONError(w, http.StatusForbidden, "permission denied")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -29,3 +33,247 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("Type mismatch: Expected http.Handler, got %T", v))
 	}
 }
+
+// users of the testing repo with their roles
+const (
+	testOwner       = 1
+	testStaff       = 2
+	testReadOnly    = 3
+	testDeactivated = 4
+	testDeleted     = 99
+)
+
+// withUser stores a logged in user in the session before calling next, 0 for no user
+func withUser(userID int, next http.Handler) http.Handler {
+	return SessionLoad(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userID > 0 {
+			session.Put(r.Context(), "user_id", userID)
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+var permissionTests = []struct {
+	name             string
+	userID           int
+	permission       models.Permission
+	expectedCode     int
+	expectedLocation string
+}{
+	{"not logged in", 0, models.PermEditReservations, http.StatusSeeOther, "/user/login"},
+	{"owner deletes", testOwner, models.PermDeleteReservations, http.StatusOK, ""},
+	{"staff deletes", testStaff, models.PermDeleteReservations, http.StatusSeeOther, "/admin/dashboard"},
+	{"staff blocks days", testStaff, models.PermBlockDays, http.StatusOK, ""},
+	{"read-only edits", testReadOnly, models.PermEditReservations, http.StatusSeeOther, "/admin/dashboard"},
+	{"deactivated user", testDeactivated, models.PermEditReservations, http.StatusSeeOther, "/user/login"},
+	{"deleted user", testDeleted, models.PermEditReservations, http.StatusSeeOther, "/user/login"},
+}
+
+func TestRequirePermission(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, e := range permissionTests {
+		h := withUser(e.userID, Auth(RequirePermission(e.permission)(ok)))
+
+		req := httptest.NewRequest("GET", "/admin/something", nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("failed %s: expected code %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if location := rr.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("failed %s: expected location %q, got %q", e.name, e.expectedLocation, location)
+		}
+	}
+}
+
+var authSessionTests = []struct {
+	name          string
+	userID        int
+	sessionRole   int
+	expectedCode  int
+	expectSession bool
+}{
+	{"active owner", testOwner, models.RoleOwner, http.StatusOK, true},
+	{"demoted to staff", testStaff, models.RoleOwner, http.StatusSeeOther, true},
+	{"deactivated", testDeactivated, models.RoleStaff, http.StatusSeeOther, false},
+	{"deleted", testDeleted, models.RoleOwner, http.StatusSeeOther, false},
+}
+
+func TestAuthSessionUser(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, e := range authSessionTests {
+		var hasSession bool
+
+		// the session is from the login, before the user was changed
+		h := SessionLoad(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session.Put(r.Context(), "user_id", e.userID)
+			session.Put(r.Context(), "user_role", e.sessionRole)
+			Auth(RequirePermission(models.PermDeleteReservations)(ok)).ServeHTTP(w, r)
+			hasSession = session.Exists(r.Context(), "user_id")
+		}))
+
+		req := httptest.NewRequest("GET", "/admin/something", nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("failed %s: expected code %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if hasSession != e.expectSession {
+			t.Errorf("failed %s: expected session of user %v, got %v", e.name, e.expectSession, hasSession)
+		}
+	}
+}
+
+func TestAuthTwoFactorSetup(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	required := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session.Put(r.Context(), "totp_setup_required", true)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	for _, e := range []struct {
+		path             string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"/admin/dashboard", http.StatusSeeOther, "/admin/2fa"},
+		{"/admin/2fa", http.StatusOK, ""},
+	} {
+		h := withUser(testStaff, required(Auth(ok)))
+
+		req := httptest.NewRequest("GET", e.path, nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("failed %s: expected code %d, got %d", e.path, e.expectedCode, rr.Code)
+		}
+		if location := rr.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("failed %s: expected location %q, got %q", e.path, e.expectedLocation, location)
+		}
+	}
+}
+
+var apiPermissionTests = []struct {
+	name         string
+	userID       int
+	permission   models.Permission
+	expectedCode int
+}{
+	{"not logged in", 0, models.PermEditReservations, http.StatusUnauthorized},
+	{"owner deletes", testOwner, models.PermDeleteReservations, http.StatusOK},
+	{"staff deletes", testStaff, models.PermDeleteReservations, http.StatusForbidden},
+	{"read-only edits", testReadOnly, models.PermEditReservations, http.StatusForbidden},
+	{"deactivated user", testDeactivated, models.PermEditReservations, http.StatusUnauthorized},
+}
+
+func TestAPIRequirePermission(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, e := range apiPermissionTests {
+		h := withUser(e.userID, APIAuth(APIRequirePermission(e.permission)(ok)))
+
+		req := httptest.NewRequest("DELETE", "/api/v1/reservations/1", nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("failed %s: expected code %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if e.expectedCode != http.StatusOK && rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("failed %s: expected a json error", e.name)
+		}
+	}
+}
+
+func TestNoSurfAPIFailure(t *testing.T) {
+	var myH myHandler
+	h := NoSurf(&myH)
+
+	req := httptest.NewRequest("POST", "/api/v1/reservations", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected a json error with code %d, got %d %q", http.StatusBadRequest, rr.Code, rr.Header().Get("Content-Type"))
+	}
+}
+
+var apiTokenTests = []struct {
+	name         string
+	method       string
+	token        string
+	userID       int
+	expectedCode int
+}{
+	{"write token", "DELETE", dbrepo.TestAPIToken, 0, http.StatusOK},
+	{"read token reads", "GET", dbrepo.TestReadOnlyAPIToken, 0, http.StatusOK},
+	{"read token writes", "DELETE", dbrepo.TestReadOnlyAPIToken, 0, http.StatusForbidden},
+	{"unknown token", "GET", "bbt_unknown", 0, http.StatusUnauthorized},
+	{"unknown token with session", "GET", "bbt_unknown", testOwner, http.StatusUnauthorized},
+	{"session without token", "DELETE", "", testOwner, http.StatusOK},
+	{"neither token nor session", "GET", "", 0, http.StatusUnauthorized},
+}
+
+func TestAPITokenAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, e := range apiTokenTests {
+		h := withUser(e.userID, APITokenAuth(APIAuth(APIRequirePermission(models.PermDeleteReservations)(ok))))
+
+		req := httptest.NewRequest(e.method, "/api/v1/reservations/1", nil)
+		if e.token != "" {
+			req.Header.Set("Authorization", "Bearer "+e.token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("failed %s: expected code %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func TestNoSurfAPIToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := NoSurf(ok)
+
+	// case #1: api request with token doesn't need a csrf token
+	req := httptest.NewRequest("POST", "/api/v1/reservations", nil)
+	req.Header.Set("Authorization", "Bearer "+dbrepo.TestAPIToken)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected api request with token to pass, got %d", rr.Code)
+	}
+
+	// case #2: other routes still need one
+	req = httptest.NewRequest("POST", "/admin/users/new", nil)
+	req.Header.Set("Authorization", "Bearer "+dbrepo.TestAPIToken)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected admin request with token to fail the csrf check, got %d", rr.Code)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jagottsicher/myGoWebApplication/internal/config"
 	"github.com/jagottsicher/myGoWebApplication/internal/handlers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
 )
 
 func routes(app *config.AppConfig) http.Handler {
@@ -19,9 +20,11 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
 	mux.Get("/contact", handlers.Repo.Contact)
-	mux.Get("/eremite", handlers.Repo.Eremite)
-	mux.Get("/couple", handlers.Repo.Couple)
-	mux.Get("/family", handlers.Repo.Family)
+	mux.Get("/bungalows", handlers.Repo.Bungalows)
+	mux.Get("/bungalows/{slug}", handlers.Repo.Bungalow)
+	mux.Get("/eremite", handlers.Repo.BungalowRedirect)
+	mux.Get("/couple", handlers.Repo.BungalowRedirect)
+	mux.Get("/family", handlers.Repo.BungalowRedirect)
 	mux.Get("/reservation", handlers.Repo.Reservation)
 	mux.Post("/reservation", handlers.Repo.PostReservation)
 	mux.Post("/reservation-json", handlers.Repo.ReservationJSON)
@@ -30,21 +33,106 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/make-reservation", handlers.Repo.MakeReservation)
 	mux.Post("/make-reservation", handlers.Repo.PostMakeReservation)
 	mux.Get("/reservation-overview", handlers.Repo.ReservationOverview)
+	mux.Get("/my-reservation", handlers.Repo.GuestReservation)
+	mux.Post("/my-reservation/change", handlers.Repo.PostGuestChangeReservation)
+	mux.Post("/my-reservation/cancel", handlers.Repo.PostGuestCancelReservation)
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
 	mux.Post("/user/login", handlers.Repo.PostShowLogin)
 	mux.Get("/user/logout", handlers.Repo.Logout)
+	mux.Get("/user/forgot-password", handlers.Repo.ShowForgotPassword)
+	mux.Post("/user/forgot-password", handlers.Repo.PostForgotPassword)
+	mux.Get("/user/reset-password", handlers.Repo.ShowResetPassword)
+	mux.Post("/user/reset-password", handlers.Repo.PostResetPassword)
+	mux.Get("/user/2fa", handlers.Repo.ShowTwoFactor)
+	mux.Post("/user/2fa", handlers.Repo.PostTwoFactor)
+
+	mux.Get("/ical/{bungalowID}.ics", handlers.Repo.ICalFeed)
+	mux.Get("/images/{variant}/{name}", handlers.Repo.Image)
+	mux.Get("/images/{variant}/{format}/{name}", handlers.Repo.Image)
+
+	mux.Get("/api/openapi.json", handlers.Repo.APISpec)
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Use(APITokenAuth)
+		mux.NotFound(handlers.Repo.APINotFound)
+		mux.MethodNotAllowed(handlers.Repo.APIMethodNotAllowed)
+
+		mux.Get("/bungalows", handlers.Repo.APIBungalows)
+		mux.Get("/bungalows/{id}", handlers.Repo.APIBungalow)
+		mux.Get("/availability", handlers.Repo.APIAvailability)
+		mux.Post("/reservations", handlers.Repo.APICreateReservation)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(APIAuth)
+			mux.Get("/reservations", handlers.Repo.APIReservations)
+			mux.Get("/reservations/{id}", handlers.Repo.APIReservation)
+			mux.With(APIRequirePermission(models.PermEditReservations)).Patch("/reservations/{id}", handlers.Repo.APIUpdateReservation)
+			mux.With(APIRequirePermission(models.PermDeleteReservations)).Delete("/reservations/{id}", handlers.Repo.APIDeleteReservation)
+		})
+	})
 
 	mux.Route("/admin", func(mux chi.Router) {
 		mux.Use(Auth)
 		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+		mux.Get("/2fa", handlers.Repo.AdminTwoFactor)
+		mux.Post("/2fa", handlers.Repo.AdminPostTwoFactor)
+		mux.Get("/api-tokens", handlers.Repo.AdminAPITokens)
+		mux.Post("/api-tokens", handlers.Repo.AdminPostAPITokens)
+		mux.Post("/revoke-api-token/{id}", handlers.Repo.AdminRevokeAPIToken)
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
 		mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
-		mux.Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
+		mux.With(RequirePermission(models.PermBlockDays)).Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
 		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
-		mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+		mux.With(RequirePermission(models.PermEditReservations)).Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+		mux.With(RequirePermission(models.PermEditReservations)).Post("/reservations/{src}/{id}/status", handlers.Repo.AdminPostReservationStatus)
+		mux.With(RequirePermission(models.PermDeleteReservations)).Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+		mux.Get("/mails-failed", handlers.Repo.AdminFailedMails)
+		mux.With(RequirePermission(models.PermResendMails)).Post("/resend-mail/{id}", handlers.Repo.AdminResendMail)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(RequirePermission(models.PermManageUsers))
+			mux.Get("/users", handlers.Repo.AdminUsers)
+			mux.Get("/users/new", handlers.Repo.AdminShowUser)
+			mux.Post("/users/new", handlers.Repo.AdminPostShowUser)
+			mux.Get("/users/{id}", handlers.Repo.AdminShowUser)
+			mux.Post("/users/{id}", handlers.Repo.AdminPostShowUser)
+			mux.Post("/delete-user/{id}", handlers.Repo.AdminDeleteUser)
+			mux.Get("/failed-logins", handlers.Repo.AdminFailedLogins)
+			mux.Post("/unlock-account", handlers.Repo.AdminUnlockAccount)
+			mux.Post("/reset-2fa", handlers.Repo.AdminResetTwoFactor)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(RequirePermission(models.PermManageSettings))
+			mux.Get("/settings", handlers.Repo.AdminSettings)
+			mux.Post("/settings", handlers.Repo.AdminPostSettings)
+			mux.Post("/ical-token/{id}", handlers.Repo.AdminNewICalToken)
+			mux.Get("/calendar-imports", handlers.Repo.AdminCalendarImports)
+			mux.Post("/calendar-imports", handlers.Repo.AdminPostCalendarImports)
+			mux.Post("/sync-calendar-import/{id}", handlers.Repo.AdminSyncCalendarImport)
+			mux.Post("/delete-calendar-import/{id}", handlers.Repo.AdminDeleteCalendarImport)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(RequirePermission(models.PermManagePrices))
+			mux.Get("/prices", handlers.Repo.AdminPrices)
+			mux.Post("/prices", handlers.Repo.AdminPostPrices)
+			mux.Post("/seasons", handlers.Repo.AdminPostSeasons)
+			mux.Post("/delete-season/{id}", handlers.Repo.AdminDeleteSeason)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(RequirePermission(models.PermManageBungalows))
+			mux.Get("/bungalows", handlers.Repo.AdminBungalows)
+			mux.Get("/bungalows/new", handlers.Repo.AdminShowBungalow)
+			mux.Post("/bungalows/new", handlers.Repo.AdminPostShowBungalow)
+			mux.Get("/bungalows/{id}", handlers.Repo.AdminShowBungalow)
+			mux.Post("/bungalows/{id}", handlers.Repo.AdminPostShowBungalow)
+			mux.Post("/delete-bungalow/{id}", handlers.Repo.AdminDeleteBungalow)
+			mux.Post("/bungalows/{id}/upload-image", handlers.Repo.AdminPostUploadBungalowImage)
+			mux.Post("/bungalows/{id}/images", handlers.Repo.AdminPostBungalowImages)
+			mux.Post("/delete-bungalow-image/{id}", handlers.Repo.AdminDeleteBungalowImage)
+		})
 	})
 
 	fileServer := http.FileServer(http.Dir("./static/"))
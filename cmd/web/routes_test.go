@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jagottsicher/myGoWebApplication/internal/config"
+	"github.com/jagottsicher/myGoWebApplication/internal/openapi"
 )
 
 func TestRoutes(t *testing.T) {
@@ -20,3 +24,55 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf("Type mismatch: Expected *chi.Mux, got %T", v))
 	}
 }
+
+// isAPIRoute reports whether a route is part of the json api and has to be in the OpenAPI document
+func isAPIRoute(route string) bool {
+	return strings.HasPrefix(route, "/api/") || route == "/reservation-json"
+}
+
+func TestAPIRoutesInSpec(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+
+	err := json.Unmarshal(openapi.Spec(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var app config.AppConfig
+	mux := routes(&app).(chi.Routes)
+
+	registered := make(map[string]bool)
+
+	err = chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if !isAPIRoute(route) {
+			return nil
+		}
+
+		registered[method+" "+route] = true
+		if _, ok := doc.Paths[route][strings.ToLower(method)]; !ok {
+			t.Errorf("route %s %s is missing in the OpenAPI document", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(registered) == 0 {
+		t.Fatal("no api routes found")
+	}
+
+	// and the document doesn't describe routes which don't exist
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("%s %s is in the OpenAPI document, but not a route", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
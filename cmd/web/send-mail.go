@@ -1,43 +1,24 @@
 package main
 
 import (
-	"log"
-	"time"
-
-	"github.com/jagottsicher/myGoWebApplication/internal/models"
-	mail "github.com/xhit/go-simple-mail/v2"
+	"github.com/jagottsicher/myGoWebApplication/internal/handlers"
+	"github.com/jagottsicher/myGoWebApplication/internal/mailer"
 )
 
-func listenForMail() {
-	go func() {
-		for {
-			msg := <-app.MailChan
-			sendMSG(msg)
-		}
-	}()
-}
-
-func sendMSG(m models.MailData) {
-	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 25
-	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
-
-	client, err := server.Connect()
-	if err != nil {
-		errorLog.Println(err)
+// startMailWorker starts delivering the e-mails from the outbox. Messages sent to the
+// mail channel are stored in the outbox first. The returned channel is closed after
+// the mail channel has been closed and the pending e-mails have been delivered.
+func startMailWorker() <-chan struct{} {
+	w := &mailer.Worker{
+		DB:          handlers.Repo.DB,
+		Mailer:      mailSender,
+		Queue:       app.MailChan,
+		Interval:    app.Mail.Interval,
+		MaxAttempts: app.Mail.MaxAttempts,
+		Backoff:     app.Mail.Backoff,
+		InfoLog:     infoLog,
+		ErrorLog:    errorLog,
 	}
 
-	email := mail.NewMSG()
-	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
-	email.SetBody(mail.TextHTML, m.Content)
-
-	err = email.Send(client)
-	if err != nil {
-		log.Println(err)
-	} else {
-		log.Println("E-Mail sent out!")
-	}
+	return w.Start()
 }
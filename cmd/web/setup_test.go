@@ -1,12 +1,26 @@
 package main
 
 import (
+	"log"
 	"net/http"
 	"os"
 	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/jagottsicher/myGoWebApplication/internal/handlers"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
 )
 
 func TestMain(m *testing.M) {
+	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	app.InfoLog = infoLog
+	app.ErrorLog = errorLog
+
+	session = scs.New()
+	app.Session = session
+	helpers.NewHelpers(&app)
+	handlers.NewHandlers(handlers.NewTestRepo(&app))
 
 	os.Exit(m.Run())
 }
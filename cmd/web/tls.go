@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader keeps the tls certificate and reloads it when the files have been changed,
+// e.g. after a renewal, so the server doesn't need a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the certificate and key, returning an error if they can't be used
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+
+	_, err := cr.GetCertificate(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// GetCertificate returns the current certificate and is used as tls.Config.GetCertificate.
+// If the new files can't be loaded the last valid certificate is kept.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	modTime, err := cr.lastModified()
+	if err != nil {
+		if cr.cert != nil {
+			return cr.cert, nil
+		}
+		return nil, err
+	}
+
+	if cr.cert != nil && modTime.Equal(cr.modTime) {
+		return cr.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		if cr.cert != nil {
+			// don't try again before the files change
+			cr.modTime = modTime
+			errorLog.Println("can't reload tls certificate, keeping the old one:", err)
+			return cr.cert, nil
+		}
+		return nil, err
+	}
+
+	if cr.cert != nil {
+		infoLog.Println("Reloaded tls certificate")
+	}
+
+	cr.cert = &cert
+	cr.modTime = modTime
+	return cr.cert, nil
+}
+
+// lastModified returns the later modification time of certificate and key file
+func (cr *certReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+
+	for _, f := range []string{cr.certFile, cr.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// redirectToHTTPS returns a handler sending every request to the same url on the https address
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for commonName to certFile and keyFile
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(t *testing.T, cr *certReloader) string {
+	cert, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	// case #1: missing files
+	_, err := newCertReloader(certFile, keyFile)
+	if err == nil {
+		t.Error("expected an error for missing certificate files")
+	}
+
+	// case #2: initial certificate
+	writeTestCert(t, certFile, keyFile, "first")
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := commonName(t, cr); cn != "first" {
+		t.Errorf("expected certificate first, got %s", cn)
+	}
+
+	// case #3: renewed certificate is picked up
+	writeTestCert(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	if cn := commonName(t, cr); cn != "second" {
+		t.Errorf("expected certificate second, got %s", cn)
+	}
+
+	// case #4: broken files keep the last valid certificate
+	os.WriteFile(certFile, []byte("garbage"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if cn := commonName(t, cr); cn != "second" {
+		t.Errorf("expected certificate second to be kept, got %s", cn)
+	}
+}
+
+var redirectTests = []struct {
+	name      string
+	httpsAddr string
+	url       string
+	expected  string
+}{
+	{"default port", ":443", "http://bungalow-bliss.com/about?x=1", "https://bungalow-bliss.com/about?x=1"},
+	{"other port", ":8443", "http://bungalow-bliss.com:8080/reservation", "https://bungalow-bliss.com:8443/reservation"},
+	{"host in address", "127.0.0.1:443", "http://localhost/", "https://localhost/"},
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, e := range redirectTests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		redirectToHTTPS(e.httpsAddr).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusMovedPermanently {
+			t.Errorf("failed %s: expected code %d, got %d", e.name, http.StatusMovedPermanently, rr.Code)
+		}
+		if location := rr.Header().Get("Location"); location != e.expected {
+			t.Errorf("failed %s: expected location %s, got %s", e.name, e.expected, location)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package calsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/config"
+	"github.com/jagottsicher/myGoWebApplication/internal/ical"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// MaxCalendarSize is the largest calendar which is imported
+const MaxCalendarSize = 5 << 20
+
+// Fetcher is the interface for everything able to load a calendar by its url
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (io.ReadCloser, error)
+}
+
+// HTTPFetcher downloads calendars
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// Fetch downloads the calendar, only a response with status 200 is accepted
+func (f *HTTPFetcher) Fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// FileFetcher reads calendars from a local directory instead of downloading them, the file
+// is named like the last element of the url path. Useful for tests and development without network.
+type FileFetcher struct {
+	Dir string
+}
+
+// Fetch opens the file of the calendar
+func (f *FileFetcher) Fetch(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return nil, fmt.Errorf("no file name in url %s", rawURL)
+	}
+
+	return os.Open(filepath.Join(f.Dir, name))
+}
+
+// Syncer imports the calendars of other booking portals as external restrictions of the bungalows
+type Syncer struct {
+	DB       repository.DatabaseRepo
+	Fetcher  Fetcher
+	Interval time.Duration
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// NewSyncer returns a syncer downloading the calendars, or reading them from files if a directory is configured
+func NewSyncer(db repository.DatabaseRepo, cfg config.CalendarSyncConfig, infoLog, errorLog *log.Logger) *Syncer {
+	var f Fetcher = &HTTPFetcher{Client: &http.Client{Timeout: cfg.Timeout}}
+	if cfg.Dir != "" {
+		f = &FileFetcher{Dir: cfg.Dir}
+	}
+
+	return &Syncer{
+		DB:       db,
+		Fetcher:  f,
+		Interval: cfg.Interval,
+		InfoLog:  infoLog,
+		ErrorLog: errorLog,
+	}
+}
+
+// Start syncs all calendar imports right away and then after every interval in its own goroutine.
+// After stop has been closed a running sync is cancelled and the returned channel is closed.
+func (s *Syncer) Start(stop <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for {
+			s.SyncAll(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+// SyncAll syncs every calendar import, a failing import doesn't stop the others
+func (s *Syncer) SyncAll(ctx context.Context) {
+	imports, err := s.DB.AllCalendarImports(ctx)
+	if err != nil {
+		s.ErrorLog.Println("can't read calendar imports:", err)
+		return
+	}
+
+	for _, c := range imports {
+		if ctx.Err() != nil {
+			return
+		}
+
+		result, err := s.Sync(ctx, c)
+		if err != nil {
+			s.ErrorLog.Printf("calendar import %d (%s) failed: %s", c.ID, c.Name, err)
+			continue
+		}
+
+		if result.Added+result.Updated+result.Removed > 0 {
+			s.InfoLog.Printf("calendar import %d (%s): %d added, %d updated, %d removed",
+				c.ID, c.Name, result.Added, result.Updated, result.Removed)
+		}
+		if result.Conflicts > 0 {
+			s.ErrorLog.Printf("calendar import %d (%s) overlaps %d reservations", c.ID, c.Name, result.Conflicts)
+		}
+	}
+}
+
+// Sync imports the events of a calendar and records the outcome on the import. If the calendar
+// can't be loaded or parsed the restrictions are kept as they are.
+func (s *Syncer) Sync(ctx context.Context, c models.CalendarImport) (models.CalendarSyncResult, error) {
+	result, err := s.sync(ctx, c)
+
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+
+	serr := s.DB.UpdateCalendarImportStatus(ctx, c.ID, time.Now(), lastError)
+	if serr != nil {
+		s.ErrorLog.Println("can't update calendar import:", serr)
+	}
+
+	return result, err
+}
+
+func (s *Syncer) sync(ctx context.Context, c models.CalendarImport) (models.CalendarSyncResult, error) {
+	var r io.Reader = strings.NewReader(c.Content)
+
+	if c.URL != "" {
+		body, err := s.Fetcher.Fetch(ctx, c.URL)
+		if err != nil {
+			return models.CalendarSyncResult{}, err
+		}
+		defer body.Close()
+		r = io.LimitReader(body, MaxCalendarSize)
+	}
+
+	events, err := ical.Decode(r)
+	if errors.Is(err, ical.ErrNoCalendar) && c.URL != "" {
+		return models.CalendarSyncResult{}, fmt.Errorf("%s doesn't return a calendar", c.URL)
+	}
+	if err != nil {
+		return models.CalendarSyncResult{}, err
+	}
+
+	return s.DB.SyncCalendarImport(ctx, c.ID, restrictions(events))
+}
+
+// restrictions turns events into external restrictions identified by the uid of the event.
+// Events without uid are identified by their dates, of events with the same uid only the first is kept.
+func restrictions(events []ical.Event) []models.BungalowRestriction {
+	var rs []models.BungalowRestriction
+	seen := make(map[string]bool)
+
+	for _, e := range events {
+		uid := e.UID
+		if uid == "" {
+			uid = e.Start.Format("20060102") + "-" + e.End.Format("20060102")
+		}
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+
+		rs = append(rs, models.BungalowRestriction{
+			StartDate:     e.Start,
+			EndDate:       e.End,
+			RestrictionID: models.RestrictionExternal,
+			ExternalUID:   uid,
+		})
+	}
+
+	return rs
+}
@@ -0,0 +1,118 @@
+package calsync
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/config"
+	"github.com/jagottsicher/myGoWebApplication/internal/ical"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
+)
+
+func newTestSyncer() *Syncer {
+	return &Syncer{
+		DB:       dbrepo.NewTestingRepo(&config.AppConfig{}),
+		Fetcher:  &FileFetcher{Dir: "testdata"},
+		Interval: time.Hour,
+		InfoLog:  log.New(io.Discard, "", 0),
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+}
+
+var syncTests = []struct {
+	name          string
+	calendar      models.CalendarImport
+	expectedAdded int
+	expectError   bool
+}{
+	{"downloaded", models.CalendarImport{ID: 1, URL: "https://jellyfish-fields.ocean/calendars/eremite.ics"}, 2, false},
+	{"uploaded", models.CalendarImport{ID: 2, Content: "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"}, 0, false},
+	{"missing-file", models.CalendarImport{ID: 1, URL: "https://jellyfish-fields.ocean/calendars/missing.ics"}, 0, true},
+	{"no-calendar", models.CalendarImport{ID: 2, Content: "<html></html>"}, 0, true},
+	{"unknown-import", models.CalendarImport{ID: 99, Content: "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"}, 0, true},
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	s := newTestSyncer()
+
+	for _, e := range syncTests {
+		result, err := s.Sync(context.Background(), e.calendar)
+		if e.expectError && err == nil {
+			t.Errorf("failed %s: expected an error", e.name)
+		}
+		if !e.expectError && err != nil {
+			t.Errorf("failed %s: unexpected error %s", e.name, err)
+		}
+		if result.Added != e.expectedAdded {
+			t.Errorf("failed %s: expected %d added restrictions, got %d", e.name, e.expectedAdded, result.Added)
+		}
+	}
+}
+
+func TestSyncer_Start(t *testing.T) {
+	s := newTestSyncer()
+
+	stop := make(chan struct{})
+	done := s.Start(stop)
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("syncer didn't stop")
+	}
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eremite.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", ical.ContentType)
+		io.WriteString(w, "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")
+	}))
+	defer srv.Close()
+
+	f := &HTTPFetcher{Client: srv.Client()}
+
+	// case #1: calendar found
+	body, err := f.Fetch(context.Background(), srv.URL+"/eremite.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	// case #2: calendar missing
+	_, err = f.Fetch(context.Background(), srv.URL+"/missing.ics")
+	if err == nil {
+		t.Error("expected an error for a missing calendar")
+	}
+}
+
+func TestRestrictions(t *testing.T) {
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 3)
+
+	rs := restrictions([]ical.Event{
+		{UID: "booking-1", Start: start, End: end},
+		{UID: "booking-1", Start: end, End: end.AddDate(0, 0, 1)},
+		{Start: start, End: end},
+	})
+
+	if len(rs) != 2 {
+		t.Fatalf("expected 2 restrictions, got %d", len(rs))
+	}
+	if !rs[0].StartDate.Equal(start) || rs[0].RestrictionID != models.RestrictionExternal {
+		t.Errorf("unexpected first restriction %+v", rs[0])
+	}
+	if rs[1].ExternalUID != "20300101-20300104" {
+		t.Errorf("expected uid from the dates, got %s", rs[1].ExternalUID)
+	}
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"html/template"
 	"log"
+	texttemplate "text/template"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
@@ -10,11 +12,49 @@ import (
 
 // AppConfig is a struct holding die application's configuration
 type AppConfig struct {
-	TemplateCache map[string]*template.Template
-	UseCache      bool
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	InProduction  bool
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	TemplateCache         map[string]*template.Template
+	MailTemplateCache     map[string]*template.Template
+	MailTextTemplateCache map[string]*texttemplate.Template
+	UseCache              bool
+	InfoLog               *log.Logger
+	ErrorLog              *log.Logger
+	InProduction          bool
+	Session               *scs.SessionManager
+	MailChan              chan models.MailData
+	DBTimeout             time.Duration
+	ShutdownTimeout       time.Duration
+	BaseURL               string
+	Mail                  MailConfig
+	CalendarSync          CalendarSyncConfig
+	Images                ImagesConfig
+}
+
+// MailConfig holds the settings of the smtp server outgoing e-mails are sent through
+type MailConfig struct {
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port"`
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	Encryption string `yaml:"encryption"`
+	From       string `yaml:"from"`
+
+	// delivery of e-mails from the outbox
+	Interval    time.Duration `yaml:"interval"`
+	MaxAttempts int           `yaml:"max_attempts"`
+	Backoff     time.Duration `yaml:"backoff"`
+}
+
+// CalendarSyncConfig holds the settings for importing the calendars of other booking portals.
+// If Dir is set the calendars are read from files in this directory instead of being downloaded.
+type CalendarSyncConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Dir      string        `yaml:"dir"`
+}
+
+// ImagesConfig holds the settings for the uploaded photos of the bungalows. The originals are kept in Dir,
+// the resized variants in sub directories of it.
+type ImagesConfig struct {
+	Dir     string `yaml:"dir"`
+	MaxSize int    `yaml:"max_size"`
 }
@@ -0,0 +1,383 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings holds everything which can be configured when starting the application
+type Settings struct {
+	ConfigFile      string             `yaml:"-"`
+	Version         bool               `yaml:"-"`
+	InProduction    bool               `yaml:"production"`
+	UseCache        bool               `yaml:"cache"`
+	ShutdownTimeout time.Duration      `yaml:"shutdown_timeout"`
+	BaseURL         string             `yaml:"base_url"`
+	Server          ServerConfig       `yaml:"server"`
+	Session         SessionConfig      `yaml:"session"`
+	Database        DatabaseConfig     `yaml:"database"`
+	Mail            MailConfig         `yaml:"mail"`
+	CalendarSync    CalendarSyncConfig `yaml:"calendar_sync"`
+	Images          ImagesConfig       `yaml:"images"`
+}
+
+// ServerConfig holds the settings for the http server. TLS is used when a certificate and key are set.
+type ServerConfig struct {
+	Addr              string        `yaml:"addr"`
+	TLSCert           string        `yaml:"tls_cert"`
+	TLSKey            string        `yaml:"tls_key"`
+	RedirectAddr      string        `yaml:"redirect_addr"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+}
+
+// TLS reports whether the server is configured to serve https
+func (c ServerConfig) TLS() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
+}
+
+// session stores which can be configured
+const (
+	SessionStorePostgres = "postgres"
+	SessionStoreMemory   = "memory"
+)
+
+// SessionConfig holds the settings for storing the sessions
+type SessionConfig struct {
+	Store           string        `yaml:"store"`
+	Lifetime        time.Duration `yaml:"lifetime"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+}
+
+// DatabaseConfig holds the settings for the database connection,
+// using the same keys as database.yml of the migrations
+type DatabaseConfig struct {
+	URL      string        `yaml:"url"`
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port"`
+	Database string        `yaml:"database"`
+	User     string        `yaml:"user"`
+	Password string        `yaml:"password"`
+	SSLMode  string        `yaml:"sslmode"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// DSN returns the connection string for the database. A configured url is used as is.
+func (d DatabaseConfig) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+
+	return fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s",
+		quoteDSN(d.Host), d.Port, quoteDSN(d.Database), quoteDSN(d.User), quoteDSN(d.Password), quoteDSN(d.SSLMode))
+}
+
+// quoteDSN quotes a value for a key/value connection string, so it may contain spaces and quotes
+func quoteDSN(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+// Load builds the settings from defaults, a yaml config file, environment variables and
+// command line flags, each one overriding the ones before. The config file is given by
+// -config or APP_CONFIG. The flags are registered on fs and parsed from args.
+func Load(fs *flag.FlagSet, args []string) (*Settings, error) {
+	var s Settings
+
+	// registering the flags sets all defaults
+	bindFlags(fs, &s)
+
+	s.ConfigFile = configFile(args)
+	if s.ConfigFile != "" {
+		err := loadFile(s.ConfigFile, &s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := loadEnv(&s)
+	if err != nil {
+		return nil, err
+	}
+
+	// only flags given on the command line override the values set so far
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// bindFlags registers a command line flag for every setting
+func bindFlags(fs *flag.FlagSet, s *Settings) {
+	fs.StringVar(&s.ConfigFile, "config", "", "Path to a yaml config file (or APP_CONFIG)")
+	fs.BoolVar(&s.Version, "version", false, "Prints the version number")
+	fs.BoolVar(&s.InProduction, "production", true, "Application is in production mode")
+	fs.BoolVar(&s.UseCache, "cache", true, "Use template cache")
+	fs.DurationVar(&s.ShutdownTimeout, "shutdowntimeout", 30*time.Second, "Time to finish running requests and pending e-mails on shutdown")
+
+	fs.StringVar(&s.BaseURL, "baseurl", "http://localhost:8080", "Public url of the application, used for links in e-mails")
+
+	fs.StringVar(&s.Server.Addr, "addr", ":8080", "Address the server listens on")
+	fs.StringVar(&s.Server.TLSCert, "tlscert", "", "TLS certificate file, enables https together with -tlskey")
+	fs.StringVar(&s.Server.TLSKey, "tlskey", "", "TLS private key file")
+	fs.StringVar(&s.Server.RedirectAddr, "redirectaddr", "", "Address of a plain http listener redirecting to https, e.g. :80")
+	fs.DurationVar(&s.Server.ReadHeaderTimeout, "readheadertimeout", 5*time.Second, "Time to read the request headers")
+	fs.DurationVar(&s.Server.ReadTimeout, "readtimeout", 15*time.Second, "Time to read the whole request")
+	fs.DurationVar(&s.Server.WriteTimeout, "writetimeout", 30*time.Second, "Time to write the response")
+	fs.DurationVar(&s.Server.IdleTimeout, "idletimeout", 2*time.Minute, "Time to keep idle connections open")
+
+	fs.StringVar(&s.Session.Store, "sessionstore", SessionStorePostgres, "Where sessions are stored (postgres, memory)")
+	fs.DurationVar(&s.Session.Lifetime, "sessionlifetime", 24*time.Hour, "Lifetime of a session")
+	fs.DurationVar(&s.Session.CleanupInterval, "sessioncleanup", 5*time.Minute, "Interval to delete expired sessions from the database")
+
+	fs.StringVar(&s.Database.URL, "dburl", "", "Database url, replaces all other database settings (or DATABASE_URL)")
+	fs.StringVar(&s.Database.Host, "dbhost", "localhost", "Database host")
+	fs.IntVar(&s.Database.Port, "dbport", 5432, "Database port")
+	fs.StringVar(&s.Database.Database, "dbname", "", "Database name")
+	fs.StringVar(&s.Database.User, "dbuser", "", "Database user")
+	fs.StringVar(&s.Database.Password, "dbpass", "", "Database password (better use DB_PASSWORD)")
+	fs.StringVar(&s.Database.SSLMode, "dbssl", "disable", "Database ssl settings (disable, prefer, require)")
+	fs.DurationVar(&s.Database.Timeout, "dbtimeout", 3*time.Second, "Timeout for a single database query")
+
+	fs.StringVar(&s.Mail.Host, "smtphost", "localhost", "SMTP server host")
+	fs.IntVar(&s.Mail.Port, "smtpport", 25, "SMTP server port")
+	fs.StringVar(&s.Mail.Username, "smtpuser", "", "SMTP user name, empty for no authentication")
+	fs.StringVar(&s.Mail.Password, "smtppass", "", "SMTP password (better use SMTP_PASSWORD)")
+	fs.StringVar(&s.Mail.Encryption, "smtpencryption", "none", "SMTP encryption (none, starttls, ssl)")
+	fs.StringVar(&s.Mail.From, "mailfrom", "noreply@bungalow-bliss.com", "Default sender address of outgoing e-mails")
+	fs.DurationVar(&s.Mail.Interval, "mailinterval", 10*time.Second, "Interval to check the outbox for e-mails to (re)send")
+	fs.IntVar(&s.Mail.MaxAttempts, "mailmaxattempts", 8, "Delivery attempts before an e-mail is marked as failed")
+	fs.DurationVar(&s.Mail.Backoff, "mailbackoff", time.Minute, "Wait time after the first failed delivery, doubled for each further attempt")
+
+	fs.DurationVar(&s.CalendarSync.Interval, "calinterval", 15*time.Minute, "Interval to import the calendars of other booking portals")
+	fs.DurationVar(&s.CalendarSync.Timeout, "caltimeout", 30*time.Second, "Timeout for downloading a calendar")
+	fs.StringVar(&s.CalendarSync.Dir, "caldir", "", "Read imported calendars from files in this directory instead of downloading them")
+
+	fs.StringVar(&s.Images.Dir, "imagedir", "./static/images", "Directory of the uploaded photos of the bungalows")
+	fs.IntVar(&s.Images.MaxSize, "imagemaxsize", 10<<20, "Largest photo upload in bytes")
+}
+
+// configFile returns the config file given by the -config flag or the APP_CONFIG environment variable
+func configFile(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return os.Getenv("APP_CONFIG")
+}
+
+// loadFile reads the settings from a yaml file, keys missing in the file keep their values
+func loadFile(path string, s *Settings) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read config file: %w", err)
+	}
+
+	err = yaml.Unmarshal(content, s)
+	if err != nil {
+		return fmt.Errorf("can't parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadEnv reads the settings from environment variables, variables not set keep the values
+func loadEnv(s *Settings) error {
+	var errs []error
+
+	envBool(&s.InProduction, "APP_PRODUCTION", &errs)
+	envBool(&s.UseCache, "APP_CACHE", &errs)
+	envDuration(&s.ShutdownTimeout, "APP_SHUTDOWN_TIMEOUT", &errs)
+
+	envString(&s.BaseURL, "APP_BASE_URL")
+
+	envString(&s.Server.Addr, "APP_ADDR")
+	envString(&s.Server.TLSCert, "TLS_CERT_FILE")
+	envString(&s.Server.TLSKey, "TLS_KEY_FILE")
+	envString(&s.Server.RedirectAddr, "APP_REDIRECT_ADDR")
+	envDuration(&s.Server.ReadHeaderTimeout, "APP_READ_HEADER_TIMEOUT", &errs)
+	envDuration(&s.Server.ReadTimeout, "APP_READ_TIMEOUT", &errs)
+	envDuration(&s.Server.WriteTimeout, "APP_WRITE_TIMEOUT", &errs)
+	envDuration(&s.Server.IdleTimeout, "APP_IDLE_TIMEOUT", &errs)
+
+	envString(&s.Session.Store, "SESSION_STORE")
+	envDuration(&s.Session.Lifetime, "SESSION_LIFETIME", &errs)
+	envDuration(&s.Session.CleanupInterval, "SESSION_CLEANUP_INTERVAL", &errs)
+
+	envString(&s.Database.URL, "DATABASE_URL")
+	envString(&s.Database.Host, "DB_HOST")
+	envInt(&s.Database.Port, "DB_PORT", &errs)
+	envString(&s.Database.Database, "DB_NAME")
+	envString(&s.Database.User, "DB_USER")
+	envString(&s.Database.Password, "DB_PASSWORD")
+	envString(&s.Database.SSLMode, "DB_SSLMODE")
+	envDuration(&s.Database.Timeout, "DB_TIMEOUT", &errs)
+
+	envString(&s.Mail.Host, "SMTP_HOST")
+	envInt(&s.Mail.Port, "SMTP_PORT", &errs)
+	envString(&s.Mail.Username, "SMTP_USER")
+	envString(&s.Mail.Password, "SMTP_PASSWORD")
+	envString(&s.Mail.Encryption, "SMTP_ENCRYPTION")
+	envString(&s.Mail.From, "MAIL_FROM")
+	envDuration(&s.Mail.Interval, "MAIL_INTERVAL", &errs)
+	envInt(&s.Mail.MaxAttempts, "MAIL_MAX_ATTEMPTS", &errs)
+	envDuration(&s.Mail.Backoff, "MAIL_BACKOFF", &errs)
+
+	envDuration(&s.CalendarSync.Interval, "CALENDAR_SYNC_INTERVAL", &errs)
+	envDuration(&s.CalendarSync.Timeout, "CALENDAR_SYNC_TIMEOUT", &errs)
+	envString(&s.CalendarSync.Dir, "CALENDAR_SYNC_DIR")
+
+	envString(&s.Images.Dir, "IMAGE_DIR")
+	envInt(&s.Images.MaxSize, "IMAGE_MAX_SIZE", &errs)
+
+	return errors.Join(errs...)
+}
+
+func envString(p *string, key string) {
+	if value, ok := os.LookupEnv(key); ok {
+		*p = value
+	}
+}
+
+func envBool(p *bool, key string, errs *[]error) {
+	if value, ok := os.LookupEnv(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("%s must be true or false, got %q", key, value))
+			return
+		}
+		*p = b
+	}
+}
+
+func envInt(p *int, key string, errs *[]error) {
+	if value, ok := os.LookupEnv(key); ok {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("%s must be a number, got %q", key, value))
+			return
+		}
+		*p = i
+	}
+}
+
+func envDuration(p *time.Duration, key string, errs *[]error) {
+	if value, ok := os.LookupEnv(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("%s must be a duration like 3s or 1m, got %q", key, value))
+			return
+		}
+		*p = d
+	}
+}
+
+// Validate checks the settings and returns an error naming every invalid value
+func (s *Settings) Validate() error {
+	var errs []error
+
+	if u, err := url.Parse(s.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("base url %q must be an absolute http or https url", s.BaseURL))
+	}
+
+	if s.Server.Addr == "" {
+		errs = append(errs, errors.New("server address is required (-addr, APP_ADDR or server.addr)"))
+	}
+	if (s.Server.TLSCert == "") != (s.Server.TLSKey == "") {
+		errs = append(errs, errors.New("tls needs both a certificate and a key file"))
+	}
+	if s.Server.RedirectAddr != "" && !s.Server.TLS() {
+		errs = append(errs, errors.New("redirect to https needs a tls certificate and key file"))
+	}
+	if s.Server.ReadHeaderTimeout < 0 || s.Server.ReadTimeout < 0 || s.Server.WriteTimeout < 0 || s.Server.IdleTimeout < 0 {
+		errs = append(errs, errors.New("server timeouts must not be negative"))
+	}
+
+	switch s.Session.Store {
+	case SessionStorePostgres, SessionStoreMemory:
+	default:
+		errs = append(errs, fmt.Errorf("session store %q is invalid (postgres, memory)", s.Session.Store))
+	}
+	if s.Session.Lifetime <= 0 {
+		errs = append(errs, errors.New("session lifetime must be greater than zero"))
+	}
+
+	if s.Database.URL == "" {
+		if s.Database.Database == "" {
+			errs = append(errs, errors.New("database name is required (-dbname, DB_NAME or database.database)"))
+		}
+		if s.Database.User == "" {
+			errs = append(errs, errors.New("database user is required (-dbuser, DB_USER or database.user)"))
+		}
+		if s.Database.Port < 1 || s.Database.Port > 65535 {
+			errs = append(errs, fmt.Errorf("database port %d is invalid", s.Database.Port))
+		}
+		switch s.Database.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			errs = append(errs, fmt.Errorf("database ssl mode %q is invalid", s.Database.SSLMode))
+		}
+	}
+
+	if s.Database.Timeout <= 0 {
+		errs = append(errs, errors.New("database timeout must be greater than zero"))
+	}
+
+	if s.Mail.Port < 1 || s.Mail.Port > 65535 {
+		errs = append(errs, fmt.Errorf("smtp port %d is invalid", s.Mail.Port))
+	}
+
+	switch s.Mail.Encryption {
+	case "none", "starttls", "ssl":
+	default:
+		errs = append(errs, fmt.Errorf("smtp encryption %q is invalid (none, starttls, ssl)", s.Mail.Encryption))
+	}
+
+	if s.Mail.Interval <= 0 {
+		errs = append(errs, errors.New("mail interval must be greater than zero"))
+	}
+
+	if s.Mail.MaxAttempts < 1 {
+		errs = append(errs, errors.New("mail max attempts must be at least 1"))
+	}
+
+	if s.CalendarSync.Interval <= 0 || s.CalendarSync.Timeout <= 0 {
+		errs = append(errs, errors.New("calendar sync interval and timeout must be greater than zero"))
+	}
+
+	if s.Images.Dir == "" {
+		errs = append(errs, errors.New("image directory is required (-imagedir, IMAGE_DIR or images.dir)"))
+	}
+	if s.Images.MaxSize <= 0 {
+		errs = append(errs, errors.New("image max size must be greater than zero"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigFile = `
+production: false
+database:
+  host: db.bikini-bottom.ocean
+  database: krustykrab
+  user: spongebob
+  timeout: 5s
+mail:
+  host: smtp.bikini-bottom.ocean
+  port: 587
+  encryption: starttls
+`
+
+// newFlagSet returns an empty flag set which doesn't print to the test output
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfigFile(t, testConfigFile)
+
+	// case #1: defaults and config file
+	s, err := Load(newFlagSet(), []string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.InProduction {
+		t.Error("expected production to be false from config file")
+	}
+	if !s.UseCache {
+		t.Error("expected cache to keep its default true")
+	}
+	if s.Database.Host != "db.bikini-bottom.ocean" || s.Database.Port != 5432 {
+		t.Errorf("unexpected database host/port %s:%d", s.Database.Host, s.Database.Port)
+	}
+	if s.Database.Timeout != 5*time.Second {
+		t.Errorf("expected database timeout 5s, got %s", s.Database.Timeout)
+	}
+	if s.Mail.Port != 587 || s.Mail.Encryption != "starttls" {
+		t.Errorf("unexpected mail port/encryption %d/%s", s.Mail.Port, s.Mail.Encryption)
+	}
+
+	// case #2: environment variables override the config file
+	t.Setenv("DB_HOST", "env.bikini-bottom.ocean")
+	t.Setenv("SMTP_PORT", "2525")
+
+	s, err = Load(newFlagSet(), []string{"-config=" + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Database.Host != "env.bikini-bottom.ocean" {
+		t.Errorf("expected database host from environment, got %s", s.Database.Host)
+	}
+	if s.Mail.Port != 2525 {
+		t.Errorf("expected smtp port from environment, got %d", s.Mail.Port)
+	}
+
+	// case #3: flags override environment variables and config file
+	s, err = Load(newFlagSet(), []string{"-config", path, "-dbhost", "flag.bikini-bottom.ocean", "-smtpport", "25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Database.Host != "flag.bikini-bottom.ocean" {
+		t.Errorf("expected database host from flag, got %s", s.Database.Host)
+	}
+	if s.Mail.Port != 25 {
+		t.Errorf("expected smtp port from flag, got %d", s.Mail.Port)
+	}
+
+	// case #4: config file from APP_CONFIG
+	t.Setenv("APP_CONFIG", path)
+	s, err = Load(newFlagSet(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Database.Database != "krustykrab" {
+		t.Errorf("expected database name from APP_CONFIG file, got %s", s.Database.Database)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	// case #1: missing config file
+	_, err := Load(newFlagSet(), []string{"-config", filepath.Join(t.TempDir(), "missing.yml")})
+	if err == nil {
+		t.Error("expected an error for a missing config file")
+	}
+
+	// case #2: broken config file
+	_, err = Load(newFlagSet(), []string{"-config", writeConfigFile(t, "database: [")})
+	if err == nil {
+		t.Error("expected an error for an invalid config file")
+	}
+
+	// case #3: invalid environment variable
+	t.Setenv("DB_PORT", "five")
+	_, err = Load(newFlagSet(), []string{"-dbname", "krustykrab", "-dbuser", "spongebob"})
+	if err == nil || !strings.Contains(err.Error(), "DB_PORT") {
+		t.Errorf("expected an error naming DB_PORT, got %v", err)
+	}
+	os.Unsetenv("DB_PORT")
+
+	// case #4: every invalid setting is reported
+	_, err = Load(newFlagSet(), []string{"-dbssl", "maybe", "-smtpencryption", "carrier-pigeon", "-sessionstore", "jellyfish-net", "-imagedir", ""})
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	for _, want := range []string{"database name", "database user", "ssl mode", "smtp encryption", "session store", "image directory"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %s", want, err)
+		}
+	}
+}
+
+func TestDSN(t *testing.T) {
+	d := DatabaseConfig{Host: "localhost", Port: 5432, Database: "krustykrab", User: "spongebob", Password: "secret formula's", SSLMode: "disable"}
+
+	want := `host='localhost' port=5432 dbname='krustykrab' user='spongebob' password='secret formula\'s' sslmode='disable'`
+	if d.DSN() != want {
+		t.Errorf("expected %s, got %s", want, d.DSN())
+	}
+
+	d.URL = "postgres://spongebob@localhost/krustykrab"
+	if d.DSN() != d.URL {
+		t.Errorf("expected url %s, got %s", d.URL, d.DSN())
+	}
+}
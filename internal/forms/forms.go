@@ -3,6 +3,7 @@ package forms
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
@@ -62,3 +63,29 @@ func (f *Form) IsEmail(field string) {
 		f.Errors.Add(field, "Please enter a valid email address.")
 	}
 }
+
+// IntRange returns false if the field value isn't a whole number from min to max, otherwise true
+func (f *Form) IntRange(field string, min, max int) bool {
+	n, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil || n < min || n > max {
+		f.Errors.Add(field, fmt.Sprintf("Please enter a number from %d to %d.", min, max))
+		return false
+	}
+	return true
+}
+
+// MaxGuests returns false if the numbers in the guest fields add up to more than capacity, otherwise true.
+// The error is added to the first field, fields which aren't numbers are left to IntRange.
+func (f *Form) MaxGuests(capacity int, fields ...string) bool {
+	guests := 0
+	for _, field := range fields {
+		n, _ := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+		guests += n
+	}
+
+	if guests > capacity {
+		f.Errors.Add(fields[0], fmt.Sprintf("Sorry, there is room for %d guests at most.", capacity))
+		return false
+	}
+	return true
+}
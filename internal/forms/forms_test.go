@@ -129,3 +129,35 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 }
+
+func TestForm_IntRange(t *testing.T) {
+	for value, valid := range map[string]bool{
+		"1":   true,
+		"4":   true,
+		" 2 ": true,
+		"0":   false,
+		"5":   false,
+		"two": false,
+		"":    false,
+	} {
+		form := New(url.Values{"adults": {value}})
+		if form.IntRange("adults", 1, 4) != valid || form.Valid() != valid {
+			t.Errorf("expected valid to be %t for %q", valid, value)
+		}
+	}
+}
+
+func TestForm_MaxGuests(t *testing.T) {
+	form := New(url.Values{"adults": {"2"}, "children": {"3"}})
+
+	if !form.MaxGuests(5, "adults", "children") {
+		t.Error("got invalid for a party which fits")
+	}
+
+	if form.MaxGuests(4, "adults", "children") {
+		t.Error("got valid for a party which is too large")
+	}
+	if form.Errors.Get("adults") == "" {
+		t.Error("expected the error on the first field")
+	}
+}
@@ -0,0 +1,570 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/openapi"
+	"github.com/jagottsicher/myGoWebApplication/internal/pricing"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// apiDateLayout is the format of dates in the json api
+const apiDateLayout = "2006-01-02"
+
+// maxAPIBodySize is the maximum size of a request body of the json api
+const maxAPIBodySize = 1 << 20
+
+// apiBungalow is a bungalow in the json api
+type apiBungalow struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	MaxGuests int    `json:"max_guests"`
+	Beds      string `json:"beds"`
+}
+
+// apiAvailability is the response of an availability query
+type apiAvailability struct {
+	StartDate string        `json:"start_date"`
+	EndDate   string        `json:"end_date"`
+	Bungalows []apiBungalow `json:"bungalows"`
+}
+
+// apiReservation is a reservation in the json api
+type apiReservation struct {
+	ID           int                      `json:"id"`
+	BungalowID   int                      `json:"bungalow_id"`
+	BungalowName string                   `json:"bungalow_name,omitempty"`
+	FullName     string                   `json:"full_name"`
+	Email        string                   `json:"email"`
+	Phone        string                   `json:"phone"`
+	StartDate    string                   `json:"start_date"`
+	EndDate      string                   `json:"end_date"`
+	TotalPrice   int                      `json:"total_price"`
+	Adults       int                      `json:"adults"`
+	Children     int                      `json:"children"`
+	Status       models.ReservationStatus `json:"status"`
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+}
+
+// apiReservationInput is the request body for creating a reservation
+type apiReservationInput struct {
+	BungalowID int    `json:"bungalow_id"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+	FullName   string `json:"full_name"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	Adults     int    `json:"adults"`
+	Children   int    `json:"children"`
+}
+
+// apiReservationUpdate is the request body for updating a reservation, missing fields are left unchanged.
+// StatusReason is recorded in the status history if the status changes.
+type apiReservationUpdate struct {
+	FullName     *string                   `json:"full_name"`
+	Email        *string                   `json:"email"`
+	Phone        *string                   `json:"phone"`
+	Status       *models.ReservationStatus `json:"status"`
+	StatusReason string                    `json:"status_reason"`
+}
+
+func newAPIBungalow(b models.Bungalow) apiBungalow {
+	return apiBungalow{ID: b.ID, Name: b.BungalowName, MaxGuests: b.MaxGuests, Beds: b.Beds}
+}
+
+func newAPIReservation(res models.Reservation) apiReservation {
+	return apiReservation{
+		ID:           res.ID,
+		BungalowID:   res.BungalowID,
+		BungalowName: res.Bungalow.BungalowName,
+		FullName:     res.FullName,
+		Email:        res.Email,
+		Phone:        res.Phone,
+		StartDate:    res.StartDate.Format(apiDateLayout),
+		EndDate:      res.EndDate.Format(apiDateLayout),
+		TotalPrice:   res.TotalPrice,
+		Adults:       res.Adults,
+		Children:     res.Children,
+		Status:       res.Status,
+		CreatedAt:    res.CreatedAt,
+		UpdatedAt:    res.UpdatedAt,
+	}
+}
+
+// readJSON decodes the json request body into dst and writes an error response if that fails
+func readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		helpers.JSONError(w, http.StatusUnsupportedMediaType, "content type must be application/json")
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body must contain a single json object")
+	}
+	if err != nil {
+		helpers.JSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err))
+		return false
+	}
+
+	return true
+}
+
+// validationError writes the errors of form as response
+func validationError(w http.ResponseWriter, form *forms.Form) {
+	helpers.WriteJSON(w, http.StatusUnprocessableEntity, helpers.APIError{
+		Error:  "validation failed",
+		Fields: form.Errors,
+	})
+}
+
+// parseDateRange parses start and end date and checks that start isn't in the past, end is after
+// start and the range isn't longer than the maximum stay
+func parseDateRange(start, end string) (time.Time, time.Time, error) {
+	startDate, err := time.Parse(apiDateLayout, start)
+	if err != nil {
+		return startDate, time.Time{}, errors.New("start date must be given as YYYY-MM-DD")
+	}
+
+	endDate, err := time.Parse(apiDateLayout, end)
+	if err != nil {
+		return startDate, endDate, errors.New("end date must be given as YYYY-MM-DD")
+	}
+
+	if startDate.Before(today()) {
+		return startDate, endDate, errors.New("start date can't be in the past")
+	}
+
+	if !endDate.After(startDate) {
+		return startDate, endDate, errors.New("end date must be after start date")
+	}
+
+	if endDate.After(startDate.AddDate(0, 0, pricing.MaxNights)) {
+		return startDate, endDate, fmt.Errorf("a stay can't be longer than %d nights", pricing.MaxNights)
+	}
+
+	return startDate, endDate, nil
+}
+
+// urlParamID returns the id from the url and writes an error response if it isn't a number
+func urlParamID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		helpers.JSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// APISpec serves the OpenAPI document of the json api
+func (m *Repository) APISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapi.Spec())
+}
+
+// APINotFound is the response for unknown routes of the json api
+func (m *Repository) APINotFound(w http.ResponseWriter, r *http.Request) {
+	helpers.JSONError(w, http.StatusNotFound, "not found")
+}
+
+// APIMethodNotAllowed is the response for unsupported methods of the json api
+func (m *Repository) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	helpers.JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// APIBungalows lists all bungalows
+func (m *Repository) APIBungalows(w http.ResponseWriter, r *http.Request) {
+	bungalows, err := m.DB.AllBungalows(r.Context())
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	out := make([]apiBungalow, 0, len(bungalows))
+	for _, b := range bungalows {
+		out = append(out, newAPIBungalow(b))
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, out)
+}
+
+// APIBungalow shows a bungalow
+func (m *Repository) APIBungalow(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlParamID(w, r)
+	if !ok {
+		return
+	}
+
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.JSONError(w, http.StatusNotFound, "bungalow not found")
+		return
+	}
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, newAPIBungalow(bungalow))
+}
+
+// APIAvailability lists the bungalows available from start to end date with room for the adults and
+// children, optionally only the one with bungalow_id
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	startDate, endDate, err := parseDateRange(q.Get("start"), q.Get("end"))
+	if err != nil {
+		helpers.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// one adult and no children unless asked otherwise
+	if q.Get("adults") == "" {
+		q.Set("adults", "1")
+	}
+	if q.Get("children") == "" {
+		q.Set("children", "0")
+	}
+
+	form := forms.New(q)
+	if !form.IntRange("adults", 1, maxPartySize) || !form.IntRange("children", 0, maxPartySize) {
+		helpers.JSONError(w, http.StatusBadRequest, fmt.Sprintf("adults must be from 1 to %d, children from 0 to %d", maxPartySize, maxPartySize))
+		return
+	}
+	guests := guestCount(form, "adults") + guestCount(form, "children")
+
+	out := apiAvailability{
+		StartDate: startDate.Format(apiDateLayout),
+		EndDate:   endDate.Format(apiDateLayout),
+		Bungalows: []apiBungalow{},
+	}
+
+	if q.Get("bungalow_id") == "" {
+		bungalows, err := m.DB.SearchAvailabilityByDatesForAllBungalows(r.Context(), startDate, endDate, guests)
+		if err != nil {
+			helpers.APIServerError(w, err)
+			return
+		}
+
+		for _, b := range bungalows {
+			out.Bungalows = append(out.Bungalows, newAPIBungalow(b))
+		}
+
+		helpers.WriteJSON(w, http.StatusOK, out)
+		return
+	}
+
+	bungalowID, err := strconv.Atoi(q.Get("bungalow_id"))
+	if err != nil {
+		helpers.JSONError(w, http.StatusBadRequest, "invalid bungalow_id")
+		return
+	}
+
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), bungalowID)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.JSONError(w, http.StatusNotFound, "bungalow not found")
+		return
+	}
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByBungalowID(r.Context(), startDate, endDate, bungalowID)
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	if available && bungalow.MaxGuests >= guests {
+		out.Bungalows = append(out.Bungalows, newAPIBungalow(bungalow))
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, out)
+}
+
+// APICreateReservation books a bungalow and sends the same e-mails as the reservation form
+func (m *Repository) APICreateReservation(w http.ResponseWriter, r *http.Request) {
+	// one adult unless given
+	in := apiReservationInput{Adults: 1}
+	if !readJSON(w, r, &in) {
+		return
+	}
+
+	// the input is validated like the reservation form
+	form := forms.New(url.Values{
+		"full_name": {in.FullName},
+		"email":     {in.Email},
+		"phone":     {in.Phone},
+		"adults":    {strconv.Itoa(in.Adults)},
+		"children":  {strconv.Itoa(in.Children)},
+	})
+	form.Required("full_name", "email")
+	form.MinLength("full_name", 2)
+	form.IsEmail("email")
+
+	startDate, endDate, err := parseDateRange(in.StartDate, in.EndDate)
+	if err != nil {
+		form.Errors.Add("end_date", err.Error())
+	}
+
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), in.BungalowID)
+	if errors.Is(err, sql.ErrNoRows) {
+		form.Errors.Add("bungalow_id", "Please choose an existing bungalow.")
+	} else if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	} else if form.IntRange("adults", 1, bungalow.MaxGuests) && form.IntRange("children", 0, bungalow.MaxGuests) {
+		form.MaxGuests(bungalow.MaxGuests, "adults", "children")
+	}
+
+	if !form.Valid() {
+		validationError(w, form)
+		return
+	}
+
+	quote, err := m.Prices.Quote(r.Context(), bungalow.ID, startDate, endDate)
+	var minStay *pricing.MinimumStayError
+	if errors.As(err, &minStay) {
+		form.Errors.Add("end_date", fmt.Sprintf("The minimum stay in this bungalow is %d nights for these dates.", minStay.MinNights))
+		validationError(w, form)
+		return
+	}
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	reservation := models.Reservation{
+		FullName:   in.FullName,
+		Email:      in.Email,
+		Phone:      in.Phone,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		BungalowID: bungalow.ID,
+		Bungalow:   bungalow,
+		TotalPrice: quote.Total,
+		Adults:     in.Adults,
+		Children:   in.Children,
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByBungalowID(r.Context(), startDate, endDate, bungalow.ID)
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+	if !available {
+		helpers.JSONError(w, http.StatusConflict, repository.ErrNotAvailable.Error())
+		return
+	}
+
+	token, hash, err := helpers.NewToken()
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+	reservation.AccessTokenHash = hash
+
+	mails, err := m.reservationMails(reservation, m.guestLink(token))
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	reservation.ID, err = m.DB.BookReservation(r.Context(), reservation, mails)
+	if errors.Is(err, repository.ErrNotAvailable) {
+		helpers.JSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%d", reservation.ID))
+	helpers.WriteJSON(w, http.StatusCreated, newAPIReservation(reservation))
+}
+
+// APIReservations lists all reservations, only the new ones with ?new=true or those with a status given by ?status=
+func (m *Repository) APIReservations(w http.ResponseWriter, r *http.Request) {
+	var reservations []models.Reservation
+	var err error
+
+	status := models.ReservationStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.Valid() {
+		helpers.JSONError(w, http.StatusBadRequest, fmt.Sprintf("unknown status %q", status))
+		return
+	}
+
+	if r.URL.Query().Get("new") == "true" {
+		reservations, err = m.DB.AllNewReservations(r.Context())
+	} else {
+		reservations, err = m.DB.AllReservations(r.Context(), status)
+	}
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	out := make([]apiReservation, 0, len(reservations))
+	for _, res := range reservations {
+		out = append(out, newAPIReservation(res))
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, out)
+}
+
+// APIReservation shows a reservation
+func (m *Repository) APIReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiGetReservation(w, r)
+	if !ok {
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, newAPIReservation(res))
+}
+
+// APIUpdateReservation changes contact data and status of a reservation
+func (m *Repository) APIUpdateReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiGetReservation(w, r)
+	if !ok {
+		return
+	}
+
+	var in apiReservationUpdate
+	if !readJSON(w, r, &in) {
+		return
+	}
+
+	if in.FullName != nil {
+		res.FullName = *in.FullName
+	}
+	if in.Email != nil {
+		res.Email = *in.Email
+	}
+	if in.Phone != nil {
+		res.Phone = *in.Phone
+	}
+
+	form := forms.New(url.Values{
+		"full_name": {res.FullName},
+		"email":     {res.Email},
+	})
+	form.Required("full_name", "email")
+	form.IsEmail("email")
+
+	changeStatus := in.Status != nil && *in.Status != res.Status
+	if changeStatus && !res.Status.CanBecome(*in.Status) {
+		form.Errors.Add("status", fmt.Sprintf("A reservation which is %s can't become %s.", res.Status, *in.Status))
+	}
+	if utf8.RuneCountInString(in.StatusReason) > maxReasonLength {
+		form.Errors.Add("status_reason", fmt.Sprintf("The reason can't be longer than %d characters.", maxReasonLength))
+	}
+
+	if !form.Valid() {
+		validationError(w, form)
+		return
+	}
+
+	if !changeStatus {
+		err := m.DB.UpdateReservation(r.Context(), res)
+		if err != nil {
+			helpers.APIServerError(w, err)
+			return
+		}
+
+		helpers.WriteJSON(w, http.StatusOK, newAPIReservation(res))
+		return
+	}
+
+	mails, err := m.statusMails(res, *in.Status)
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	// the contact details are only saved together with the status change
+	err = m.DB.UpdateReservationAndStatus(r.Context(), res, models.ReservationStatusChange{
+		ReservationID: res.ID,
+		ToStatus:      *in.Status,
+		UserID:        m.apiUserID(r),
+		Reason:        in.StatusReason,
+	}, mails)
+	if errors.Is(err, repository.ErrInvalidStatusChange) {
+		helpers.JSONError(w, http.StatusConflict, "the status of the reservation has just been changed")
+		return
+	}
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+	res.Status = *in.Status
+
+	helpers.WriteJSON(w, http.StatusOK, newAPIReservation(res))
+}
+
+// APIDeleteReservation deletes a reservation
+func (m *Repository) APIDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiGetReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.DB.DeleteReservation(r.Context(), res.ID)
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiUserID returns the id of the user of an api request, from the api token or, for requests
+// of a logged in user, from the session
+func (m *Repository) apiUserID(r *http.Request) int {
+	if token, ok := helpers.APIToken(r); ok {
+		return token.UserID
+	}
+	return m.App.Session.GetInt(r.Context(), "user_id")
+}
+
+// apiGetReservation returns the reservation with the id from the url and writes an error response if there is none
+func (m *Repository) apiGetReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, ok := urlParamID(w, r)
+	if !ok {
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.JSONError(w, http.StatusNotFound, "reservation not found")
+		return res, false
+	}
+	if err != nil {
+		helpers.APIServerError(w, err)
+		return res, false
+	}
+
+	return res, true
+}
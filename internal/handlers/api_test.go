@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+)
+
+// apiTests is the data for the json api tests, they run against the routes of getRoutes
+var apiTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	expectedStatusCode int
+	expectedJSON       string
+}{
+	{"openapi", "GET", "/api/openapi.json", "", http.StatusOK, `"openapi": "3.0.3"`},
+	{"bungalows", "GET", "/api/v1/bungalows", "", http.StatusOK, `"id": 1`},
+	{"bungalow", "GET", "/api/v1/bungalows/1", "", http.StatusOK, `"id": 1`},
+	{"bungalow-not-found", "GET", "/api/v1/bungalows/4", "", http.StatusNotFound, `"error": "bungalow not found"`},
+	{"bungalow-invalid-id", "GET", "/api/v1/bungalows/x", "", http.StatusBadRequest, `"error": "invalid id"`},
+	{"availability", "GET", "/api/v1/availability?start=2030-01-01&end=2030-01-05", "", http.StatusOK, `"bungalows": [`},
+	{"availability-none", "GET", "/api/v1/availability?start=2037-01-01&end=2037-01-05", "", http.StatusOK, `"bungalows": []`},
+	{"availability-bungalow", "GET", "/api/v1/availability?start=2030-01-01&end=2030-01-05&bungalow_id=1", "", http.StatusOK, `"id": 1`},
+	{"availability-unknown-bungalow", "GET", "/api/v1/availability?start=2030-01-01&end=2030-01-05&bungalow_id=4", "", http.StatusNotFound, ""},
+	{"availability-invalid-date", "GET", "/api/v1/availability?start=tomorrow&end=2030-01-05", "", http.StatusBadRequest, "YYYY-MM-DD"},
+	{"availability-end-before-start", "GET", "/api/v1/availability?start=2030-01-05&end=2030-01-01", "", http.StatusBadRequest, "after start date"},
+	{"availability-in-the-past", "GET", "/api/v1/availability?start=2020-01-01&end=2020-01-05", "", http.StatusBadRequest, "in the past"},
+	{"availability-too-long", "GET", "/api/v1/availability?start=2030-01-01&end=9999-12-31", "", http.StatusBadRequest, "longer than"},
+	{"availability-guests", "GET", "/api/v1/availability?start=2030-01-01&end=2030-01-05&adults=2&children=1", "", http.StatusOK, `"bungalows": [`},
+	{"availability-too-many-guests", "GET", "/api/v1/availability?start=2030-01-01&end=2030-01-05&adults=4&children=2", "", http.StatusOK, `"bungalows": []`},
+	{"availability-bungalow-too-small", "GET", "/api/v1/availability?start=2030-01-01&end=2030-01-05&bungalow_id=1&adults=3", "", http.StatusOK, `"bungalows": []`},
+	{"availability-invalid-adults", "GET", "/api/v1/availability?start=2030-01-01&end=2030-01-05&adults=0", "", http.StatusBadRequest, "adults"},
+	{"availability-db-error", "GET", "/api/v1/availability?start=2038-01-01&end=2038-01-05", "", http.StatusInternalServerError, ""},
+	{"create-reservation", "POST", "/api/v1/reservations",
+		`{"bungalow_id": 1, "start_date": "2030-01-01", "end_date": "2030-01-05", "full_name": "Sandy Cheeks", "email": "sandy@bikini-bottom.ocean"}`,
+		http.StatusCreated, `"full_name": "Sandy Cheeks"`},
+	{"create-reservation-guests", "POST", "/api/v1/reservations",
+		`{"bungalow_id": 3, "start_date": "2030-01-01", "end_date": "2030-01-05", "full_name": "Sandy Cheeks", "email": "sandy@bikini-bottom.ocean", "adults": 2, "children": 3}`,
+		http.StatusCreated, `"children": 3`},
+	{"create-reservation-too-many-guests", "POST", "/api/v1/reservations",
+		`{"bungalow_id": 1, "start_date": "2030-01-01", "end_date": "2030-01-05", "full_name": "Sandy Cheeks", "email": "sandy@bikini-bottom.ocean", "adults": 2, "children": 1}`,
+		http.StatusUnprocessableEntity, `"adults": [`},
+	{"create-reservation-invalid", "POST", "/api/v1/reservations",
+		`{"bungalow_id": 4, "start_date": "2030-01-05", "end_date": "2030-01-01", "full_name": "S", "email": "sandy"}`,
+		http.StatusUnprocessableEntity, `"bungalow_id": [`},
+	{"create-reservation-in-the-past", "POST", "/api/v1/reservations",
+		`{"bungalow_id": 1, "start_date": "2020-01-01", "end_date": "2020-01-05", "full_name": "Sandy Cheeks", "email": "sandy@bikini-bottom.ocean"}`,
+		http.StatusUnprocessableEntity, "in the past"},
+	{"create-reservation-too-long", "POST", "/api/v1/reservations",
+		`{"bungalow_id": 1, "start_date": "2030-01-01", "end_date": "2031-01-01", "full_name": "Sandy Cheeks", "email": "sandy@bikini-bottom.ocean"}`,
+		http.StatusUnprocessableEntity, `"end_date": [`},
+	{"create-reservation-not-available", "POST", "/api/v1/reservations",
+		`{"bungalow_id": 1, "start_date": "2037-01-01", "end_date": "2037-01-05", "full_name": "Sandy Cheeks", "email": "sandy@bikini-bottom.ocean"}`,
+		http.StatusConflict, ""},
+	{"create-reservation-unknown-field", "POST", "/api/v1/reservations", `{"bungalow": 1}`, http.StatusBadRequest, "unknown field"},
+	{"create-reservation-broken-json", "POST", "/api/v1/reservations", `{"bungalow_id": `, http.StatusBadRequest, ""},
+	{"reservations", "GET", "/api/v1/reservations", "", http.StatusOK, "[]"},
+	{"new-reservations", "GET", "/api/v1/reservations?new=true", "", http.StatusOK, "[]"},
+	{"reservation", "GET", "/api/v1/reservations/1", "", http.StatusOK, `"id": 1`},
+	{"reservation-not-found", "GET", "/api/v1/reservations/99", "", http.StatusNotFound, ""},
+	{"reservations-by-status", "GET", "/api/v1/reservations?status=confirmed", "", http.StatusOK, "[]"},
+	{"reservations-unknown-status", "GET", "/api/v1/reservations?status=paid", "", http.StatusBadRequest, "unknown status"},
+	{"update-reservation", "PATCH", "/api/v1/reservations/1", `{"full_name": "Sandy Cheeks", "email": "sandy@bikini-bottom.ocean", "status": "confirmed", "status_reason": "Deposit paid"}`, http.StatusOK, `"status": "confirmed"`},
+	{"update-reservation-same-status", "PATCH", "/api/v1/reservations/3", `{"full_name": "Sandy Cheeks", "email": "sandy@bikini-bottom.ocean", "status": "checked-out"}`, http.StatusOK, `"status": "checked-out"`},
+	{"update-reservation-invalid", "PATCH", "/api/v1/reservations/1", `{"full_name": "Sandy Cheeks", "email": "sandy", "status": "paid"}`, http.StatusUnprocessableEntity, `"status": [`},
+	{"update-reservation-invalid-transition", "PATCH", "/api/v1/reservations/3", `{"status": "confirmed"}`, http.StatusUnprocessableEntity, `"status": [`},
+	{"update-reservation-not-found", "PATCH", "/api/v1/reservations/99", `{}`, http.StatusNotFound, ""},
+	{"delete-reservation", "DELETE", "/api/v1/reservations/1", "", http.StatusNoContent, ""},
+	{"delete-reservation-not-found", "DELETE", "/api/v1/reservations/99", "", http.StatusNotFound, ""},
+	{"unknown-route", "GET", "/api/v1/guests", "", http.StatusNotFound, `"error": "not found"`},
+	{"method-not-allowed", "PUT", "/api/v1/bungalows", "", http.StatusMethodNotAllowed, ""},
+}
+
+func TestAPI(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range apiTests {
+		req := httptest.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		if e.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d: %s", e.name, e.expectedStatusCode, rr.Code, rr.Body.String())
+		}
+
+		if rr.Code != http.StatusNoContent {
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("failed %s: expected json, got content type %q", e.name, ct)
+			}
+			if !json.Valid(rr.Body.Bytes()) {
+				t.Errorf("failed %s: invalid json %s", e.name, rr.Body.String())
+			}
+		}
+
+		if e.expectedJSON != "" && !strings.Contains(rr.Body.String(), e.expectedJSON) {
+			t.Errorf("failed %s: expected to find %s in %s", e.name, e.expectedJSON, rr.Body.String())
+		}
+	}
+}
+
+func TestAPICreateReservationContentType(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/v1/reservations", strings.NewReader("bungalow_id=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected code %d, but got %d", http.StatusUnsupportedMediaType, rr.Code)
+	}
+}
+
+func TestAPIUserID(t *testing.T) {
+	// a logged in user without api token
+	req := httptest.NewRequest("PATCH", "/api/v1/reservations/1", nil)
+	ctx := getCtx(req)
+	session.Put(ctx, "user_id", 3)
+	req = req.WithContext(ctx)
+
+	if id := Repo.apiUserID(req); id != 3 {
+		t.Errorf("expected user 3 from the session, but got %d", id)
+	}
+
+	// the token wins over the session
+	req = req.WithContext(helpers.WithAPIToken(ctx, models.APIToken{UserID: 1}))
+
+	if id := Repo.apiUserID(req); id != 1 {
+		t.Errorf("expected user 1 from the api token, but got %d", id)
+	}
+}
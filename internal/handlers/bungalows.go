@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// slugPattern is the format of the slugs in bungalow urls, e.g. family-fiesta
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Bungalows lists all holiday homes
+func (m *Repository) Bungalows(w http.ResponseWriter, r *http.Request) {
+	bungalows, err := m.DB.AllBungalows(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	images, err := m.DB.AllBungalowImages(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for i, b := range bungalows {
+		for _, img := range images {
+			if img.BungalowID == b.ID {
+				bungalows[i].Images = append(bungalows[i].Images, img)
+			}
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["bungalows"] = bungalows
+
+	render.Template(w, r, "bungalows-page.tpml", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// Bungalow shows the page of a holiday home given by its slug
+func (m *Repository) Bungalow(w http.ResponseWriter, r *http.Request) {
+	bungalow, err := m.DB.GetBungalowBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	bungalow.Images, err = m.DB.BungalowImages(r.Context(), bungalow.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["bungalow"] = bungalow
+
+	render.Template(w, r, "bungalow-page.tpml", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// BungalowRedirect sends the old pages of the bungalows, e.g. /eremite, to their catalogue page
+func (m *Repository) BungalowRedirect(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/bungalows"+r.URL.Path, http.StatusMovedPermanently)
+}
+
+// AdminBungalows lists all bungalows in the admin area
+func (m *Repository) AdminBungalows(w http.ResponseWriter, r *http.Request) {
+	bungalows, err := m.DB.AllBungalows(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["bungalows"] = bungalows
+
+	render.Template(w, r, "admin-bungalows-page.tpml", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowBungalow shows the form to edit a bungalow, or an empty one for a new bungalow
+func (m *Repository) AdminShowBungalow(w http.ResponseWriter, r *http.Request) {
+	bungalow := models.Bungalow{MinNights: 1, MaxGuests: 2}
+
+	if chi.URLParam(r, "id") != "" {
+		var ok bool
+		bungalow, ok = m.adminBungalow(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	m.renderBungalowForm(w, r, bungalow, forms.New(nil))
+}
+
+// AdminPostShowBungalow creates a new bungalow or updates an existing one. Amenities are
+// entered one per line, a missing slug is made from the name.
+func (m *Repository) AdminPostShowBungalow(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var bungalow models.Bungalow
+	isNew := chi.URLParam(r, "id") == ""
+
+	if !isNew {
+		var ok bool
+		bungalow, ok = m.adminBungalow(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("bungalow_name")
+
+	if !form.Has("slug") {
+		form.Set("slug", slugify(form.Get("bungalow_name")))
+	}
+	if !slugPattern.MatchString(form.Get("slug")) {
+		form.Errors.Add("slug", "Please use only lowercase letters, digits and dashes.")
+	}
+
+	bungalow.BungalowName = strings.TrimSpace(form.Get("bungalow_name"))
+	bungalow.Slug = form.Get("slug")
+	bungalow.Description = strings.TrimSpace(strings.ReplaceAll(form.Get("description"), "\r\n", "\n"))
+	bungalow.Amenities = lines(form.Get("amenities"))
+	bungalow.Beds = strings.TrimSpace(form.Get("beds"))
+	bungalow.MaxGuests = nightsField(form, "max_guests", 1)
+	bungalow.NightlyRate = priceField(form, "nightly_rate")
+	bungalow.WeekendSurcharge = priceField(form, "weekend_surcharge")
+	bungalow.CleaningFee = priceField(form, "cleaning_fee")
+	bungalow.MinNights = nightsField(form, "min_nights", 1)
+
+	if !form.Valid() {
+		m.renderBungalowForm(w, r, bungalow, form)
+		return
+	}
+
+	if isNew {
+		bungalow.ID, err = m.DB.InsertBungalow(r.Context(), bungalow)
+	} else {
+		err = m.DB.UpdateBungalow(r.Context(), bungalow)
+	}
+	if errors.Is(err, repository.ErrDuplicateSlug) {
+		form.Errors.Add("slug", "This slug is already used by another bungalow.")
+		m.renderBungalowForm(w, r, bungalow, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", fmt.Sprintf("%s saved", bungalow.BungalowName))
+	http.Redirect(w, r, "/admin/bungalows", http.StatusSeeOther)
+}
+
+// AdminDeleteBungalow deletes a bungalow without reservations together with its images
+func (m *Repository) AdminDeleteBungalow(w http.ResponseWriter, r *http.Request) {
+	bungalow, ok := m.adminBungalow(w, r)
+	if !ok {
+		return
+	}
+
+	images, err := m.DB.BungalowImages(r.Context(), bungalow.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteBungalow(r.Context(), bungalow.ID)
+	if errors.Is(err, repository.ErrBungalowInUse) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s has reservations and can't be deleted", bungalow.BungalowName))
+		http.Redirect(w, r, "/admin/bungalows", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.deleteImageFiles(images...)
+
+	m.App.Session.Put(r.Context(), "success", fmt.Sprintf("%s deleted", bungalow.BungalowName))
+	http.Redirect(w, r, "/admin/bungalows", http.StatusSeeOther)
+}
+
+// adminBungalow returns the bungalow given by the id url parameter, or writes an error response
+func (m *Repository) adminBungalow(w http.ResponseWriter, r *http.Request) (models.Bungalow, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.Bungalow{}, false
+	}
+
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return bungalow, false
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return bungalow, false
+	}
+
+	return bungalow, true
+}
+
+// renderBungalowForm renders the bungalow form. Values not posted with the form are filled in from b.
+func (m *Repository) renderBungalowForm(w http.ResponseWriter, r *http.Request, b models.Bungalow, form *forms.Form) {
+	if form.Values == nil {
+		form.Values = url.Values{}
+	}
+
+	for field, value := range map[string]string{
+		"bungalow_name":     b.BungalowName,
+		"slug":              b.Slug,
+		"description":       b.Description,
+		"amenities":         strings.Join(b.Amenities, "\n"),
+		"beds":              b.Beds,
+		"max_guests":        strconv.Itoa(b.MaxGuests),
+		"nightly_rate":      plainPrice(b.NightlyRate),
+		"weekend_surcharge": plainPrice(b.WeekendSurcharge),
+		"cleaning_fee":      plainPrice(b.CleaningFee),
+		"min_nights":        strconv.Itoa(b.MinNights),
+	} {
+		if _, ok := form.Values[field]; !ok {
+			form.Set(field, value)
+		}
+	}
+
+	if b.ID != 0 {
+		var err error
+		b.Images, err = m.DB.BungalowImages(r.Context(), b.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["bungalow"] = b
+	data["max_image_size"] = m.App.Images.MaxSize >> 20
+
+	render.Template(w, r, "admin-bungalow-page.tpml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// slugify makes a slug from a name, e.g. family-fiesta from Family Fiesta!
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, c := range strings.ToLower(name) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
+// lines returns the non-empty lines of a textarea
+func lines(s string) []string {
+	var l []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			l = append(l, line)
+		}
+	}
+	return l
+}
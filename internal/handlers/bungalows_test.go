@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAdminPostShowBungalow(t *testing.T) {
+	valid := func(changes url.Values) url.Values {
+		v := url.Values{
+			"bungalow_name":     {"The Treehouse"},
+			"slug":              {"treehouse"},
+			"description":       {"High up.\r\n\r\nAnd quiet."},
+			"amenities":         {"Wifi\r\n\r\nHammock"},
+			"beds":              {"1 double bed"},
+			"max_guests":        {"2"},
+			"nightly_rate":      {"90"},
+			"weekend_surcharge": {"10"},
+			"cleaning_fee":      {"30"},
+			"min_nights":        {"2"},
+		}
+		for k, val := range changes {
+			v[k] = val
+		}
+		return v
+	}
+
+	for _, e := range []struct {
+		name               string
+		id                 string
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"new", "", valid(nil), http.StatusSeeOther},
+		{"new-slug-from-name", "", valid(url.Values{"slug": {""}}), http.StatusSeeOther},
+		{"new-duplicate-slug", "", valid(url.Values{"slug": {"eremite"}}), http.StatusOK},
+		{"new-invalid-slug", "", valid(url.Values{"slug": {"Tree House"}}), http.StatusOK},
+		{"new-missing-name", "", valid(url.Values{"bungalow_name": {""}, "slug": {"treehouse"}}), http.StatusOK},
+		{"new-no-guests", "", valid(url.Values{"max_guests": {"0"}}), http.StatusOK},
+		{"new-invalid-price", "", valid(url.Values{"nightly_rate": {"cheap"}}), http.StatusOK},
+		{"edit", "2", valid(url.Values{"slug": {"couple"}}), http.StatusSeeOther},
+		{"edit-duplicate-slug", "3", valid(url.Values{"slug": {"couple"}}), http.StatusOK},
+		{"edit-not-found", "99", valid(nil), http.StatusNotFound},
+		{"edit-invalid-id", "x", valid(nil), http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/bungalows/"+e.id, strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		if e.id != "" {
+			rctx.URLParams.Add("id", e.id)
+		}
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostShowBungalow).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestAdminDeleteBungalow(t *testing.T) {
+	for _, e := range []struct {
+		id                 string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"2", http.StatusSeeOther, "success"},
+		{"1", http.StatusSeeOther, "error"},
+		{"99", http.StatusNotFound, ""},
+		{"x", http.StatusBadRequest, ""},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/delete-bungalow/"+e.id, nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminDeleteBungalow).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.id, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedFlash != "" && session.PopString(ctx, e.expectedFlash) == "" {
+			t.Errorf("failed %s: expected a %s message", e.id, e.expectedFlash)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	for name, slug := range map[string]string{
+		"The Family Fiesta Bungalow": "the-family-fiesta-bungalow",
+		"  Couple's Cove! ":          "couple-s-cove",
+		"Nr. 4":                      "nr-4",
+		"???":                        "",
+	} {
+		if got := slugify(name); got != slug {
+			t.Errorf("slugify(%q): expected %q, but got %q", name, slug, got)
+		}
+	}
+}
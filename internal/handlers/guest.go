@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/pricing"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// defaultCancellationDays is the number of days before arrival until which guests can change
+// or cancel a reservation themselves, if no other number has been set
+const defaultCancellationDays = 14
+
+// GuestReservation shows a reservation to the guest who opened the link from the confirmation e-mail
+func (m *Repository) GuestReservation(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	res, ok := m.guestReservation(w, r, token)
+	if !ok {
+		return
+	}
+
+	form := forms.New(url.Values{})
+	form.Set("start_date", res.StartDate.Format("2006-01-02"))
+	form.Set("end_date", res.EndDate.Format("2006-01-02"))
+
+	m.renderGuestReservation(w, r, res, token, form)
+}
+
+// PostGuestCancelReservation cancels a reservation for the guest and tells the owner about it. Like
+// any status change it is recorded in the history of the reservation.
+func (m *Repository) PostGuestCancelReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token := r.Form.Get("token")
+
+	res, ok := m.guestReservation(w, r, token)
+	if !ok {
+		return
+	}
+
+	back := "/my-reservation?token=" + url.QueryEscape(token)
+
+	deadline, err := m.changeDeadline(r, res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if res.Status == models.ReservationCancelled {
+		m.App.Session.Put(r.Context(), "warning", "This reservation has already been cancelled.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if time.Now().After(deadline) || !res.Status.CanBecome(models.ReservationCancelled) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this reservation can't be cancelled online anymore. Please contact us.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	mailData := make(map[string]interface{})
+	mailData["reservation"] = res
+
+	mails, err := m.guestChangeMails(res, "reservation-cancelled", "Your reservation has been cancelled", "Reservation Cancelled", mailData)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.ChangeReservationStatus(r.Context(), models.ReservationStatusChange{
+		ReservationID: res.ID,
+		ToStatus:      models.ReservationCancelled,
+		Reason:        "Cancelled by the guest",
+	}, mails)
+	if errors.Is(err, repository.ErrInvalidStatusChange) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this reservation can't be cancelled online anymore. Please contact us.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Your reservation has been cancelled")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PostGuestChangeReservation moves a reservation to other dates for the guest, if the bungalow
+// is available, and tells the owner about it. The price is calculated again for the new dates.
+func (m *Repository) PostGuestChangeReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token := r.Form.Get("token")
+
+	res, ok := m.guestReservation(w, r, token)
+	if !ok {
+		return
+	}
+
+	back := "/my-reservation?token=" + url.QueryEscape(token)
+
+	days, err := m.cancellationDays(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	deadline := res.StartDate.AddDate(0, 0, -days)
+
+	if res.Status == models.ReservationCancelled {
+		m.App.Session.Put(r.Context(), "error", "This reservation has been cancelled and can't be changed.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if time.Now().After(deadline) || !res.Status.CanBecome(models.ReservationCancelled) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this reservation can't be changed online anymore. Please contact us.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("start_date", "end_date")
+
+	layout := "2006-01-02"
+	changed := res
+
+	if form.Has("start_date") && form.Has("end_date") {
+		changed.StartDate, err = time.Parse(layout, form.Get("start_date"))
+		if err != nil {
+			form.Errors.Add("start_date", "Please enter a date like 2030-07-01.")
+		}
+		changed.EndDate, err = time.Parse(layout, form.Get("end_date"))
+		if err != nil {
+			form.Errors.Add("end_date", "Please enter a date like 2030-07-01.")
+		}
+	}
+
+	// the new arrival has to be outside of the change period as well, otherwise a guest could move
+	// a reservation to shortly before arrival and still cancel it for free
+	switch {
+	case !form.Valid():
+	case changed.StartDate.Before(today()):
+		form.Errors.Add("start_date", "Please choose an arrival in the future.")
+	case time.Now().After(changed.StartDate.AddDate(0, 0, -days)):
+		form.Errors.Add("start_date", fmt.Sprintf("Reservations can be changed online up to %d days before arrival, please choose a later arrival.", days))
+	}
+
+	if form.Valid() {
+		quote, err := m.Prices.Quote(r.Context(), changed.BungalowID, changed.StartDate, changed.EndDate)
+		var minStay *pricing.MinimumStayError
+		var maxStay *pricing.MaximumStayError
+		switch {
+		case errors.As(err, &minStay):
+			form.Errors.Add("end_date", fmt.Sprintf("The minimum stay in this holiday home is %d nights for these dates.", minStay.MinNights))
+		case errors.As(err, &maxStay):
+			form.Errors.Add("end_date", fmt.Sprintf("A stay can't be longer than %d nights.", maxStay.MaxNights))
+		case errors.Is(err, pricing.ErrInvalidDates):
+			form.Errors.Add("end_date", "Please choose a departure after the arrival.")
+		case err != nil:
+			helpers.ServerError(w, err)
+			return
+		}
+		changed.TotalPrice = quote.Total
+	}
+
+	if !form.Valid() {
+		m.renderGuestReservation(w, r, res, token, form)
+		return
+	}
+
+	mailData := make(map[string]interface{})
+	mailData["reservation"] = changed
+	mailData["previous"] = res
+	mailData["link"] = m.guestLink(token)
+
+	mails, err := m.guestChangeMails(changed, "reservation-changed", "Your reservation has been changed", "Reservation Changed", mailData)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// availability is checked inside, with the days of the reservation itself counting as free
+	err = m.DB.ChangeReservationDates(r.Context(), changed, mails)
+	if errors.Is(err, repository.ErrNotAvailable) {
+		form.Errors.Add("start_date", "Sorry, the holiday home isn't available for these dates.")
+		m.renderGuestReservation(w, r, res, token, form)
+		return
+	}
+	if errors.Is(err, repository.ErrReservationCancelled) {
+		m.App.Session.Put(r.Context(), "error", "This reservation has been cancelled and can't be changed.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Your reservation has been changed")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// guestReservation returns the reservation of a guest link, or sends the guest to the home page
+// if the link is unknown
+func (m *Repository) guestReservation(w http.ResponseWriter, r *http.Request, token string) (models.Reservation, bool) {
+	res, err := m.DB.GetReservationByAccessToken(r.Context(), helpers.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid. Please use the link from your confirmation e-mail.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return res, false
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return res, false
+	}
+
+	return res, true
+}
+
+// renderGuestReservation renders the page of a reservation for the guest with the form to change its dates
+func (m *Repository) renderGuestReservation(w http.ResponseWriter, r *http.Request, res models.Reservation, token string, form *forms.Form) {
+	deadline, err := m.changeDeadline(r, res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["cancelled"] = res.Status == models.ReservationCancelled
+	data["changeable"] = res.Status.CanBecome(models.ReservationCancelled) && !time.Now().After(deadline)
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = token
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+	stringMap["deadline"] = render.HumanReadableDate(deadline)
+
+	render.Template(w, r, "guest-reservation-page.tpml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      form,
+	})
+}
+
+// changeDeadline returns the last moment the guest can change or cancel a reservation,
+// the setting's number of days before arrival
+func (m *Repository) changeDeadline(r *http.Request, res models.Reservation) (time.Time, error) {
+	days, err := m.cancellationDays(r)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return res.StartDate.AddDate(0, 0, -days), nil
+}
+
+// cancellationDays returns the number of days before arrival until which guests can change or
+// cancel a reservation themselves
+func (m *Repository) cancellationDays(r *http.Request) (int, error) {
+	days := defaultCancellationDays
+
+	value, err := m.DB.GetSetting(r.Context(), models.SettingCancellationDays)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+		days = n
+	}
+
+	return days, nil
+}
+
+// guestLink returns the link a guest manages a reservation with
+func (m *Repository) guestLink(token string) string {
+	return fmt.Sprintf("%s/my-reservation?token=%s", m.App.BaseURL, token)
+}
+
+// guestChangeMails renders the e-mails to the guest and to the owner about a reservation the guest
+// has changed or cancelled. The templates are named like the prefix, e.g. reservation-cancelled-guest.
+func (m *Repository) guestChangeMails(res models.Reservation, prefix, guestSubject, ownerSubject string, mailData map[string]interface{}) ([]models.MailData, error) {
+	guestMsg, err := render.Mail(models.MailData{
+		To:       res.Email,
+		From:     m.App.Mail.From,
+		Subject:  guestSubject,
+		Template: prefix + "-guest",
+		Data:     mailData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ownerMsg, err := render.Mail(models.MailData{
+		To:       ownerAddress,
+		From:     m.App.Mail.From,
+		Subject:  ownerSubject,
+		Template: prefix + "-owner",
+		Data:     mailData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.MailData{guestMsg, ownerMsg}, nil
+}
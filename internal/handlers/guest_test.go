@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
+)
+
+func TestGuestReservation(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		token              string
+		expectedStatusCode int
+		expectedText       string
+	}{
+		{"changeable", dbrepo.TestAccessToken, http.StatusOK, "Change Dates"},
+		{"too-late", dbrepo.TestLateAccessToken, http.StatusOK, "can't be changed or cancelled online anymore"},
+		{"cancelled", dbrepo.TestCancelledAccessToken, http.StatusOK, "has been cancelled"},
+		{"invalid-token", "invalid-token", http.StatusSeeOther, ""},
+		{"no-token", "", http.StatusSeeOther, ""},
+	} {
+		req, _ := http.NewRequest("GET", "/my-reservation?token="+url.QueryEscape(e.token), nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.GuestReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+		if e.expectedText != "" && !strings.Contains(rr.Body.String(), e.expectedText) {
+			t.Errorf("failed %s: expected %q on the page", e.name, e.expectedText)
+		}
+	}
+}
+
+func TestPostGuestCancelReservation(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		token              string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"valid", dbrepo.TestAccessToken, http.StatusSeeOther, "success"},
+		{"too-late", dbrepo.TestLateAccessToken, http.StatusSeeOther, "error"},
+		{"cancelled", dbrepo.TestCancelledAccessToken, http.StatusSeeOther, "warning"},
+		{"invalid-token", "invalid-token", http.StatusSeeOther, "error"},
+	} {
+		postedData := url.Values{"token": {e.token}}
+
+		req, _ := http.NewRequest("POST", "/my-reservation/cancel", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostGuestCancelReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if session.PopString(ctx, e.expectedFlash) == "" {
+			t.Errorf("failed %s: expected a %s message", e.name, e.expectedFlash)
+		}
+	}
+}
+
+func TestPostGuestChangeReservation(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		token              string
+		start, end         string
+		expectedStatusCode int
+	}{
+		{"valid", dbrepo.TestAccessToken, "2030-01-12", "2030-01-16", http.StatusSeeOther},
+		{"not-available", dbrepo.TestAccessToken, "2037-01-10", "2037-01-14", http.StatusOK},
+		{"minimum-stay", dbrepo.TestAccessToken, "2030-07-01", "2030-07-04", http.StatusOK},
+		{"end-before-start", dbrepo.TestAccessToken, "2030-01-12", "2030-01-10", http.StatusOK},
+		{"in-the-past", dbrepo.TestAccessToken, "2020-01-12", "2020-01-16", http.StatusOK},
+		{"inside-change-period", dbrepo.TestAccessToken, time.Now().AddDate(0, 0, 3).Format("2006-01-02"), time.Now().AddDate(0, 0, 7).Format("2006-01-02"), http.StatusOK},
+		{"invalid-date", dbrepo.TestAccessToken, "next monday", "2030-01-16", http.StatusOK},
+		{"too-late", dbrepo.TestLateAccessToken, "2030-01-12", "2030-01-16", http.StatusSeeOther},
+		{"cancelled", dbrepo.TestCancelledAccessToken, "2030-01-12", "2030-01-16", http.StatusSeeOther},
+		{"invalid-token", "invalid-token", "2030-01-12", "2030-01-16", http.StatusSeeOther},
+	} {
+		postedData := url.Values{"token": {e.token}, "start_date": {e.start}, "end_date": {e.end}}
+
+		req, _ := http.NewRequest("POST", "/my-reservation/change", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostGuestChangeReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.name == "valid" && session.PopString(ctx, "success") == "" {
+			t.Errorf("failed %s: expected a success message", e.name)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,11 +12,14 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/calsync"
 	"github.com/jagottsicher/myGoWebApplication/internal/config"
 	"github.com/jagottsicher/myGoWebApplication/internal/driver"
 	"github.com/jagottsicher/myGoWebApplication/internal/forms"
 	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/loginguard"
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/pricing"
 	"github.com/jagottsicher/myGoWebApplication/internal/render"
 	"github.com/jagottsicher/myGoWebApplication/internal/repository"
 	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
@@ -22,8 +27,10 @@ import (
 
 // Repository is the repository type
 type Repository struct {
-	App *config.AppConfig
-	DB  repository.DatabaseRepo
+	App       *config.AppConfig
+	DB        repository.DatabaseRepo
+	Calendars *calsync.Syncer
+	Prices    *pricing.Service
 }
 
 // Repo the repository used by the handlers
@@ -31,17 +38,28 @@ var Repo *Repository
 
 // NewRepo creates a new repository
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
+	repo := dbrepo.NewPostgresRepo(db.SQL, a)
+
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+		App:       a,
+		DB:        repo,
+		Calendars: calsync.NewSyncer(repo, a.CalendarSync, a.InfoLog, a.ErrorLog),
+		Prices:    pricing.NewService(repo),
 	}
 }
 
 // NewTestRepo creates a new repository for basic
 func NewTestRepo(a *config.AppConfig) *Repository {
+	repo := dbrepo.NewTestingRepo(a)
+
+	// calendars are read from the testdata directory instead of being downloaded
+	cfg := config.CalendarSyncConfig{Interval: time.Hour, Dir: "testdata"}
+
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewTestingRepo(a),
+		App:       a,
+		DB:        repo,
+		Calendars: calsync.NewSyncer(repo, cfg, a.InfoLog, a.ErrorLog),
+		Prices:    pricing.NewService(repo),
 	}
 }
 
@@ -65,24 +83,17 @@ func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "contact-page.tpml", &models.TemplateData{})
 }
 
-// Eremite is the handler for the eremite page
-func (m *Repository) Eremite(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "eremite-page.tpml", &models.TemplateData{})
-}
-
-// Couple is the handler for the couple page
-func (m *Repository) Couple(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "couple-page.tpml", &models.TemplateData{})
-}
-
-// Family is the handler for the family page
-func (m *Repository) Family(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "family-page.tpml", &models.TemplateData{})
-}
+// maxPartySize is the largest number of adults, and of children, accepted by the availability search
+const maxPartySize = 10
 
 // Reservation is the handler for the reservation page
 func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "check-availability-page.tpml", &models.TemplateData{})
+	intMap := make(map[string]int)
+	intMap["max_party_size"] = maxPartySize
+
+	render.Template(w, r, "check-availability-page.tpml", &models.TemplateData{
+		IntMap: intMap,
+	})
 }
 
 // PostReservation is the handler for the reservation page and POST requests
@@ -114,7 +125,27 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bungalows, err := m.DB.SearchAvailabilityByDatesForAllBungalows(startDate, endDate)
+	if !m.checkStayDates(w, r, startDate, endDate) {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.IntRange("adults", 1, maxPartySize)
+	form.IntRange("children", 0, maxPartySize)
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Please choose 1 to %d adults and up to %d children.", maxPartySize, maxPartySize))
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return
+	}
+
+	res := models.Reservation{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Adults:    guestCount(form, "adults"),
+		Children:  guestCount(form, "children"),
+	}
+
+	bungalows, err := m.DB.SearchAvailabilityByDatesForAllBungalows(r.Context(), startDate, endDate, res.Guests())
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't get data from database")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -122,19 +153,40 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(bungalows) == 0 {
-		m.App.Session.Put(r.Context(), "error", ":( No holiday home is available at that time.")
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf(":( No holiday home for %d guests is available at that time.", res.Guests()))
 		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["bungalows"] = bungalows
+	// the price of the stay in each bungalow, bungalows with a longer minimum stay are listed without link
+	quotes := make(map[int]pricing.Quote)
+	minNights := make(map[int]int)
 
-	res := models.Reservation{
-		StartDate: startDate,
-		EndDate:   endDate,
+	for _, b := range bungalows {
+		q, err := m.Prices.Quote(r.Context(), b.ID, startDate, endDate)
+
+		var minStay *pricing.MinimumStayError
+		switch {
+		case errors.As(err, &minStay):
+			minNights[b.ID] = minStay.MinNights
+		case errors.Is(err, pricing.ErrInvalidDates):
+			m.App.Session.Put(r.Context(), "error", "Please choose a departure after the arrival.")
+			http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+			return
+		case err != nil:
+			m.App.Session.Put(r.Context(), "error", "can't calculate prices")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		quotes[b.ID] = q
 	}
 
+	data := make(map[string]interface{})
+	data["bungalows"] = bungalows
+	data["quotes"] = quotes
+	data["min_nights"] = minNights
+	data["reservation"] = res
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	render.Template(w, r, "choose-bungalow-page.tpml", &models.TemplateData{
@@ -196,7 +248,7 @@ func (m *Repository) ReservationJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	available, err := m.DB.SearchAvailabilityByDatesByBungalowID(startDate, endDate, bungalowID)
+	available, err := m.DB.SearchAvailabilityByDatesByBungalowID(r.Context(), startDate, endDate, bungalowID)
 	if err != nil {
 		// needs to be removed that the test works
 		// helpers.ServerError(w, err)
@@ -241,7 +293,7 @@ func (m *Repository) MakeReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bungalow, err := m.DB.GetBungalowByID(res.BungalowID)
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), res.BungalowID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't find bungalow!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -250,6 +302,17 @@ func (m *Repository) MakeReservation(w http.ResponseWriter, r *http.Request) {
 
 	res.Bungalow.BungalowName = bungalow.BungalowName
 
+	// reservations started on the page of a bungalow have no guests yet
+	if res.Adults == 0 {
+		res.Adults = 1
+	}
+
+	quote, ok := m.quoteReservation(w, r, res)
+	if !ok {
+		return
+	}
+	res.TotalPrice = quote.Total
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	sd := res.StartDate.Format("2006-01-02")
@@ -261,6 +324,8 @@ func (m *Repository) MakeReservation(w http.ResponseWriter, r *http.Request) {
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["quote"] = quote
+	data["bungalow"] = bungalow
 
 	render.Template(w, r, "make-reservation-page.tpml", &models.TemplateData{
 		Form:      forms.New(nil),
@@ -286,6 +351,29 @@ func (m *Repository) PostMakeReservation(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), res.BungalowID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't find bungalow!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// the price is calculated again, the rates may have changed since the form has been shown
+	quote, ok := m.quoteReservation(w, r, res)
+	if !ok {
+		return
+	}
+
+	//validate form data
+	form := forms.New(r.PostForm)
+
+	form.Required("full_name", "email")
+	form.MinLength("full_name", 2)
+	form.IsEmail("email")
+	if form.IntRange("adults", 1, bungalow.MaxGuests) && form.IntRange("children", 0, bungalow.MaxGuests) {
+		form.MaxGuests(bungalow.MaxGuests, "adults", "children")
+	}
+
 	reservation := models.Reservation{
 		FullName:   r.Form.Get("full_name"),
 		Email:      r.Form.Get("email"),
@@ -296,18 +384,16 @@ func (m *Repository) PostMakeReservation(w http.ResponseWriter, r *http.Request)
 		Bungalow: models.Bungalow{
 			BungalowName: res.Bungalow.BungalowName,
 		},
+		TotalPrice: quote.Total,
+		Adults:     guestCount(form, "adults"),
+		Children:   guestCount(form, "children"),
 	}
 
-	//validate form data
-	form := forms.New(r.PostForm)
-
-	form.Required("full_name", "email")
-	form.MinLength("full_name", 2)
-	form.IsEmail("email")
-
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+		data["quote"] = quote
+		data["bungalow"] = bungalow
 
 		// if new rendering of page needed store already collected
 		// (and maybe in session stored) dates as string in stringMap
@@ -330,59 +416,136 @@ func (m *Repository) PostMakeReservation(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	token, hash, err := helpers.NewToken()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't write reservation to database")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		helpers.ServerError(w, err)
 		return
 	}
+	reservation.AccessTokenHash = hash
 
-	restriction := models.BungalowRestriction{
-		StartDate:     res.StartDate,
-		EndDate:       res.EndDate,
-		BungalowID:    res.BungalowID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+	mails, err := m.reservationMails(reservation, m.guestLink(token))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
 	}
 
-	err = m.DB.InsertBungalowRestriction(restriction)
+	// reservation, restriction and both e-mails for the outbox are written in one transaction,
+	// availability is checked again inside
+	_, err = m.DB.BookReservation(r.Context(), reservation, mails)
+	if errors.Is(err, repository.ErrNotAvailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this holiday home has just been booked for your dates. Please choose other dates.")
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't reserve bungalow in database")
+		m.App.Session.Put(r.Context(), "error", "can't write reservation to database")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	// sending an e-mail to the user
-	htmlMessage := fmt.Sprintf(`
-	<strong>Receipt of a request for a reservation</strong><br><br>
-	Dear %s: <br>
-	we received your reservation request to rent the our bungalow "%s" from %s to %s.
-	`, reservation.FullName, res.Bungalow.BungalowName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+	http.Redirect(w, r, "/reservation-overview", http.StatusSeeOther)
+}
+
+// guestCount returns the number of guests entered in a form field, 0 if it isn't a number
+func guestCount(form *forms.Form, field string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(form.Get(field)))
+	return n
+}
+
+// ownerAddress receives the e-mails about reservations
+const ownerAddress = "whoever@is-in-charge.com"
+
+// reservationMails renders the e-mails to the guest and to the owner about a new reservation,
+// link is the secret link the guest can manage the reservation with
+func (m *Repository) reservationMails(reservation models.Reservation, link string) ([]models.MailData, error) {
+	mailData := make(map[string]interface{})
+	mailData["reservation"] = reservation
+	mailData["link"] = link
+
+	// e-mail to the user
+	guestMsg, err := render.Mail(models.MailData{
+		To:       reservation.Email,
+		From:     m.App.Mail.From,
+		Subject:  "Receipt of a request for a reservation",
+		Template: "reservation-guest",
+		Data:     mailData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// e-mail to the owner
+	ownerMsg, err := render.Mail(models.MailData{
+		To:       ownerAddress,
+		From:     m.App.Mail.From,
+		Subject:  "New Reservation Request",
+		Template: "reservation-owner",
+		Data:     mailData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.MailData{guestMsg, ownerMsg}, nil
+}
+
+// today returns the current date at midnight UTC, like the dates parsed from forms and urls, so an
+// arrival today isn't taken for one in the past
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
 
-	msg := models.MailData{
-		To:      reservation.Email,
-		From:    "noreply@bungalow-bliss.com",
-		Subject: "Receipt of a request for a reservation",
-		Content: htmlMessage,
+// checkStayDates sends the guest back to the search with a message and returns false if a stay
+// from start to end begins in the past, has no night or is longer than the maximum stay
+func (m *Repository) checkStayDates(w http.ResponseWriter, r *http.Request, start, end time.Time) bool {
+	var maxStay *pricing.MaximumStayError
+	var msg string
+
+	switch err := pricing.CheckStay(start, end); {
+	case start.Before(today()):
+		msg = "Please choose an arrival in the future."
+	case errors.As(err, &maxStay):
+		msg = fmt.Sprintf("Sorry, a stay can't be longer than %d nights.", maxStay.MaxNights)
+	case errors.Is(err, pricing.ErrInvalidDates):
+		msg = "Please choose a departure after the arrival."
+	default:
+		return true
 	}
-	m.App.MailChan <- msg
 
-	// sending an e-mail to the owner
-	htmlMessage = fmt.Sprintf(`
-		<strong>New Reservation Request</strong><br>
-		we received a new reservation request to rent the bungalow "%s" from %s to %s.
-		`, res.Bungalow.BungalowName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	m.App.Session.Put(r.Context(), "error", msg)
+	http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+	return false
+}
 
-	msg = models.MailData{
-		To:      "whoever@is-in-charge.com",
-		From:    "noreply@bungalow-bliss.com",
-		Subject: "New Reservation Request",
-		Content: htmlMessage,
+// quoteReservation calculates the price of a reservation. If the stay doesn't fit the rules of
+// the bungalow the guest is sent back to the search with a message and false is returned.
+func (m *Repository) quoteReservation(w http.ResponseWriter, r *http.Request, res models.Reservation) (pricing.Quote, bool) {
+	quote, err := m.Prices.Quote(r.Context(), res.BungalowID, res.StartDate, res.EndDate)
+
+	var minStay *pricing.MinimumStayError
+	var maxStay *pricing.MaximumStayError
+	switch {
+	case errors.As(err, &minStay):
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sorry, the minimum stay in this holiday home is %d nights for your dates.", minStay.MinNights))
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return quote, false
+	case errors.As(err, &maxStay):
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sorry, a stay can't be longer than %d nights.", maxStay.MaxNights))
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return quote, false
+	case errors.Is(err, pricing.ErrInvalidDates):
+		m.App.Session.Put(r.Context(), "error", "Please choose a departure after the arrival.")
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return quote, false
+	case err != nil:
+		m.App.Session.Put(r.Context(), "error", "can't calculate the price")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return quote, false
 	}
-	m.App.MailChan <- msg
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
-	http.Redirect(w, r, "/reservation-overview", http.StatusSeeOther)
+	return quote, true
 }
 
 // ReservationOverview displays the reservation summary page
@@ -397,7 +560,7 @@ func (m *Repository) ReservationOverview(w http.ResponseWriter, r *http.Request)
 
 	m.App.Session.Remove(r.Context(), "reservation")
 
-	bungalow, err := m.DB.GetBungalowByID(res.BungalowID)
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), res.BungalowID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't find bungalow!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -457,12 +620,27 @@ func (m *Repository) BookBungalow(w http.ResponseWriter, r *http.Request) {
 	ed := r.URL.Query().Get("e")
 
 	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	startDate, err := time.Parse(layout, sd)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get dates from link")
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return
+	}
+
+	endDate, err := time.Parse(layout, ed)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get dates from link")
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return
+	}
+
+	if !m.checkStayDates(w, r, startDate, endDate) {
+		return
+	}
 
 	var res models.Reservation
 
-	bungalow, err := m.DB.GetBungalowByID(bungalowID)
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), bungalowID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Cannot find bungalow!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -495,7 +673,7 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 	}
 
-	email := r.Form.Get("email")
+	email := helpers.NormalizeEmail(r.Form.Get("email"))
 	password := r.Form.Get("password")
 
 	form := forms.New(r.PostForm)
@@ -509,14 +687,68 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, _, err := m.DB.Authenticate(email, password)
+	// attempts are counted per account and ip address, the account doesn't need to exist. Every attempt
+	// is recorded as failed login before the password is checked, so parallel attempts can't get around
+	// the limits.
+	ip := helpers.ClientIP(r)
+
+	attemptID, stats, err := m.DB.RecordLoginAttempt(r.Context(), email, ip, loginguard.Default.Since(time.Now()))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if wait := loginguard.Default.RetryAfter(stats, time.Now()); wait > 0 {
+		m.deleteLoginAttempt(r, attemptID)
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Too many failed logins, please try again in %s", humanDuration(wait)))
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	id, _, err := m.DB.Authenticate(r.Context(), email, password)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Invalid credentials")
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
 	}
 
+	m.deleteLoginAttempt(r, attemptID)
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the failed logins are kept until the second step succeeded as well
+	if user.TOTPEnabled {
+		m.App.Session.Put(r.Context(), "totp_user_id", id)
+		m.App.Session.Put(r.Context(), "totp_expires", time.Now().Add(twoFactorTTL).Unix())
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.ClearFailedLogins(r.Context(), email)
+	if err != nil {
+		m.App.ErrorLog.Println("can't clear failed logins:", err)
+	}
+
+	required, err := m.twoFactorRequired(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "user_id", id)
+	m.App.Session.Put(r.Context(), "user_role", user.Role)
+
+	if required {
+		m.App.Session.Put(r.Context(), "totp_setup_required", true)
+		m.App.Session.Put(r.Context(), "warning", "Two-factor authentication is required, please set it up now")
+		http.Redirect(w, r, "/admin/2fa", http.StatusSeeOther)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "success", "Successfully logged in")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -538,7 +770,7 @@ func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 // AdminNewReservations displays new reservations only in admin area
 func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
 
-	reservations, err := m.DB.AllNewReservations()
+	reservations, err := m.DB.AllNewReservations(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -552,10 +784,16 @@ func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// AdminAllReservations displays all reservations in admin area
+// AdminAllReservations displays all reservations in admin area, only those with a status given by ?status=
 func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
 
-	reservations, err := m.DB.AllReservations()
+	status := models.ReservationStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.Valid() {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	reservations, err := m.DB.AllReservations(r.Context(), status)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -563,6 +801,8 @@ func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["status"] = status
+	data["statuses"] = models.ReservationStatuses
 
 	render.Template(w, r, "admin-all-reservations-page.tpml", &models.TemplateData{
 		Data: data,
@@ -611,7 +851,7 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 	intMap := make(map[string]int)
 	intMap["days_in_month"] = lastOfMonth.Day()
 
-	bungalows, err := m.DB.AllBungalows()
+	bungalows, err := m.DB.AllBungalows(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -620,18 +860,20 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 	data["bungalows"] = bungalows
 
 	for _, x := range bungalows {
-		// create maps (one for reservations, one for blocked days)
+		// create maps (one for reservations, one for blocked days, one for days booked on other portals)
 		reservationMap := make(map[string]int)
 		blockMap := make(map[string]int)
+		externalMap := make(map[string]int)
 
 		// iterate over all days with for-loop over dates and fill the maps
 		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
 			reservationMap[d.Format("2006-01-2")] = 0
 			blockMap[d.Format("2006-01-2")] = 0
+			externalMap[d.Format("2006-01-2")] = 0
 		}
 
 		// read in all the restrictions for the bungalow for the current month
-		restrictions, err := m.DB.GetRestrictionsForBungalowByDate(x.ID, firstOfMonth, lastOfMonth)
+		restrictions, err := m.DB.GetRestrictionsForBungalowByDate(r.Context(), x.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
 			helpers.ServerError(w, err)
 			return
@@ -643,6 +885,11 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
 					reservationMap[d.Format("2006-01-2")] = y.ReservationID
 				}
+			} else if y.RestrictionID == models.RestrictionExternal {
+				// if it is imported from another portal, it can't be changed here
+				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
+					externalMap[d.Format("2006-01-2")] = y.ID
+				}
 			} else {
 				// if it is a block
 				blockMap[y.StartDate.Format("2006-01-2")] = y.ID
@@ -651,6 +898,7 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 
 		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
 		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+		data[fmt.Sprintf("external_map_%d", x.ID)] = externalMap
 
 		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
 
@@ -674,7 +922,13 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	history, err := m.DB.ReservationStatusHistory(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -682,6 +936,7 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["history"] = history
 
 	src := exploded[3]
 
@@ -719,7 +974,7 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 
 	src := exploded[3]
 
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -729,7 +984,7 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 	res.Email = r.Form.Get("email")
 	res.Phone = r.Form.Get("phone")
 
-	err = m.DB.UpdateReservation(res)
+	err = m.DB.UpdateReservation(r.Context(), res)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -747,36 +1002,13 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 	}
 }
 
-// AdminProcessReservation changes the status of a reservation to processed
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
-
-	err := m.DB.UpdateStatusOfReservation(id, 1)
-	if err != nil {
-		log.Println(err)
-	}
-
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
-
-	m.App.Session.Put(r.Context(), "success", "Reservation successfully marked as processed")
-
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
-	}
-}
-
 // AdminDeleteReservation deletes a reservation from the database
 func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
 
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
 
-	_ = m.DB.DeleteReservation(id)
+	_ = m.DB.DeleteReservation(r.Context(), id)
 
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
@@ -802,7 +1034,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	month, _ := strconv.Atoi(r.Form.Get("m"))
 
 	// processing existing blocks
-	bungalows, err := m.DB.AllBungalows()
+	bungalows, err := m.DB.AllBungalows(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -827,7 +1059,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 				if val > 0 {
 					if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
 						// delete the bungalow_restriction by id
-						err := m.DB.DeleteBlockByID(value)
+						err := m.DB.DeleteBlockByID(r.Context(), value)
 						if err != nil {
 							log.Println(err)
 						}
@@ -845,7 +1077,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 			t, _ := time.Parse("2006-01-2", exploded[3])
 
 			// insert the bungalow_restriction by id
-			err := m.DB.InsertBlockForBungalow(bungalowID, t)
+			err := m.DB.InsertBlockForBungalow(r.Context(), bungalowID, t)
 			if err != nil {
 				log.Println(err)
 			}
@@ -855,3 +1087,60 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	m.App.Session.Put(r.Context(), "success", "Changes successfully saved")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
 }
+
+// AdminFailedMails lists all e-mails which could not be delivered
+func (m *Repository) AdminFailedMails(w http.ResponseWriter, r *http.Request) {
+
+	mails, err := m.DB.FailedMails(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["mails"] = mails
+
+	render.Template(w, r, "admin-failed-mails-page.tpml", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminResendMail puts a failed e-mail back into the outbox
+func (m *Repository) AdminResendMail(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.ResendMail(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This e-mail hasn't failed, it can't be sent again")
+		http.Redirect(w, r, "/admin/mails-failed", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "E-Mail will be sent again")
+	http.Redirect(w, r, "/admin/mails-failed", http.StatusSeeOther)
+}
+
+// deleteLoginAttempt removes a recorded login attempt which hasn't failed, errors are only logged
+func (m *Repository) deleteLoginAttempt(r *http.Request, id int) {
+	err := m.DB.DeleteLoginAttempt(r.Context(), id)
+	if err != nil {
+		m.App.ErrorLog.Println("can't delete login attempt:", err)
+	}
+}
+
+// humanDuration rounds a wait time up to whole seconds or minutes for messages
+func humanDuration(d time.Duration) string {
+	if d <= time.Minute {
+		return fmt.Sprintf("%d seconds", int((d+time.Second-1)/time.Second))
+	}
+	return fmt.Sprintf("%d minutes", int((d+time.Minute-1)/time.Minute))
+}
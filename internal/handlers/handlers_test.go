@@ -14,8 +14,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/jagottsicher/myGoWebApplication/internal/driver"
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
 )
 
 type postData struct {
@@ -34,8 +36,47 @@ var allTheHandlerTests = []struct {
 	{"eremite", "/eremite", "GET", http.StatusOK},
 	{"couple", "/couple", "GET", http.StatusOK},
 	{"family", "/family", "GET", http.StatusOK},
+	{"bungalows", "/bungalows", "GET", http.StatusOK},
+	{"bungalow", "/bungalows/couple", "GET", http.StatusOK},
+	{"bungalow-not-found", "/bungalows/penthouse", "GET", http.StatusNotFound},
+	{"image-not-found", "/images/thumb/penthouse.jpg", "GET", http.StatusNotFound},
+	{"image-unknown-variant", "/images/huge/eremite-1.jpg", "GET", http.StatusNotFound},
 	{"reservation", "/reservation", "GET", http.StatusOK},
+	{"my-reservation", "/my-reservation?token=" + dbrepo.TestAccessToken, "GET", http.StatusOK},
+	{"my-reservation-invalid-token", "/my-reservation?token=invalid-token", "GET", http.StatusOK},
 	{"contact", "/contact", "GET", http.StatusOK},
+	{"admin-mails-failed", "/admin/mails-failed", "GET", http.StatusOK},
+	{"admin-resend-mail-get", "/admin/resend-mail/2", "GET", http.StatusMethodNotAllowed},
+	{"admin-users", "/admin/users", "GET", http.StatusOK},
+	{"admin-failed-logins", "/admin/failed-logins", "GET", http.StatusOK},
+	{"admin-unlock-account-get", "/admin/unlock-account", "GET", http.StatusMethodNotAllowed},
+	{"admin-user-new", "/admin/users/new", "GET", http.StatusOK},
+	{"admin-user-edit", "/admin/users/2", "GET", http.StatusOK},
+	{"admin-user-not-found", "/admin/users/99", "GET", http.StatusNotFound},
+	{"admin-delete-user-get", "/admin/delete-user/2", "GET", http.StatusMethodNotAllowed},
+	{"forgot-password", "/user/forgot-password", "GET", http.StatusOK},
+	{"reset-password", "/user/reset-password?token=valid-token", "GET", http.StatusOK},
+	{"reset-password-invalid-token", "/user/reset-password?token=invalid-token", "GET", http.StatusOK},
+	{"two-factor-without-login", "/user/2fa", "GET", http.StatusOK},
+	{"admin-two-factor", "/admin/2fa", "GET", http.StatusOK},
+	{"admin-reset-two-factor-get", "/admin/reset-2fa", "GET", http.StatusMethodNotAllowed},
+	{"admin-reservations-all-by-status", "/admin/reservations-all?status=cancelled", "GET", http.StatusOK},
+	{"admin-reservations-all-unknown-status", "/admin/reservations-all?status=paid", "GET", http.StatusBadRequest},
+	{"admin-settings", "/admin/settings", "GET", http.StatusOK},
+	{"admin-ical-token-get", "/admin/ical-token/1", "GET", http.StatusMethodNotAllowed},
+	{"admin-api-tokens", "/admin/api-tokens", "GET", http.StatusOK},
+	{"admin-revoke-api-token-get", "/admin/revoke-api-token/1", "GET", http.StatusMethodNotAllowed},
+	{"admin-calendar-imports", "/admin/calendar-imports", "GET", http.StatusOK},
+	{"admin-sync-calendar-import-get", "/admin/sync-calendar-import/1", "GET", http.StatusMethodNotAllowed},
+	{"admin-delete-calendar-import-get", "/admin/delete-calendar-import/2", "GET", http.StatusMethodNotAllowed},
+	{"admin-prices", "/admin/prices", "GET", http.StatusOK},
+	{"admin-delete-season-get", "/admin/delete-season/1", "GET", http.StatusMethodNotAllowed},
+	{"admin-bungalows", "/admin/bungalows", "GET", http.StatusOK},
+	{"admin-bungalow-new", "/admin/bungalows/new", "GET", http.StatusOK},
+	{"admin-bungalow-edit", "/admin/bungalows/3", "GET", http.StatusOK},
+	{"admin-bungalow-not-found", "/admin/bungalows/99", "GET", http.StatusNotFound},
+	{"admin-delete-bungalow-get", "/admin/delete-bungalow/3", "GET", http.StatusMethodNotAllowed},
+	{"admin-delete-bungalow-image-get", "/admin/delete-bungalow-image/1", "GET", http.StatusMethodNotAllowed},
 	{"not-existing-route", "/not-existing-dummy", "GET", http.StatusNotFound},
 }
 
@@ -81,6 +122,8 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData := url.Values{}
 	postedData.Add("start", "2037-01-01")
 	postedData.Add("end", "2037-01-02")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// create  request
 	req, _ := http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
@@ -113,6 +156,8 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData = url.Values{}
 	postedData.Add("start", "2036-01-01")
 	postedData.Add("end", "2036-01-02")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// create request
 	req, _ = http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
@@ -170,6 +215,8 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData = url.Values{}
 	postedData.Add("start", "invalid")
 	postedData.Add("end", "2037-01-02")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// create request
 	req, _ = http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
@@ -201,6 +248,8 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData = url.Values{}
 	postedData.Add("start", "2037-01-01")
 	postedData.Add("end", "invalid")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// create request
 	req, _ = http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
@@ -232,6 +281,8 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData = url.Values{}
 	postedData.Add("start", "2038-01-01")
 	postedData.Add("end", "2038-01-02")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// create request
 	req, _ = http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
@@ -266,6 +317,8 @@ func TestRepository_MakeReservation(t *testing.T) {
 	// creating reservation data for test purpose
 
 	reservation := models.Reservation{
+		StartDate:  time.Date(2030, 1, 7, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC),
 		BungalowID: 1,
 		Bungalow: models.Bungalow{
 			ID:           1,
@@ -335,6 +388,8 @@ func TestRepository_PostMakeReservation(t *testing.T) {
 	postedData.Add("full_name", "Peter Griffin")
 	postedData.Add("email", "peter@griffin.family")
 	postedData.Add("phone", "1234567890")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// data to put in session
 	layout := "2006-01-02"
@@ -397,6 +452,8 @@ func TestRepository_PostMakeReservation(t *testing.T) {
 	postedData.Add("full_name", "Peter Griffin")
 	postedData.Add("email", "peter@griffin.family")
 	postedData.Add("phone", "1234567890")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// data to put in session
 	layout = "2006-01-02"
@@ -436,6 +493,8 @@ func TestRepository_PostMakeReservation(t *testing.T) {
 	postedData.Add("full_name", "P")
 	postedData.Add("email", "peter@griffin.family")
 	postedData.Add("phone", "1234567890")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// data to put in session
 	layout = "2006-01-02"
@@ -479,6 +538,8 @@ func TestRepository_PostMakeReservation(t *testing.T) {
 	postedData.Add("full_name", "Peter Griffin")
 	postedData.Add("email", "peter@griffin.family")
 	postedData.Add("phone", "1234567890")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// data to put in session
 	layout = "2006-01-02"
@@ -522,6 +583,8 @@ func TestRepository_PostMakeReservation(t *testing.T) {
 	postedData.Add("full_name", "Peter Griffin")
 	postedData.Add("email", "peter@griffin.family")
 	postedData.Add("phone", "1234567890")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
 
 	// data to put in session
 	layout = "2006-01-02"
@@ -558,6 +621,56 @@ func TestRepository_PostMakeReservation(t *testing.T) {
 	if rr.Code != http.StatusTemporaryRedirect {
 		t.Errorf("PostMakeReservation handler failed when trying to inserting a reservation into the database: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
 	}
+
+	// case #7: bungalow has been booked by somebody else in the meantime
+
+	postedData = url.Values{}
+	postedData.Add("full_name", "Peter Griffin")
+	postedData.Add("email", "peter@griffin.family")
+	postedData.Add("phone", "1234567890")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "0")
+
+	// data to put in session
+	layout = "2006-01-02"
+	sd, _ = time.Parse(layout, "2037-01-01")
+	ed, _ = time.Parse(layout, "2037-01-02")
+	bungalowId, _ = strconv.Atoi("9999")
+
+	reservation = models.Reservation{
+		StartDate:  sd,
+		EndDate:    ed,
+		BungalowID: bungalowId,
+		Bungalow: models.Bungalow{
+			BungalowName: "some bungalow name for tests",
+		},
+	}
+
+	// create request
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+
+	// get the context
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+
+	session.Put(ctx, "reservation", reservation)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(Repo.PostMakeReservation)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostMakeReservation handler returned wrong response code for a bungalow no longer available: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	actualLoc, _ := rr.Result().Location()
+	if actualLoc.String() != "/reservation" {
+		t.Errorf("PostMakeReservation handler redirected to wrong location for a bungalow no longer available: got %s, wanted %s", actualLoc.String(), "/reservation")
+	}
 }
 
 // TestRepository_ReservationJSON tests the ReservationJSON POST-request handler
@@ -1047,6 +1160,11 @@ func TestLogin(t *testing.T) {
 			}
 		}
 
+		// a successful login stores the role of the user
+		if e.expectedLocation == "/" && session.GetInt(ctx, "user_role") != models.RoleOwner {
+			t.Errorf("failed %s: expected role %d in session, got %d", e.name, models.RoleOwner, session.GetInt(ctx, "user_role"))
+		}
+
 		// checking for expected values in HTML
 		if e.expectedHTML != "" {
 			// read the response body into a string
@@ -1234,35 +1352,35 @@ func TestPostReservationCalendar(t *testing.T) {
 	}
 }
 
-var adminProcessReservationTests = []struct {
+var adminDeleteReservationTests = []struct {
 	name                 string
 	queryParams          string
 	expectedResponseCode int
 	expectedLocation     string
 }{
 	{
-		name:                 "process-reservation",
+		name:                 "delete-reservation",
 		queryParams:          "",
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "",
 	},
 	{
-		name:                 "process-reservation-back-to-cal",
+		name:                 "delete-reservation-back-to-cal",
 		queryParams:          "?y=2024&m=02",
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "",
 	},
 }
 
-func TestAdminProcessReservation(t *testing.T) {
-	for _, e := range adminProcessReservationTests {
+func TestAdminDeleteReservation(t *testing.T) {
+	for _, e := range adminDeleteReservationTests {
 		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.queryParams), nil)
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
 
 		rr := httptest.NewRecorder()
 
-		handler := http.HandlerFunc(Repo.AdminProcessReservation)
+		handler := http.HandlerFunc(Repo.AdminDeleteReservation)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusSeeOther {
@@ -1271,39 +1389,178 @@ func TestAdminProcessReservation(t *testing.T) {
 	}
 }
 
-var adminDeleteReservationTests = []struct {
-	name                 string
-	queryParams          string
-	expectedResponseCode int
-	expectedLocation     string
+func TestAdminResendMail(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/admin/resend-mail/2", nil)
+	ctx := getCtx(req)
+
+	// chi URL parameters are not set when calling the handler directly
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "2")
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminResendMail)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("failed resend-mail: expected code %d, but got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	// e-mail which hasn't failed
+	req, _ = http.NewRequest("POST", "/admin/resend-mail/1", nil)
+	ctx = getCtx(req)
+	rctx = chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	req = req.WithContext(ctx)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("failed resend-mail of pending e-mail: expected code %d, but got %d", http.StatusSeeOther, rr.Code)
+	}
+	if session.PopString(ctx, "error") == "" {
+		t.Error("failed resend-mail of pending e-mail: expected an error message")
+	}
+
+	// invalid id
+	req, _ = http.NewRequest("POST", "/admin/resend-mail/x", nil)
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("failed resend-mail with invalid id: expected code %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// stayDatesTests is the data for the tests of the dates of a search and of a booking link
+var stayDatesTests = []struct {
+	name          string
+	method        string
+	url           string
+	postedData    url.Values
+	handler       func(*Repository, http.ResponseWriter, *http.Request)
+	expectedError string
 }{
-	{
-		name:                 "delete-reservation",
-		queryParams:          "",
-		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
-	},
-	{
-		name:                 "delete-reservation-back-to-cal",
-		queryParams:          "?y=2024&m=02",
-		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
-	},
+	{"search", "POST", "/reservation", url.Values{"start": {"2036-01-01"}, "end": {"2036-01-05"}, "adults": {"1"}, "children": {"0"}}, (*Repository).PostReservation, ""},
+	{"search-today", "POST", "/reservation", url.Values{"start": {time.Now().Format("2006-01-02")}, "end": {time.Now().AddDate(0, 0, 3).Format("2006-01-02")}, "adults": {"1"}, "children": {"0"}}, (*Repository).PostReservation, ""},
+	{"search-in-the-past", "POST", "/reservation", url.Values{"start": {"2020-01-01"}, "end": {"2020-01-05"}, "adults": {"1"}, "children": {"0"}}, (*Repository).PostReservation, "arrival in the future"},
+	{"search-too-long", "POST", "/reservation", url.Values{"start": {"2036-01-01"}, "end": {"9999-12-31"}, "adults": {"1"}, "children": {"0"}}, (*Repository).PostReservation, "can't be longer than 90 nights"},
+	{"search-end-before-start", "POST", "/reservation", url.Values{"start": {"2036-01-05"}, "end": {"2036-01-01"}, "adults": {"1"}, "children": {"0"}}, (*Repository).PostReservation, "departure after the arrival"},
+	{"book", "GET", "/book-bungalow?s=2036-01-01&e=2036-01-05&id=1", nil, (*Repository).BookBungalow, ""},
+	{"book-today", "GET", "/book-bungalow?s=" + time.Now().Format("2006-01-02") + "&e=" + time.Now().AddDate(0, 0, 3).Format("2006-01-02") + "&id=1", nil, (*Repository).BookBungalow, ""},
+	{"book-in-the-past", "GET", "/book-bungalow?s=2020-01-01&e=2020-01-05&id=1", nil, (*Repository).BookBungalow, "arrival in the future"},
+	{"book-too-long", "GET", "/book-bungalow?s=2036-01-01&e=2036-12-31&id=1", nil, (*Repository).BookBungalow, "can't be longer than 90 nights"},
+	{"book-invalid-date", "GET", "/book-bungalow?s=tomorrow&e=2036-01-05&id=1", nil, (*Repository).BookBungalow, "can't get dates"},
 }
 
-func TestAdminDeleteReservation(t *testing.T) {
-	for _, e := range adminDeleteReservationTests {
-		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.queryParams), nil)
+func TestStayDates(t *testing.T) {
+	for _, e := range stayDatesTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.postedData.Encode()))
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 		rr := httptest.NewRecorder()
+		e.handler(Repo, rr, req)
 
-		handler := http.HandlerFunc(Repo.AdminDeleteReservation)
+		msg := session.GetString(ctx, "error")
+		if e.expectedError == "" && msg != "" {
+			t.Errorf("failed %s: expected no error, but got %q", e.name, msg)
+		}
+		if e.expectedError != "" {
+			if !strings.Contains(msg, e.expectedError) {
+				t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, msg)
+			}
+			if rr.Header().Get("Location") != "/reservation" {
+				t.Errorf("failed %s: expected redirect to /reservation, but got %q", e.name, rr.Header().Get("Location"))
+			}
+		}
+	}
+}
+
+// loginLockoutTests is the data for the login tests with too many failed logins
+var loginLockoutTests = []struct {
+	name          string
+	email         string
+	remoteAddr    string
+	expectedError string
+}{
+	{"locked-account", "locked@bikini-bottom.ocean", "10.0.0.1:1234", "Too many failed logins"},
+	{"locked-account-other-case", "Locked@Bikini-Bottom.ocean", "10.0.0.1:1234", "Too many failed logins"},
+	{"locked-ip", "patrick@bikini-bottom.ocean", "10.0.0.66:1234", "Too many failed logins"},
+	{"not-locked", "patrick@bikini-bottom.ocean", "10.0.0.1:1234", ""},
+	{"not-locked-other-case", "Patrick@Bikini-Bottom.ocean", "10.0.0.1:1234", ""},
+}
+
+func TestLoginLockout(t *testing.T) {
+	for _, e := range loginLockoutTests {
+		postedData := url.Values{}
+		postedData.Add("email", e.email)
+		postedData.Add("password", "password")
+
+		req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = e.remoteAddr
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostShowLogin)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusSeeOther {
-			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		msg := session.GetString(ctx, "error")
+		if e.expectedError == "" && msg != "" {
+			t.Errorf("failed %s: expected no error, but got %q", e.name, msg)
+		}
+		if e.expectedError != "" && !strings.Contains(msg, e.expectedError) {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestGuestCounts(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		handler            http.HandlerFunc
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"search", Repo.PostReservation, url.Values{"start": {"2036-01-01"}, "end": {"2036-01-05"}, "adults": {"2"}, "children": {"1"}}, http.StatusOK},
+		{"search-too-many-guests", Repo.PostReservation, url.Values{"start": {"2036-01-01"}, "end": {"2036-01-05"}, "adults": {"4"}, "children": {"2"}}, http.StatusSeeOther},
+		{"search-without-adults", Repo.PostReservation, url.Values{"start": {"2036-01-01"}, "end": {"2036-01-05"}, "adults": {"0"}, "children": {"1"}}, http.StatusSeeOther},
+		{"search-invalid-children", Repo.PostReservation, url.Values{"start": {"2036-01-01"}, "end": {"2036-01-05"}, "adults": {"2"}, "children": {"some"}}, http.StatusSeeOther},
+		{"reservation", Repo.PostMakeReservation, url.Values{"full_name": {"Pearl Krabs"}, "email": {"pearl@krusty-krab.ocean"}, "adults": {"1"}, "children": {"1"}}, http.StatusSeeOther},
+		{"reservation-too-many-guests", Repo.PostMakeReservation, url.Values{"full_name": {"Pearl Krabs"}, "email": {"pearl@krusty-krab.ocean"}, "adults": {"2"}, "children": {"1"}}, http.StatusOK},
+		{"reservation-without-adults", Repo.PostMakeReservation, url.Values{"full_name": {"Pearl Krabs"}, "email": {"pearl@krusty-krab.ocean"}, "adults": {"0"}, "children": {"1"}}, http.StatusOK},
+	} {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		// the test bungalow 1 has room for 2 guests
+		session.Put(ctx, "reservation", models.Reservation{
+			StartDate:  time.Date(2030, 1, 7, 0, 0, 0, 0, time.UTC),
+			EndDate:    time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC),
+			BungalowID: 1,
+		})
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
 		}
 	}
 }
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/calsync"
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/ical"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+)
+
+// range of the restrictions in calendar feeds, relative to today
+const (
+	icalPastDays    = 30
+	icalFutureYears = 2
+)
+
+// icalProdID identifies this application as the creator of calendar feeds
+const icalProdID = "-//Bungalow Bliss//Reservations//EN"
+
+// icalFeed is the calendar feed of a bungalow shown in the settings
+type icalFeed struct {
+	Bungalow models.Bungalow
+	Active   bool
+}
+
+// ICalFeed serves the reservations and blocks of a bungalow as iCalendar feed for booking portals.
+// The feed needs the token created in the settings, guest names are only shown if enabled there.
+// Blocks imported from the calendars of the portals are left out.
+func (m *Repository) ICalFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "bungalowID"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	hash, err := m.DB.ICalTokenHash(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// unknown bungalows and wrong tokens look the same
+	token := r.URL.Query().Get("token")
+	if hash == "" || token == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(helpers.HashToken(token))) != 1 {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	bungalow, err := m.DB.GetBungalowByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	showNames, err := m.DB.GetSetting(r.Context(), models.SettingICalGuestNames)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	now := time.Now()
+	restrictions, err := m.DB.GetRestrictionsForBungalowByDate(r.Context(), id, now.AddDate(0, 0, -icalPastDays), now.AddDate(icalFutureYears, 0, 0))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	domain := "localhost"
+	if u, err := url.Parse(m.App.BaseURL); err == nil && u.Hostname() != "" {
+		domain = u.Hostname()
+	}
+
+	cal := ical.Calendar{
+		ProdID: icalProdID,
+		Name:   bungalow.BungalowName,
+	}
+
+	for _, x := range restrictions {
+		// blocks imported from the portals mustn't go back to them
+		if x.RestrictionID == models.RestrictionExternal {
+			continue
+		}
+
+		summary := "Blocked"
+		if x.ReservationID > 0 {
+			summary = "Reserved"
+
+			if showNames == "true" && x.Reservation.FullName != "" {
+				summary = fmt.Sprintf("Reserved: %s", x.Reservation.FullName)
+			}
+		}
+
+		cal.Events = append(cal.Events, ical.Event{
+			UID:     ical.UID("restriction", x.ID, domain),
+			Start:   x.StartDate,
+			End:     x.EndDate,
+			Summary: summary,
+			Stamp:   now,
+		})
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="bungalow-%d.ics"`, id))
+	w.Header().Set("Cache-Control", "no-store")
+
+	err = ical.Encode(w, cal)
+	if err != nil {
+		m.App.ErrorLog.Println("can't write calendar feed:", err)
+	}
+}
+
+// icalFeeds returns all bungalows and whether their calendar feed has been set up
+func (m *Repository) icalFeeds(r *http.Request) ([]icalFeed, error) {
+	bungalows, err := m.DB.AllBungalows(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	var feeds []icalFeed
+	for _, b := range bungalows {
+		hash, err := m.DB.ICalTokenHash(r.Context(), b.ID)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, icalFeed{Bungalow: b, Active: hash != ""})
+	}
+
+	return feeds, nil
+}
+
+// AdminNewICalToken creates a new link for the calendar feed of a bungalow, the old link stops working.
+// The link is shown only once.
+func (m *Repository) AdminNewICalToken(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = m.DB.GetBungalowByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token, hash, err := helpers.NewToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.SetICalTokenHash(r.Context(), id, hash)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "ical_link", fmt.Sprintf("%s/ical/%d.ics?token=%s", m.App.BaseURL, id, token))
+	m.App.Session.Put(r.Context(), "success", "New calendar link created, please copy it now")
+	http.Redirect(w, r, "/admin/settings", http.StatusSeeOther)
+}
+
+// AdminCalendarImports lists the calendars imported from other booking portals with a form to add one
+func (m *Repository) AdminCalendarImports(w http.ResponseWriter, r *http.Request) {
+	m.renderCalendarImports(w, r, forms.New(nil))
+}
+
+// AdminPostCalendarImports adds a calendar of another booking portal to a bungalow, either by url
+// or as uploaded file, and imports its events right away
+func (m *Repository) AdminPostCalendarImports(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, calsync.MaxCalendarSize+1<<20)
+
+	err := r.ParseMultipartForm(calsync.MaxCalendarSize)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	bungalowID, err := strconv.Atoi(r.Form.Get("bungalow_id"))
+	if err != nil {
+		form.Errors.Add("bungalow_id", "Please choose a bungalow.")
+	} else {
+		_, err = m.DB.GetBungalowByID(r.Context(), bungalowID)
+		if errors.Is(err, sql.ErrNoRows) {
+			form.Errors.Add("bungalow_id", "Please choose a bungalow.")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	c := models.CalendarImport{
+		BungalowID: bungalowID,
+		Name:       r.Form.Get("name"),
+		URL:        strings.TrimSpace(r.Form.Get("url")),
+	}
+
+	file, _, err := r.FormFile("file")
+	switch {
+	case err == nil:
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, calsync.MaxCalendarSize+1))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		c.Content = string(content)
+	case !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart):
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case c.URL == "" && c.Content == "":
+		form.Errors.Add("url", "Please enter the url of the calendar or upload a file.")
+	case c.URL != "" && c.Content != "":
+		form.Errors.Add("url", "Please either enter an url or upload a file.")
+	case c.URL != "":
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			form.Errors.Add("url", "Please enter a http or https url.")
+		}
+	case len(c.Content) > calsync.MaxCalendarSize:
+		form.Errors.Add("file", "The file is too large.")
+	default:
+		_, err := ical.Decode(strings.NewReader(c.Content))
+		if err != nil {
+			form.Errors.Add("file", "This is not a valid calendar file.")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderCalendarImports(w, r, form)
+		return
+	}
+
+	id, err := m.DB.InsertCalendarImport(r.Context(), c)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	c.ID = id
+
+	m.syncCalendarImport(w, r, c)
+}
+
+// AdminSyncCalendarImport imports the events of a calendar right away
+func (m *Repository) AdminSyncCalendarImport(w http.ResponseWriter, r *http.Request) {
+	c, ok := m.calendarImport(w, r)
+	if !ok {
+		return
+	}
+
+	m.syncCalendarImport(w, r, c)
+}
+
+// AdminDeleteCalendarImport removes a calendar import together with the restrictions of its events
+func (m *Repository) AdminDeleteCalendarImport(w http.ResponseWriter, r *http.Request) {
+	c, ok := m.calendarImport(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.DB.DeleteCalendarImport(r.Context(), c.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Calendar import removed")
+	http.Redirect(w, r, "/admin/calendar-imports", http.StatusSeeOther)
+}
+
+// calendarImport returns the calendar import given by the id url parameter, or writes an error response
+func (m *Repository) calendarImport(w http.ResponseWriter, r *http.Request) (models.CalendarImport, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.CalendarImport{}, false
+	}
+
+	c, err := m.DB.GetCalendarImportByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return c, false
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return c, false
+	}
+
+	return c, true
+}
+
+// syncCalendarImport imports the events of a calendar and redirects to the calendar imports with the outcome
+func (m *Repository) syncCalendarImport(w http.ResponseWriter, r *http.Request, c models.CalendarImport) {
+	result, err := m.Calendars.Sync(r.Context(), c)
+
+	switch {
+	case err != nil:
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Can't import %s: %s", c.Name, err))
+	case result.Conflicts > 0:
+		m.App.Session.Put(r.Context(), "warning", fmt.Sprintf("%s imported, but %d events overlap reservations made here",
+			c.Name, result.Conflicts))
+	default:
+		m.App.Session.Put(r.Context(), "success", fmt.Sprintf("%s imported: %d added, %d updated, %d removed",
+			c.Name, result.Added, result.Updated, result.Removed))
+	}
+
+	http.Redirect(w, r, "/admin/calendar-imports", http.StatusSeeOther)
+}
+
+// renderCalendarImports renders the calendar imports page
+func (m *Repository) renderCalendarImports(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	imports, err := m.DB.AllCalendarImports(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	bungalows, err := m.DB.AllBungalows(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["imports"] = imports
+	data["bungalows"] = bungalows
+
+	render.Template(w, r, "admin-calendar-imports-page.tpml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
+)
+
+// icalFeedTests is the data for the calendar feed tests, they run against the routes of getRoutes
+var icalFeedTests = []struct {
+	name               string
+	url                string
+	expectedStatusCode int
+}{
+	{"valid", "/ical/1.ics?token=" + dbrepo.TestICalToken, http.StatusOK},
+	{"wrong-token", "/ical/1.ics?token=guessed", http.StatusNotFound},
+	{"missing-token", "/ical/1.ics", http.StatusNotFound},
+	{"no-feed", "/ical/2.ics?token=" + dbrepo.TestICalToken, http.StatusNotFound},
+	{"unknown-bungalow", "/ical/4.ics?token=" + dbrepo.TestICalToken, http.StatusNotFound},
+	{"invalid-id", "/ical/x.ics?token=" + dbrepo.TestICalToken, http.StatusNotFound},
+}
+
+func TestICalFeed(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range icalFeedTests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+
+	// the feed has one event per reservation and block, without imported blocks and guest names by default
+	req := httptest.NewRequest("GET", "/ical/1.ics?token="+dbrepo.TestICalToken, nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/calendar") {
+		t.Errorf("expected text/calendar, got %s", rr.Header().Get("Content-Type"))
+	}
+	if n := strings.Count(body, "BEGIN:VEVENT"); n != 2 {
+		t.Errorf("expected 2 events, got %d", n)
+	}
+	for _, want := range []string{"SUMMARY:Blocked\r\n", "SUMMARY:Reserved\r\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in feed", want)
+		}
+	}
+}
+
+func TestAdminNewICalToken(t *testing.T) {
+	for _, e := range []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusSeeOther},
+		{"4", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/ical-token/"+e.id, nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminNewICalToken)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed id %s: expected code %d, but got %d", e.id, e.expectedStatusCode, rr.Code)
+		}
+
+		link := session.GetString(ctx, "ical_link")
+		if e.expectedStatusCode == http.StatusSeeOther && !strings.Contains(link, "/ical/1.ics?token=") {
+			t.Errorf("failed id %s: expected new link in session, got %q", e.id, link)
+		}
+	}
+}
+
+// adminPostCalendarImportsTests is the data for the AdminPostCalendarImports handler tests with url-encoded forms
+var adminPostCalendarImportsTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedFlash      string
+}{
+	{"valid", url.Values{"bungalow_id": {"1"}, "name": {"Jellyfish Fields Rentals"}, "url": {"https://jellyfish-fields.ocean/calendars/eremite.ics"}}, http.StatusSeeOther, "success"},
+	{"unreachable", url.Values{"bungalow_id": {"1"}, "name": {"Goo Lagoon Stays"}, "url": {"https://goo-lagoon.ocean/missing.ics"}}, http.StatusSeeOther, "error"},
+	{"missing-name", url.Values{"bungalow_id": {"1"}, "url": {"https://jellyfish-fields.ocean/calendars/eremite.ics"}}, http.StatusOK, ""},
+	{"missing-source", url.Values{"bungalow_id": {"1"}, "name": {"Jellyfish Fields Rentals"}}, http.StatusOK, ""},
+	{"file-url", url.Values{"bungalow_id": {"1"}, "name": {"Jellyfish Fields Rentals"}, "url": {"file:///etc/passwd"}}, http.StatusOK, ""},
+	{"unknown-bungalow", url.Values{"bungalow_id": {"4"}, "name": {"Jellyfish Fields Rentals"}, "url": {"https://jellyfish-fields.ocean/calendars/eremite.ics"}}, http.StatusOK, ""},
+	{"invalid-bungalow", url.Values{"bungalow_id": {"x"}, "name": {"Jellyfish Fields Rentals"}, "url": {"https://jellyfish-fields.ocean/calendars/eremite.ics"}}, http.StatusOK, ""},
+}
+
+func TestAdminPostCalendarImports(t *testing.T) {
+	for _, e := range adminPostCalendarImportsTests {
+		req, _ := http.NewRequest("POST", "/admin/calendar-imports", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostCalendarImports)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedFlash != "" && session.GetString(ctx, e.expectedFlash) == "" {
+			t.Errorf("failed %s: expected a %s message", e.name, e.expectedFlash)
+		}
+	}
+}
+
+func TestAdminPostCalendarImportsUpload(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		content            string
+		expectedStatusCode int
+	}{
+		{"valid", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nDTSTART;VALUE=DATE:20300101\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", http.StatusSeeOther},
+		{"no-calendar", "<html></html>", http.StatusOK},
+	} {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("bungalow_id", "2")
+		mw.WriteField("name", "Goo Lagoon Stays")
+		fw, _ := mw.CreateFormFile("file", "goo-lagoon.ics")
+		fw.Write([]byte(e.content))
+		mw.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/calendar-imports", &body)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostCalendarImports)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestAdminCalendarImportActions(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		handler            http.HandlerFunc
+		id                 string
+		expectedStatusCode int
+	}{
+		{"sync", Repo.AdminSyncCalendarImport, "1", http.StatusSeeOther},
+		{"sync-unknown", Repo.AdminSyncCalendarImport, "99", http.StatusNotFound},
+		{"sync-invalid", Repo.AdminSyncCalendarImport, "x", http.StatusBadRequest},
+		{"delete", Repo.AdminDeleteCalendarImport, "2", http.StatusSeeOther},
+		{"delete-unknown", Repo.AdminDeleteCalendarImport, "99", http.StatusNotFound},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/calendar-imports/"+e.id, nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+
+	// the downloaded calendar of import 1 is read from the testdata directory
+	req, _ := http.NewRequest("POST", "/admin/sync-calendar-import/1", nil)
+	ctx := getCtx(req)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+	http.HandlerFunc(Repo.AdminSyncCalendarImport).ServeHTTP(httptest.NewRecorder(), req)
+
+	if msg := session.GetString(ctx, "success"); !strings.Contains(msg, "2 added") {
+		t.Errorf("expected 2 added events, got %q", msg)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/images"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+)
+
+// maxCaptionLength is the longest caption of an image, in characters
+const maxCaptionLength = 255
+
+// Image serves a resized variant of a bungalow image, as jpeg for /images/thumb/{name} and in
+// another format for e.g. /images/thumb/webp/{name}
+func (m *Repository) Image(w http.ResponseWriter, r *http.Request) {
+	format := chi.URLParam(r, "format")
+	if format == "" {
+		format = "jpeg"
+	}
+
+	path, err := m.imageStore().Variant(chi.URLParam(r, "variant"), format, chi.URLParam(r, "name"))
+	if errors.Is(err, os.ErrNotExist) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// uploaded images get new names, so variants never change
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFile(w, r, path)
+}
+
+// AdminPostUploadBungalowImage stores an uploaded photo of a bungalow and adds it after its other images
+func (m *Repository) AdminPostUploadBungalowImage(w http.ResponseWriter, r *http.Request) {
+	bungalow, ok := m.adminBungalow(w, r)
+	if !ok {
+		return
+	}
+
+	back := fmt.Sprintf("/admin/bungalows/%d", bungalow.ID)
+	store := m.imageStore()
+
+	r.Body = http.MaxBytesReader(w, r.Body, store.MaxSize+1<<20)
+	err := r.ParseMultipartForm(store.MaxSize)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		m.App.Session.Put(r.Context(), "error", "The photo is too large")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	caption := r.Form.Get("caption")
+	if utf8.RuneCountInString(caption) > maxCaptionLength {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("The caption can't be longer than %d characters", maxCaptionLength))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Please choose a photo to upload")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+
+	name, err := store.Save(file)
+	switch {
+	case errors.Is(err, images.ErrTooLarge):
+		m.App.Session.Put(r.Context(), "error", "The photo is too large")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	case errors.Is(err, images.ErrUnsupportedType):
+		m.App.Session.Put(r.Context(), "error", "Please upload a JPEG, PNG or WebP photo")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	case err != nil:
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = m.DB.InsertBungalowImage(r.Context(), models.BungalowImage{
+		BungalowID: bungalow.ID,
+		FileName:   name,
+		Caption:    caption,
+	})
+	if err != nil {
+		m.deleteImageFiles(models.BungalowImage{FileName: name})
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Photo uploaded")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminPostBungalowImages saves the captions and the order of the images of a bungalow
+func (m *Repository) AdminPostBungalowImages(w http.ResponseWriter, r *http.Request) {
+	bungalow, ok := m.adminBungalow(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	imgs, err := m.DB.BungalowImages(r.Context(), bungalow.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/bungalows/%d", bungalow.ID)
+	form := forms.New(r.PostForm)
+
+	for i, img := range imgs {
+		imgs[i].Caption = form.Get(fmt.Sprintf("caption_%d", img.ID))
+		if utf8.RuneCountInString(imgs[i].Caption) > maxCaptionLength {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Captions can't be longer than %d characters", maxCaptionLength))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+
+		imgs[i].SortOrder, err = strconv.Atoi(form.Get(fmt.Sprintf("sort_order_%d", img.ID)))
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Please enter a number for the order of each photo")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+	}
+
+	err = m.DB.UpdateBungalowImages(r.Context(), bungalow.ID, imgs)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Photos saved")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminDeleteBungalowImage deletes an image of a bungalow and its files
+func (m *Repository) AdminDeleteBungalowImage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	img, err := m.DB.DeleteBungalowImage(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.deleteImageFiles(img)
+
+	m.App.Session.Put(r.Context(), "success", "Photo deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/bungalows/%d", img.BungalowID), http.StatusSeeOther)
+}
+
+// imageStore returns the store of the bungalow images as configured
+func (m *Repository) imageStore() *images.Store {
+	return &images.Store{
+		Dir:     m.App.Images.Dir,
+		MaxSize: int64(m.App.Images.MaxSize),
+	}
+}
+
+// deleteImageFiles removes the files of images which are no longer in the database. Failures are
+// only logged, the images are gone for the application anyway.
+func (m *Repository) deleteImageFiles(imgs ...models.BungalowImage) {
+	store := m.imageStore()
+	for _, img := range imgs {
+		err := store.Delete(img.FileName)
+		if err != nil {
+			m.App.ErrorLog.Println("can't delete image files:", err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// multipartBody returns a multipart form with a caption and, if content isn't nil, an image file
+func multipartBody(t *testing.T, content []byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	err := mw.WriteField("caption", "View from the terrace")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content != nil {
+		fw, err := mw.CreateFormFile("image", "terrace.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+	}
+
+	mw.Close()
+	return &body, mw.FormDataContentType()
+}
+
+func TestAdminPostUploadBungalowImage(t *testing.T) {
+	var png200 bytes.Buffer
+	err := png.Encode(&png200, image.NewRGBA(image.Rect(0, 0, 200, 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []struct {
+		name               string
+		id                 string
+		content            []byte
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"png", "2", png200.Bytes(), http.StatusSeeOther, "success"},
+		{"not-an-image", "2", []byte("just text"), http.StatusSeeOther, "error"},
+		{"too-large", "2", bytes.Repeat([]byte{0}, 2<<20), http.StatusSeeOther, "error"},
+		{"missing-file", "2", nil, http.StatusSeeOther, "error"},
+		{"unknown-bungalow", "99", png200.Bytes(), http.StatusNotFound, ""},
+	} {
+		body, contentType := multipartBody(t, e.content)
+		req, _ := http.NewRequest("POST", "/admin/bungalows/"+e.id+"/upload-image", body)
+		req.Header.Set("Content-Type", contentType)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostUploadBungalowImage).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedFlash != "" && session.PopString(ctx, e.expectedFlash) == "" {
+			t.Errorf("failed %s: expected a %s message", e.name, e.expectedFlash)
+		}
+	}
+
+	// the uploaded original and its variants are stored
+	originals, _ := filepath.Glob(filepath.Join(app.Images.Dir, "*.png"))
+	thumbs, _ := filepath.Glob(filepath.Join(app.Images.Dir, "thumb", "*.png.jpg"))
+	if len(originals) != 1 || len(thumbs) != 1 {
+		t.Errorf("expected one stored original with thumbnail, but got %d and %d", len(originals), len(thumbs))
+	}
+}
+
+func TestImage(t *testing.T) {
+	var content bytes.Buffer
+	err := png.Encode(&content, image.NewRGBA(image.Rect(0, 0, 1000, 500)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(app.Images.Dir, "couple-1.png"), content.Bytes(), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []struct {
+		variant, format, name string
+		expectedStatusCode    int
+		expectedContentType   string
+	}{
+		{"thumb", "", "couple-1.png", http.StatusOK, "image/jpeg"},
+		{"large", "", "couple-1.png", http.StatusOK, "image/jpeg"},
+		{"thumb", "webp", "couple-1.png", http.StatusOK, "image/webp"},
+		{"large", "jpeg", "couple-1.png", http.StatusOK, "image/jpeg"},
+		{"thumb", "gif", "couple-1.png", http.StatusNotFound, ""},
+		{"thumb", "", "couple-2.png", http.StatusNotFound, ""},
+		{"original", "", "couple-1.png", http.StatusNotFound, ""},
+	} {
+		req, _ := http.NewRequest("GET", "/images/"+e.variant+"/"+e.name, nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("variant", e.variant)
+		if e.format != "" {
+			rctx.URLParams.Add("format", e.format)
+		}
+		rctx.URLParams.Add("name", e.name)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.Image).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s/%s/%s: expected code %d, but got %d", e.variant, e.format, e.name, e.expectedStatusCode, rr.Code)
+		}
+		if rr.Code == http.StatusOK && rr.Header().Get("Content-Type") != e.expectedContentType {
+			t.Errorf("failed %s/%s/%s: expected %s, but got %s", e.variant, e.format, e.name, e.expectedContentType, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestAdminPostBungalowImages(t *testing.T) {
+	for _, e := range []struct {
+		name          string
+		postedData    url.Values
+		expectedFlash string
+	}{
+		{"valid", url.Values{"caption_21": {"Bedroom"}, "sort_order_21": {"2"}, "caption_22": {""}, "sort_order_22": {"1"}}, "success"},
+		{"invalid-order", url.Values{"caption_21": {"Bedroom"}, "sort_order_21": {"first"}, "sort_order_22": {"1"}}, "error"},
+		{"caption-too-long", url.Values{"caption_21": {strings.Repeat("a", 256)}, "sort_order_21": {"2"}, "sort_order_22": {"1"}}, "error"},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/bungalows/2/images", strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "2")
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostBungalowImages).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/bungalows/2" {
+			t.Errorf("failed %s: expected a redirect to the bungalow, but got %d %s", e.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if session.PopString(ctx, e.expectedFlash) == "" {
+			t.Errorf("failed %s: expected a %s message", e.name, e.expectedFlash)
+		}
+	}
+}
+
+func TestAdminDeleteBungalowImage(t *testing.T) {
+	for _, e := range []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"31", http.StatusSeeOther},
+		{"99", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/delete-bungalow-image/"+e.id, nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminDeleteBungalowImage).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.id, e.expectedStatusCode, rr.Code)
+		}
+		if rr.Code == http.StatusSeeOther && rr.Header().Get("Location") != "/admin/bungalows/3" {
+			t.Errorf("failed %s: expected a redirect to the bungalow, but got %s", e.id, rr.Header().Get("Location"))
+		}
+	}
+}
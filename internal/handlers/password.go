@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/ratelimit"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// passwordResetTTL is how long a link to reset a password can be used
+const passwordResetTTL = time.Hour
+
+// limits for requesting password reset links, per ip address and per e-mail address
+var passwordResetIPLimiter = ratelimit.New(10, time.Hour)
+
+var passwordResetEmailLimiter = ratelimit.New(3, time.Hour)
+
+// ShowForgotPassword shows the form to request a link for resetting the password
+func (m *Repository) ShowForgotPassword(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "forgot-password-page.tpml", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostForgotPassword sends a link to reset the password. The answer is the same whether
+// an account exists for the e-mail address or not, so nobody can find out who has an account.
+func (m *Repository) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		render.Template(w, r, "forgot-password-page.tpml", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	email := helpers.NormalizeEmail(r.Form.Get("email"))
+
+	if !passwordResetIPLimiter.Allow(helpers.ClientIP(r)) || !passwordResetEmailLimiter.Allow(email) {
+		m.App.InfoLog.Println("too many password reset requests from", helpers.ClientIP(r), "for", email)
+	} else {
+		m.sendPasswordReset(r, email)
+	}
+
+	m.App.Session.Put(r.Context(), "success", "If there is an account for this e-mail address, we have sent you a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// sendPasswordReset stores a new password reset token for the user with the e-mail address
+// and sends the link. Errors are only logged, the user mustn't learn about them.
+func (m *Repository) sendPasswordReset(r *http.Request, email string) {
+	user, err := m.DB.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !user.Active) {
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println("can't look up user for password reset:", err)
+		return
+	}
+
+	token, hash, err := helpers.NewToken()
+	if err != nil {
+		m.App.ErrorLog.Println("can't create password reset token:", err)
+		return
+	}
+
+	mailData := make(map[string]interface{})
+	mailData["user"] = user
+	mailData["link"] = fmt.Sprintf("%s/user/reset-password?token=%s", m.App.BaseURL, token)
+	mailData["valid_for"] = "1 hour"
+
+	msg, err := render.Mail(models.MailData{
+		To:       user.Email,
+		From:     m.App.Mail.From,
+		Subject:  "Reset your password",
+		Template: "password-reset",
+		Data:     mailData,
+	})
+	if err != nil {
+		m.App.ErrorLog.Println("can't render password reset e-mail:", err)
+		return
+	}
+
+	err = m.DB.InsertPasswordReset(r.Context(), user.ID, hash, time.Now().Add(passwordResetTTL), []models.MailData{msg})
+	if err != nil {
+		m.App.ErrorLog.Println("can't store password reset token:", err)
+	}
+}
+
+// ShowResetPassword shows the form to set a new password if the token from the link is valid
+func (m *Repository) ShowResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	_, err := m.DB.PasswordResetUserID(r.Context(), helpers.HashToken(token))
+	if errors.Is(err, repository.ErrInvalidToken) {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid or has expired, please request a new one.")
+		http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = token
+
+	render.Template(w, r, "reset-password-page.tpml", &models.TemplateData{
+		StringMap: stringMap,
+		Form:      forms.New(nil),
+	})
+}
+
+// PostResetPassword sets the new password and uses up the token
+func (m *Repository) PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token := r.Form.Get("token")
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "password_confirm")
+	form.MinLength("password", minPasswordLength)
+	if r.Form.Get("password") != r.Form.Get("password_confirm") {
+		form.Errors.Add("password_confirm", "The passwords don't match.")
+	}
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["token"] = token
+
+		render.Template(w, r, "reset-password-page.tpml", &models.TemplateData{
+			StringMap: stringMap,
+			Form:      form,
+		})
+		return
+	}
+
+	_, err = m.DB.ResetPassword(r.Context(), helpers.HashToken(token), r.Form.Get("password"))
+	if errors.Is(err, repository.ErrInvalidToken) {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid or has expired, please request a new one.")
+		http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Your password has been changed, please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// forgotPasswordTests is the data for the PostForgotPassword handler tests
+var forgotPasswordTests = []struct {
+	name               string
+	email              string
+	expectedStatusCode int
+	expectedHTML       string
+}{
+	{"existing-user", "patrick@bikini-bottom.ocean", http.StatusSeeOther, ""},
+	{"unknown-user", "plankton@chum-bucket.ocean", http.StatusSeeOther, ""},
+	{"inactive-user", "gary@bikini-bottom.ocean", http.StatusSeeOther, ""},
+	{"invalid-email", "patrick", http.StatusOK, `action="/user/forgot-password"`},
+}
+
+func TestPostForgotPassword(t *testing.T) {
+	var messages []string
+
+	for _, e := range forgotPasswordTests {
+		postedData := url.Values{}
+		postedData.Add("email", e.email)
+
+		req, _ := http.NewRequest("POST", "/user/forgot-password", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "10.0.0.1:1234"
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostForgotPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+
+		if e.expectedStatusCode == http.StatusSeeOther {
+			messages = append(messages, session.GetString(ctx, "success"))
+		}
+	}
+
+	// the answer must not tell whether an account exists
+	for _, msg := range messages {
+		if msg == "" || msg != messages[0] {
+			t.Errorf("expected the same message for all e-mail addresses, got %q and %q", messages[0], msg)
+		}
+	}
+}
+
+// resetPasswordTests is the data for the PostResetPassword handler tests
+var resetPasswordTests = []struct {
+	name               string
+	token              string
+	password           string
+	passwordConfirm    string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{"valid", "valid-token", "bubble-buddy", "bubble-buddy", http.StatusSeeOther, "/user/login"},
+	{"invalid-token", "used-token", "bubble-buddy", "bubble-buddy", http.StatusSeeOther, "/user/forgot-password"},
+	{"too-short", "valid-token", "bubble", "bubble", http.StatusOK, ""},
+	{"dont-match", "valid-token", "bubble-buddy", "bubble-bass", http.StatusOK, ""},
+}
+
+func TestPostResetPassword(t *testing.T) {
+	for _, e := range resetPasswordTests {
+		postedData := url.Values{}
+		postedData.Add("token", e.token)
+		postedData.Add("password", e.password)
+		postedData.Add("password_confirm", e.passwordConfirm)
+
+		req, _ := http.NewRequest("POST", "/user/reset-password", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostResetPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/pricing"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+)
+
+// seasonDateLayout is the format of the dates in the season form
+const seasonDateLayout = "2006-01-02"
+
+// AdminPrices shows the rates of all bungalows and their seasons
+func (m *Repository) AdminPrices(w http.ResponseWriter, r *http.Request) {
+	m.renderPrices(w, r, forms.New(nil))
+}
+
+// AdminPostPrices saves the rates of all bungalows. Prices are entered like 120.50, the
+// minimum stay in nights.
+func (m *Repository) AdminPostPrices(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	bungalows, err := m.DB.AllBungalows(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	for i, b := range bungalows {
+		bungalows[i].NightlyRate = priceField(form, fmt.Sprintf("nightly_rate_%d", b.ID))
+		bungalows[i].WeekendSurcharge = priceField(form, fmt.Sprintf("weekend_surcharge_%d", b.ID))
+		bungalows[i].CleaningFee = priceField(form, fmt.Sprintf("cleaning_fee_%d", b.ID))
+		bungalows[i].MinNights = nightsField(form, fmt.Sprintf("min_nights_%d", b.ID), 1)
+	}
+
+	if !form.Valid() {
+		m.renderPrices(w, r, form)
+		return
+	}
+
+	for _, b := range bungalows {
+		err = m.DB.UpdateBungalowRates(r.Context(), b)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Prices saved")
+	http.Redirect(w, r, "/admin/prices", http.StatusSeeOther)
+}
+
+// AdminPostSeasons adds a season to a bungalow. A season without rate only changes the minimum stay.
+func (m *Repository) AdminPostSeasons(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("season_name", "season_start", "season_end")
+
+	s := models.Season{
+		Name: form.Get("season_name"),
+	}
+
+	s.BungalowID, err = strconv.Atoi(form.Get("season_bungalow_id"))
+	if err != nil {
+		form.Errors.Add("season_bungalow_id", "Please choose a bungalow.")
+	} else {
+		_, err = m.DB.GetBungalowByID(r.Context(), s.BungalowID)
+		if errors.Is(err, sql.ErrNoRows) {
+			form.Errors.Add("season_bungalow_id", "Please choose a bungalow.")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if form.Has("season_start") && form.Has("season_end") {
+		s.StartDate, err = time.Parse(seasonDateLayout, form.Get("season_start"))
+		if err != nil {
+			form.Errors.Add("season_start", "Please enter a date like 2030-07-01.")
+		}
+		s.EndDate, err = time.Parse(seasonDateLayout, form.Get("season_end"))
+		if err != nil {
+			form.Errors.Add("season_end", "Please enter a date like 2030-08-31.")
+		} else if s.EndDate.Before(s.StartDate) {
+			form.Errors.Add("season_end", "The season can't end before it starts.")
+		}
+	}
+
+	if form.Has("season_rate") {
+		s.NightlyRate = priceField(form, "season_rate")
+	}
+	if form.Has("season_min_nights") {
+		s.MinNights = nightsField(form, "season_min_nights", 0)
+	}
+
+	if !form.Valid() {
+		m.renderPrices(w, r, form)
+		return
+	}
+
+	_, err = m.DB.InsertSeason(r.Context(), s)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", fmt.Sprintf("Season %s added", s.Name))
+	http.Redirect(w, r, "/admin/prices", http.StatusSeeOther)
+}
+
+// AdminDeleteSeason deletes a season, the bungalow's rates apply again for these dates
+func (m *Repository) AdminDeleteSeason(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteSeason(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Season deleted")
+	http.Redirect(w, r, "/admin/prices", http.StatusSeeOther)
+}
+
+// priceField returns the price in cents entered in a form field, or adds an error to the form
+func priceField(form *forms.Form, field string) int {
+	cents, err := pricing.ParsePrice(form.Get(field))
+	if err != nil {
+		form.Errors.Add(field, "Please enter a price like 120.50.")
+	}
+	return cents
+}
+
+// nightsField returns the number of nights entered in a form field, or adds an error to the form
+func nightsField(form *forms.Form, field string, min int) int {
+	n, err := strconv.Atoi(form.Get(field))
+	if err != nil || n < min {
+		form.Errors.Add(field, fmt.Sprintf("Please enter a number of at least %d.", min))
+	}
+	return n
+}
+
+// plainPrice formats cents for a form field, e.g. 120.50
+func plainPrice(cents int) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// renderPrices renders the prices page. Rates not posted with the form are filled in from the database.
+func (m *Repository) renderPrices(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	bungalows, err := m.DB.AllBungalows(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	seasons, err := m.DB.AllSeasons(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if form.Values == nil {
+		form.Values = url.Values{}
+	}
+
+	for _, b := range bungalows {
+		for field, value := range map[string]string{
+			"nightly_rate":      plainPrice(b.NightlyRate),
+			"weekend_surcharge": plainPrice(b.WeekendSurcharge),
+			"cleaning_fee":      plainPrice(b.CleaningFee),
+			"min_nights":        strconv.Itoa(b.MinNights),
+		} {
+			key := fmt.Sprintf("%s_%d", field, b.ID)
+			if _, ok := form.Values[key]; !ok {
+				form.Set(key, value)
+			}
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["bungalows"] = bungalows
+	data["seasons"] = seasons
+
+	render.Template(w, r, "admin-prices-page.tpml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+)
+
+func TestAdminPostPrices(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		url                string
+		handler            http.HandlerFunc
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"rates", "/admin/prices", Repo.AdminPostPrices,
+			url.Values{"nightly_rate_1": {"120.50"}, "weekend_surcharge_1": {"20"}, "cleaning_fee_1": {"45"}, "min_nights_1": {"2"}}, http.StatusSeeOther},
+		{"rates-invalid-price", "/admin/prices", Repo.AdminPostPrices,
+			url.Values{"nightly_rate_1": {"a lot"}, "weekend_surcharge_1": {"20"}, "cleaning_fee_1": {"45"}, "min_nights_1": {"2"}}, http.StatusOK},
+		{"rates-no-minimum-stay", "/admin/prices", Repo.AdminPostPrices,
+			url.Values{"nightly_rate_1": {"120"}, "weekend_surcharge_1": {"20"}, "cleaning_fee_1": {"45"}, "min_nights_1": {"0"}}, http.StatusOK},
+		{"season", "/admin/seasons", Repo.AdminPostSeasons,
+			url.Values{"season_bungalow_id": {"1"}, "season_name": {"Christmas"}, "season_start": {"2030-12-20"}, "season_end": {"2031-01-02"}, "season_rate": {"180"}}, http.StatusSeeOther},
+		{"season-minimum-stay-only", "/admin/seasons", Repo.AdminPostSeasons,
+			url.Values{"season_bungalow_id": {"1"}, "season_name": {"Easter"}, "season_start": {"2031-04-10"}, "season_end": {"2031-04-21"}, "season_min_nights": {"4"}}, http.StatusSeeOther},
+		{"season-ends-before-start", "/admin/seasons", Repo.AdminPostSeasons,
+			url.Values{"season_bungalow_id": {"1"}, "season_name": {"Christmas"}, "season_start": {"2030-12-20"}, "season_end": {"2030-12-01"}}, http.StatusOK},
+		{"season-unknown-bungalow", "/admin/seasons", Repo.AdminPostSeasons,
+			url.Values{"season_bungalow_id": {"4"}, "season_name": {"Christmas"}, "season_start": {"2030-12-20"}, "season_end": {"2031-01-02"}}, http.StatusOK},
+		{"season-missing-name", "/admin/seasons", Repo.AdminPostSeasons,
+			url.Values{"season_bungalow_id": {"1"}, "season_start": {"2030-12-20"}, "season_end": {"2031-01-02"}}, http.StatusOK},
+	} {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestAdminDeleteSeason(t *testing.T) {
+	for _, e := range []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusSeeOther},
+		{"99", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/delete-season/"+e.id, nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminDeleteSeason).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.id, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestMakeReservationQuote(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		bungalowID         int
+		start, end         time.Time
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"regular", 1, time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 14, 0, 0, 0, 0, time.UTC), http.StatusOK, ""},
+		{"minimum-stay-of-bungalow", 3, time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 11, 0, 0, 0, 0, time.UTC), http.StatusSeeOther, "/reservation"},
+		{"minimum-stay-of-season", 1, time.Date(2030, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, 7, 4, 0, 0, 0, 0, time.UTC), http.StatusSeeOther, "/reservation"},
+	} {
+		req, _ := http.NewRequest("GET", "/make-reservation", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		session.Put(ctx, "reservation", models.Reservation{BungalowID: e.bungalowID, StartDate: e.start, EndDate: e.end})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.MakeReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("failed %s: expected redirect to %s, but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+
+		// 4 nights from thursday: 4 * 100 + 2 * 20 weekend + 50 cleaning
+		if e.expectedStatusCode == http.StatusOK && !strings.Contains(rr.Body.String(), "€490.00") {
+			t.Errorf("failed %s: expected the total price on the page", e.name)
+		}
+		if e.expectedStatusCode == http.StatusOK && session.Get(ctx, "reservation").(models.Reservation).TotalPrice != 49000 {
+			t.Errorf("failed %s: expected the total price in the session", e.name)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+)
+
+// AdminSettings shows the application settings
+func (m *Repository) AdminSettings(w http.ResponseWriter, r *http.Request) {
+
+	required, err := m.twoFactorRequired(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guestNames, err := m.DB.GetSetting(r.Context(), models.SettingICalGuestNames)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	cancellationDays, err := m.DB.GetSetting(r.Context(), models.SettingCancellationDays)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if cancellationDays == "" {
+		cancellationDays = strconv.Itoa(defaultCancellationDays)
+	}
+
+	feeds, err := m.icalFeeds(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["require_2fa"] = required
+	data["ical_guest_names"] = guestNames == "true"
+	data["ical_feeds"] = feeds
+
+	// a new calendar link is shown only once, right after it has been created
+	stringMap := make(map[string]string)
+	stringMap["ical_link"] = m.App.Session.PopString(r.Context(), "ical_link")
+	stringMap["cancellation_days"] = cancellationDays
+
+	render.Template(w, r, "admin-settings-page.tpml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminPostSettings saves the application settings
+func (m *Repository) AdminPostSettings(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	days, err := strconv.Atoi(strings.TrimSpace(r.Form.Get(models.SettingCancellationDays)))
+	if err != nil || days < 0 {
+		m.App.Session.Put(r.Context(), "error", "Please enter the number of days before arrival until which guests can cancel")
+		http.Redirect(w, r, "/admin/settings", http.StatusSeeOther)
+		return
+	}
+
+	for _, name := range []string{models.SettingRequire2FA, models.SettingICalGuestNames} {
+		err = m.DB.SetSetting(r.Context(), name, strconv.FormatBool(r.Form.Get(name) == "1"))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	err = m.DB.SetSetting(r.Context(), models.SettingCancellationDays, strconv.Itoa(days))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Settings saved")
+	http.Redirect(w, r, "/admin/settings", http.StatusSeeOther)
+}
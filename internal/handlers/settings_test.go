@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAdminPostSettings(t *testing.T) {
+	for _, e := range []struct {
+		name          string
+		postedData    url.Values
+		expectedFlash string
+	}{
+		{"valid", url.Values{"require_2fa": {"1"}, "cancellation_days": {"14"}}, "success"},
+		{"invalid-cancellation-days", url.Values{"require_2fa": {"1"}, "cancellation_days": {"-1"}}, "error"},
+		{"missing-cancellation-days", url.Values{"require_2fa": {"1"}}, "error"},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/settings", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostSettings)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected code %d, got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if session.PopString(ctx, e.expectedFlash) == "" {
+			t.Errorf("failed %s: expected a %s message", e.name, e.expectedFlash)
+		}
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	texttemplate "text/template"
 
 	"net/http"
 	"time"
@@ -18,19 +20,24 @@ import (
 	"github.com/jagottsicher/myGoWebApplication/internal/config"
 	"github.com/justinas/nosurf"
 
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/pricing"
 	"github.com/jagottsicher/myGoWebApplication/internal/render"
 )
 
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
+var pathToMailTemplates = "./../../static/email/templates"
 
 var functions = template.FuncMap{
 	"humanReadableDate": render.HumanReadableDate,
 	"formatDate":        render.FormatDate,
 	"iterate":           render.Iterate,
 	"add":               render.Add,
+	"formatPrice":       pricing.FormatPrice,
+	"paragraphs":        render.Paragraphs,
 }
 
 func TestMain(m *testing.M) {
@@ -71,17 +78,33 @@ func TestMain(m *testing.M) {
 	app.TemplateCache = tc
 	app.UseCache = true
 
+	mtc, mttc, err := CreateTestMailTemplateCache()
+	if err != nil {
+		log.Fatal("cannot create e-mail template cache")
+	}
+
+	app.MailTemplateCache = mtc
+	app.MailTextTemplateCache = mttc
+
+	imageDir, err := os.MkdirTemp("", "images")
+	if err != nil {
+		log.Fatal("cannot create image directory")
+	}
+	app.Images = config.ImagesConfig{Dir: imageDir, MaxSize: 1 << 20}
+
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
-	os.Exit(m.Run())
+	code := m.Run()
+	os.RemoveAll(imageDir)
+	os.Exit(code)
 }
 
 func listenForMail() {
 	go func() {
-		for {
-			_ = <-app.MailChan
+		for range app.MailChan {
 		}
 	}()
 }
@@ -96,9 +119,11 @@ func getRoutes() http.Handler {
 	mux.Get("/", Repo.Home)
 	mux.Get("/about", Repo.About)
 	mux.Get("/contact", Repo.Contact)
-	mux.Get("/eremite", Repo.Eremite)
-	mux.Get("/couple", Repo.Couple)
-	mux.Get("/family", Repo.Family)
+	mux.Get("/bungalows", Repo.Bungalows)
+	mux.Get("/bungalows/{slug}", Repo.Bungalow)
+	mux.Get("/eremite", Repo.BungalowRedirect)
+	mux.Get("/couple", Repo.BungalowRedirect)
+	mux.Get("/family", Repo.BungalowRedirect)
 	mux.Get("/reservation", Repo.Reservation)
 	mux.Post("/reservation", Repo.PostReservation)
 	mux.Post("/reservation-json", Repo.ReservationJSON)
@@ -107,9 +132,36 @@ func getRoutes() http.Handler {
 	mux.Get("/make-reservation", Repo.MakeReservation)
 	mux.Post("/make-reservation", Repo.PostMakeReservation)
 	mux.Get("/reservation-overview", Repo.ReservationOverview)
+	mux.Get("/my-reservation", Repo.GuestReservation)
+	mux.Post("/my-reservation/change", Repo.PostGuestChangeReservation)
+	mux.Post("/my-reservation/cancel", Repo.PostGuestCancelReservation)
 	mux.Get("/user/login", Repo.ShowLogin)
 	mux.Post("/user/login", Repo.PostShowLogin)
 	mux.Get("/user/logout", Repo.Logout)
+	mux.Get("/user/forgot-password", Repo.ShowForgotPassword)
+	mux.Post("/user/forgot-password", Repo.PostForgotPassword)
+	mux.Get("/user/reset-password", Repo.ShowResetPassword)
+	mux.Post("/user/reset-password", Repo.PostResetPassword)
+	mux.Get("/user/2fa", Repo.ShowTwoFactor)
+	mux.Post("/user/2fa", Repo.PostTwoFactor)
+
+	mux.Get("/ical/{bungalowID}.ics", Repo.ICalFeed)
+	mux.Get("/images/{variant}/{name}", Repo.Image)
+	mux.Get("/images/{variant}/{format}/{name}", Repo.Image)
+
+	mux.Get("/api/openapi.json", Repo.APISpec)
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.NotFound(Repo.APINotFound)
+		mux.MethodNotAllowed(Repo.APIMethodNotAllowed)
+		mux.Get("/bungalows", Repo.APIBungalows)
+		mux.Get("/bungalows/{id}", Repo.APIBungalow)
+		mux.Get("/availability", Repo.APIAvailability)
+		mux.Post("/reservations", Repo.APICreateReservation)
+		mux.Get("/reservations", Repo.APIReservations)
+		mux.Get("/reservations/{id}", Repo.APIReservation)
+		mux.Patch("/reservations/{id}", Repo.APIUpdateReservation)
+		mux.Delete("/reservations/{id}", Repo.APIDeleteReservation)
+	})
 
 	mux.Get("/admin/dashboard", Repo.AdminDashboard)
 	mux.Get("/admin/reservations-new", Repo.AdminNewReservations)
@@ -118,8 +170,32 @@ func getRoutes() http.Handler {
 	mux.Post("/admin/reservations-calendar", Repo.AdminPostReservationsCalendar)
 	mux.Get("/admin/reservations/{src}/{id}/show", Repo.AdminShowReservation)
 	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminPostShowReservation)
-	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
+	mux.Post("/admin/reservations/{src}/{id}/status", Repo.AdminPostReservationStatus)
 	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
+	mux.Get("/admin/mails-failed", Repo.AdminFailedMails)
+	mux.Post("/admin/resend-mail/{id}", Repo.AdminResendMail)
+	mux.Get("/admin/users", Repo.AdminUsers)
+	mux.Get("/admin/users/new", Repo.AdminShowUser)
+	mux.Get("/admin/users/{id}", Repo.AdminShowUser)
+	mux.Post("/admin/delete-user/{id}", Repo.AdminDeleteUser)
+	mux.Get("/admin/failed-logins", Repo.AdminFailedLogins)
+	mux.Post("/admin/unlock-account", Repo.AdminUnlockAccount)
+	mux.Get("/admin/2fa", Repo.AdminTwoFactor)
+	mux.Post("/admin/reset-2fa", Repo.AdminResetTwoFactor)
+	mux.Get("/admin/settings", Repo.AdminSettings)
+	mux.Post("/admin/ical-token/{id}", Repo.AdminNewICalToken)
+	mux.Get("/admin/api-tokens", Repo.AdminAPITokens)
+	mux.Post("/admin/revoke-api-token/{id}", Repo.AdminRevokeAPIToken)
+	mux.Get("/admin/calendar-imports", Repo.AdminCalendarImports)
+	mux.Post("/admin/sync-calendar-import/{id}", Repo.AdminSyncCalendarImport)
+	mux.Post("/admin/delete-calendar-import/{id}", Repo.AdminDeleteCalendarImport)
+	mux.Get("/admin/prices", Repo.AdminPrices)
+	mux.Post("/admin/delete-season/{id}", Repo.AdminDeleteSeason)
+	mux.Get("/admin/bungalows", Repo.AdminBungalows)
+	mux.Get("/admin/bungalows/new", Repo.AdminShowBungalow)
+	mux.Get("/admin/bungalows/{id}", Repo.AdminShowBungalow)
+	mux.Post("/admin/delete-bungalow/{id}", Repo.AdminDeleteBungalow)
+	mux.Post("/admin/delete-bungalow-image/{id}", Repo.AdminDeleteBungalowImage)
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
@@ -180,3 +256,41 @@ func CreateTestTemplateCache() (map[string]*template.Template, error) {
 	}
 	return theCache, nil
 }
+
+// CreateTestMailTemplateCache creates the caches for html and plain text e-mail templates.
+func CreateTestMailTemplateCache() (map[string]*template.Template, map[string]*texttemplate.Template, error) {
+	htmlCache := map[string]*template.Template{}
+	textCache := map[string]*texttemplate.Template{}
+
+	// get all available files *-mail.html from folder ./static/email/templates
+	mails, err := filepath.Glob(fmt.Sprintf("%s/*-mail.html", pathToMailTemplates))
+	if err != nil {
+		return htmlCache, textCache, err
+	}
+
+	for _, mail := range mails {
+		name := strings.TrimSuffix(filepath.Base(mail), "-mail.html")
+		ts, err := template.New(name).Funcs(functions).ParseFiles(fmt.Sprintf("%s/basic.html", pathToMailTemplates), mail)
+		if err != nil {
+			return htmlCache, textCache, err
+		}
+		htmlCache[name] = ts.Lookup(filepath.Base(mail))
+	}
+
+	// get all available files *-mail.txt from folder ./static/email/templates
+	mails, err = filepath.Glob(fmt.Sprintf("%s/*-mail.txt", pathToMailTemplates))
+	if err != nil {
+		return htmlCache, textCache, err
+	}
+
+	for _, mail := range mails {
+		name := strings.TrimSuffix(filepath.Base(mail), "-mail.txt")
+		ts, err := texttemplate.New(name).Funcs(texttemplate.FuncMap(functions)).ParseFiles(fmt.Sprintf("%s/basic.txt", pathToMailTemplates), mail)
+		if err != nil {
+			return htmlCache, textCache, err
+		}
+		textCache[name] = ts.Lookup(filepath.Base(mail))
+	}
+
+	return htmlCache, textCache, nil
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// maxReasonLength is the longest reason of a status change, in characters
+const maxReasonLength = 255
+
+// statusMailSubjects holds the subject of the e-mail to the guest for each status the guest is told about
+var statusMailSubjects = map[models.ReservationStatus]string{
+	models.ReservationConfirmed: "Your reservation has been confirmed",
+	models.ReservationCancelled: "Your reservation has been cancelled",
+}
+
+// AdminPostReservationStatus changes the status of a reservation with the reason given in the form
+func (m *Repository) AdminPostReservationStatus(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/reservations/%s/%d/show?y=%s&m=%s", src, id, r.Form.Get("year"), r.Form.Get("month"))
+
+	status := models.ReservationStatus(r.Form.Get("status"))
+	reason := r.Form.Get("reason")
+
+	if !res.Status.CanBecome(status) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("A reservation which is %s can't become %s", res.Status.Name(), status.Name()))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if utf8.RuneCountInString(reason) > maxReasonLength {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("The reason can't be longer than %d characters", maxReasonLength))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	mails, err := m.statusMails(res, status)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.ChangeReservationStatus(r.Context(), models.ReservationStatusChange{
+		ReservationID: res.ID,
+		ToStatus:      status,
+		UserID:        m.App.Session.GetInt(r.Context(), "user_id"),
+		Reason:        reason,
+	}, mails)
+	if errors.Is(err, repository.ErrInvalidStatusChange) {
+		// somebody else changed the status in the meantime
+		m.App.Session.Put(r.Context(), "error", "The status of the reservation has just been changed, please try again")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", fmt.Sprintf("Reservation is now %s", status.Name()))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// statusMails renders the e-mail to the guest about the new status of a reservation. Only
+// confirmations and cancellations are sent, for other states there are no e-mails.
+func (m *Repository) statusMails(res models.Reservation, status models.ReservationStatus) ([]models.MailData, error) {
+	subject, ok := statusMailSubjects[status]
+	if !ok {
+		return nil, nil
+	}
+
+	mailData := make(map[string]interface{})
+	mailData["reservation"] = res
+
+	msg, err := render.Mail(models.MailData{
+		To:       res.Email,
+		From:     m.App.Mail.From,
+		Subject:  subject,
+		Template: fmt.Sprintf("reservation-%s-guest", status),
+		Data:     mailData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.MailData{msg}, nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+)
+
+func TestAdminPostReservationStatus(t *testing.T) {
+	for _, e := range []struct {
+		name               string
+		id                 string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"confirm", "1", url.Values{"status": {"confirmed"}, "reason": {"Deposit paid"}}, http.StatusSeeOther, "success"},
+		{"cancel", "1", url.Values{"status": {"cancelled"}}, http.StatusSeeOther, "success"},
+		{"check-in", "2", url.Values{"status": {"checked-in"}}, http.StatusSeeOther, "success"},
+		{"no-show", "2", url.Values{"status": {"no-show"}}, http.StatusSeeOther, "success"},
+		{"skip-confirmation", "1", url.Values{"status": {"checked-in"}}, http.StatusSeeOther, "error"},
+		{"after-check-out", "3", url.Values{"status": {"cancelled"}}, http.StatusSeeOther, "error"},
+		{"after-cancellation", "4", url.Values{"status": {"confirmed"}}, http.StatusSeeOther, "error"},
+		{"unknown-status", "1", url.Values{"status": {"paid"}}, http.StatusSeeOther, "error"},
+		{"reason-too-long", "1", url.Values{"status": {"confirmed"}, "reason": {strings.Repeat("x", maxReasonLength+1)}}, http.StatusSeeOther, "error"},
+		{"not-found", "99", url.Values{"status": {"confirmed"}}, http.StatusNotFound, ""},
+		{"invalid-id", "x", url.Values{"status": {"confirmed"}}, http.StatusBadRequest, ""},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/"+e.id+"/status", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostReservationStatus).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+		if e.expectedFlash != "" && session.PopString(ctx, e.expectedFlash) == "" {
+			t.Errorf("failed %s: expected a %s message", e.name, e.expectedFlash)
+		}
+	}
+}
+
+func TestReservationStatusTransitions(t *testing.T) {
+	for _, e := range []struct {
+		from, to models.ReservationStatus
+		allowed  bool
+	}{
+		{models.ReservationRequested, models.ReservationConfirmed, true},
+		{models.ReservationRequested, models.ReservationCancelled, true},
+		{models.ReservationRequested, models.ReservationCheckedIn, false},
+		{models.ReservationConfirmed, models.ReservationCheckedIn, true},
+		{models.ReservationConfirmed, models.ReservationNoShow, true},
+		{models.ReservationCheckedIn, models.ReservationCheckedOut, true},
+		{models.ReservationCheckedIn, models.ReservationCancelled, false},
+		{models.ReservationCheckedOut, models.ReservationCheckedIn, false},
+		{models.ReservationCancelled, models.ReservationConfirmed, false},
+		{models.ReservationNoShow, models.ReservationConfirmed, false},
+		{models.ReservationConfirmed, "paid", false},
+	} {
+		if got := e.from.CanBecome(e.to); got != e.allowed {
+			t.Errorf("%s to %s: expected %t, but got %t", e.from, e.to, e.allowed, got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+)
+
+// apiTokenPrefix marks api tokens, so they can be recognised e.g. by secret scanners
+const apiTokenPrefix = "bbt_"
+
+// AdminAPITokens lists the api tokens of the logged in user with a form to create a new one
+func (m *Repository) AdminAPITokens(w http.ResponseWriter, r *http.Request) {
+	m.renderAPITokens(w, r, forms.New(nil))
+}
+
+// AdminPostAPITokens creates an api token for the logged in user, the token is shown only once
+func (m *Repository) AdminPostAPITokens(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	scope := r.Form.Get("scope")
+	if scope != models.ScopeRead && scope != models.ScopeWrite {
+		form.Errors.Add("scope", "Please choose a scope.")
+	}
+
+	if !form.Valid() {
+		m.renderAPITokens(w, r, form)
+		return
+	}
+
+	token, _, err := helpers.NewToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	token = apiTokenPrefix + token
+
+	_, err = m.DB.InsertAPIToken(r.Context(), models.APIToken{
+		UserID: m.App.Session.GetInt(r.Context(), "user_id"),
+		Name:   r.Form.Get("name"),
+		Scope:  scope,
+	}, helpers.HashToken(token))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "api_token", token)
+	m.App.Session.Put(r.Context(), "success", "Token created, please copy it now")
+	http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+}
+
+// AdminRevokeAPIToken deletes an api token of the logged in user
+func (m *Repository) AdminRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteAPIToken(r.Context(), id, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Token revoked")
+	http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+}
+
+// renderAPITokens renders the api tokens page
+func (m *Repository) renderAPITokens(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	tokens, err := m.DB.APITokens(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["tokens"] = tokens
+
+	// a new token is shown only once, right after it has been created
+	stringMap := make(map[string]string)
+	stringMap["new_token"] = m.App.Session.PopString(r.Context(), "api_token")
+
+	render.Template(w, r, "admin-api-tokens-page.tpml", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      form,
+	})
+}
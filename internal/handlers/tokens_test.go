@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// adminPostAPITokensTests is the data for the AdminPostAPITokens handler tests
+var adminPostAPITokensTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+}{
+	{"valid", url.Values{"name": {"channel manager"}, "scope": {"write"}}, http.StatusSeeOther},
+	{"missing-name", url.Values{"scope": {"read"}}, http.StatusOK},
+	{"invalid-scope", url.Values{"name": {"channel manager"}, "scope": {"admin"}}, http.StatusOK},
+}
+
+func TestAdminPostAPITokens(t *testing.T) {
+	for _, e := range adminPostAPITokensTests {
+		req, _ := http.NewRequest("POST", "/admin/api-tokens", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		session.Put(ctx, "user_id", 1)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostAPITokens)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		token := session.GetString(ctx, "api_token")
+		if e.expectedStatusCode == http.StatusSeeOther && !strings.HasPrefix(token, apiTokenPrefix) {
+			t.Errorf("failed %s: expected new token in session, got %q", e.name, token)
+		}
+	}
+}
+
+func TestAdminRevokeAPIToken(t *testing.T) {
+	for _, e := range []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusSeeOther},
+		{"x", http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest("POST", "/admin/revoke-api-token/"+e.id, nil)
+		ctx := getCtx(req)
+		session.Put(ctx, "user_id", 1)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminRevokeAPIToken)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed id %s: expected code %d, but got %d", e.id, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/loginguard"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+	"github.com/jagottsicher/myGoWebApplication/internal/totp"
+)
+
+// twoFactorTTL is how long the second step of a login can be completed after the password was checked
+const twoFactorTTL = 5 * time.Minute
+
+// twoFactorIssuer is the name shown for the account in authenticator apps
+const twoFactorIssuer = "Bungalow Bliss"
+
+// recoveryCodeCount is the number of recovery codes a user gets
+const recoveryCodeCount = 10
+
+// twoFactorRequired reports whether all users have to use two-factor authentication
+func (m *Repository) twoFactorRequired(r *http.Request) (bool, error) {
+	value, err := m.DB.GetSetting(r.Context(), models.SettingRequire2FA)
+	if err != nil {
+		return false, err
+	}
+
+	return value == "true", nil
+}
+
+// ShowTwoFactor shows the form for the second step of a login
+func (m *Repository) ShowTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if !m.App.Session.Exists(r.Context(), "totp_user_id") {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	render.Template(w, r, "two-factor-page.tpml", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostTwoFactor checks the code of an authenticator app or a recovery code and completes the login
+func (m *Repository) PostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id := m.App.Session.GetInt(r.Context(), "totp_user_id")
+	expires := m.App.Session.GetInt64(r.Context(), "totp_expires")
+	if id == 0 || time.Now().Unix() > expires {
+		m.App.Session.Remove(r.Context(), "totp_user_id")
+		m.App.Session.Remove(r.Context(), "totp_expires")
+		m.App.Session.Put(r.Context(), "error", "Please log in again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	account := helpers.NormalizeEmail(user.Email)
+	ip := helpers.ClientIP(r)
+
+	// like the password, every code is recorded as failed login before it is checked
+	attemptID, stats, err := m.DB.RecordLoginAttempt(r.Context(), account, ip, loginguard.Default.Since(time.Now()))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if wait := loginguard.Default.RetryAfter(stats, time.Now()); wait > 0 {
+		m.deleteLoginAttempt(r, attemptID)
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Too many failed logins, please try again in %s", humanDuration(wait)))
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return
+	}
+
+	code := strings.ReplaceAll(r.Form.Get("code"), " ", "")
+
+	var ok, recovery bool
+	if len(code) == totp.Digits {
+		ok, err = m.checkTOTP(r, user, code)
+	} else {
+		recovery = true
+		ok, err = m.DB.UseRecoveryCode(r.Context(), user.ID, helpers.HashToken(totp.NormalizeRecoveryCode(code)))
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Invalid code")
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return
+	}
+
+	m.deleteLoginAttempt(r, attemptID)
+
+	err = m.DB.ClearFailedLogins(r.Context(), account)
+	if err != nil {
+		m.App.ErrorLog.Println("can't clear failed logins:", err)
+	}
+
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Remove(r.Context(), "totp_user_id")
+	m.App.Session.Remove(r.Context(), "totp_expires")
+	m.App.Session.Put(r.Context(), "user_id", user.ID)
+	m.App.Session.Put(r.Context(), "user_role", user.Role)
+
+	if recovery {
+		m.App.Session.Put(r.Context(), "warning", "You used a recovery code, please create new ones if you run out of them")
+		http.Redirect(w, r, "/admin/2fa", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Successfully logged in")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// checkTOTP validates a code of the user's authenticator app, each code can only be used once
+func (m *Repository) checkTOTP(r *http.Request, user models.User, code string) (bool, error) {
+	counter, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return m.DB.UseTOTPCounter(r.Context(), user.ID, counter)
+}
+
+// newRecoveryCodes returns new recovery codes and their hashes for storing them
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := totp.RecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = helpers.HashToken(totp.NormalizeRecoveryCode(c))
+	}
+
+	return codes, hashes, nil
+}
+
+// AdminTwoFactor shows the two-factor settings of the logged in user, with a qr code for enrolment
+func (m *Repository) AdminTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	user, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	required, err := m.twoFactorRequired(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["enabled"] = user.TOTPEnabled
+	data["required"] = required
+
+	// recovery codes are shown only once, right after they have been created
+	if codes := m.App.Session.PopString(r.Context(), "recovery_codes"); codes != "" {
+		data["recovery_codes"] = strings.Split(codes, "\n")
+	}
+
+	if !user.TOTPEnabled {
+		// the secret is kept in the session until the first code has been confirmed
+		secret := m.App.Session.GetString(r.Context(), "totp_pending_secret")
+		if secret == "" {
+			secret, err = totp.GenerateSecret()
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			m.App.Session.Put(r.Context(), "totp_pending_secret", secret)
+		}
+
+		data["secret"] = secret
+		data["uri"] = totp.ProvisioningURI(twoFactorIssuer, user.Email, secret)
+	}
+
+	render.Template(w, r, "admin-two-factor-page.tpml", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostTwoFactor enables or disables two-factor authentication for the logged in user,
+// or replaces the recovery codes. Every action has to be confirmed with a current code.
+func (m *Repository) AdminPostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	action := r.Form.Get("action")
+	code := strings.ReplaceAll(r.Form.Get("code"), " ", "")
+
+	if action == "enable" && !user.TOTPEnabled {
+		user.TOTPSecret = m.App.Session.GetString(r.Context(), "totp_pending_secret")
+		if user.TOTPSecret == "" {
+			http.Redirect(w, r, "/admin/2fa", http.StatusSeeOther)
+			return
+		}
+	} else if !user.TOTPEnabled {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	ok, err := m.checkTOTP(r, user, code)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Invalid code, please try again")
+		http.Redirect(w, r, "/admin/2fa", http.StatusSeeOther)
+		return
+	}
+
+	var audit string
+
+	switch action {
+	case "enable", "recovery-codes":
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if action == "enable" {
+			err = m.DB.EnableTOTP(r.Context(), user.ID, user.TOTPSecret, hashes)
+			audit = "2fa-enable"
+			m.App.Session.Remove(r.Context(), "totp_pending_secret")
+			m.App.Session.Remove(r.Context(), "totp_setup_required")
+		} else {
+			err = m.DB.ReplaceRecoveryCodes(r.Context(), user.ID, hashes)
+			audit = "2fa-recovery-codes"
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "recovery_codes", strings.Join(codes, "\n"))
+		m.App.Session.Put(r.Context(), "success", "Please store your recovery codes in a safe place")
+
+	case "disable":
+		required, err := m.twoFactorRequired(r)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if required {
+			m.App.Session.Put(r.Context(), "error", "Two-factor authentication is required for all users")
+			http.Redirect(w, r, "/admin/2fa", http.StatusSeeOther)
+			return
+		}
+
+		err = m.DB.DisableTOTP(r.Context(), user.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		audit = "2fa-disable"
+		m.App.Session.Put(r.Context(), "success", "Two-factor authentication has been turned off")
+
+	default:
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.InsertUserAudit(r.Context(), models.UserAudit{ActorID: user.ID, UserID: user.ID, Action: audit})
+	if err != nil {
+		m.App.ErrorLog.Println("can't write user audit log:", err)
+	}
+
+	http.Redirect(w, r, "/admin/2fa", http.StatusSeeOther)
+}
+
+// AdminResetTwoFactor turns off two-factor authentication for a user who lost their device and recovery codes
+func (m *Repository) AdminResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(r.Form.Get("id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = m.DB.GetUserByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DisableTOTP(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.InsertUserAudit(r.Context(), models.UserAudit{
+		ActorID: m.App.Session.GetInt(r.Context(), "user_id"),
+		UserID:  id,
+		Action:  "2fa-reset",
+	})
+	if err != nil {
+		m.App.ErrorLog.Println("can't write user audit log:", err)
+	}
+
+	m.App.Session.Put(r.Context(), "success", "Two-factor authentication has been reset")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", id), http.StatusSeeOther)
+}
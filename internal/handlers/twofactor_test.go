@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
+	"github.com/jagottsicher/myGoWebApplication/internal/totp"
+)
+
+func TestLoginTwoFactor(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("email", "squidward@bikini-bottom.ocean")
+	postedData.Add("password", "password")
+
+	req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostShowLogin)
+	handler.ServeHTTP(rr, req)
+
+	if location := rr.Header().Get("Location"); location != "/user/2fa" {
+		t.Errorf("expected location /user/2fa, got %q", location)
+	}
+	if session.GetInt(ctx, "totp_user_id") != 2 {
+		t.Errorf("expected pending two-factor login of user 2, got %d", session.GetInt(ctx, "totp_user_id"))
+	}
+	if session.Exists(ctx, "user_id") {
+		t.Error("expected no user_id in session before the second step")
+	}
+}
+
+// twoFactorTests is the data for the PostTwoFactor handler tests
+var twoFactorTests = []struct {
+	name             string
+	code             string
+	expires          time.Duration
+	expectedLocation string
+	expectedUserID   int
+}{
+	{"valid-code", "current", time.Minute, "/", 2},
+	{"recovery-code", "AAAAA-bbbbb", time.Minute, "/admin/2fa", 2},
+	{"invalid-code", "00000x", time.Minute, "/user/2fa", 0},
+	{"invalid-recovery-code", "ccccc-ddddd", time.Minute, "/user/2fa", 0},
+	{"expired", "current", -time.Minute, "/user/login", 0},
+}
+
+func TestPostTwoFactor(t *testing.T) {
+	for _, e := range twoFactorTests {
+		code := e.code
+		if code == "current" {
+			code, _ = totp.Code(dbrepo.TestTOTPSecret, totp.Counter(time.Now()))
+		}
+
+		postedData := url.Values{}
+		postedData.Add("code", code)
+
+		req, _ := http.NewRequest("POST", "/user/2fa", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		session.Put(ctx, "totp_user_id", 2)
+		session.Put(ctx, "totp_expires", time.Now().Add(e.expires).Unix())
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostTwoFactor)
+		handler.ServeHTTP(rr, req)
+
+		if location := rr.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, got %q", e.name, e.expectedLocation, location)
+		}
+		if id := session.GetInt(ctx, "user_id"); id != e.expectedUserID {
+			t.Errorf("failed %s: expected user_id %d in session, got %d", e.name, e.expectedUserID, id)
+		}
+	}
+}
+
+func TestAdminPostTwoFactor(t *testing.T) {
+	secret, _ := totp.GenerateSecret()
+
+	// case #1: enrolment with the pending secret
+	code, _ := totp.Code(secret, totp.Counter(time.Now()))
+	postedData := url.Values{"action": {"enable"}, "code": {code}}
+
+	req, _ := http.NewRequest("POST", "/admin/2fa", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	session.Put(ctx, "user_id", 1)
+	session.Put(ctx, "totp_pending_secret", secret)
+	session.Put(ctx, "totp_setup_required", true)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AdminPostTwoFactor)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("failed enable: expected code %d, got %d", http.StatusSeeOther, rr.Code)
+	}
+	if codes := strings.Split(session.GetString(ctx, "recovery_codes"), "\n"); len(codes) != 10 {
+		t.Errorf("failed enable: expected 10 recovery codes, got %d", len(codes))
+	}
+	if session.Exists(ctx, "totp_pending_secret") || session.Exists(ctx, "totp_setup_required") {
+		t.Error("failed enable: expected pending secret and setup requirement to be removed")
+	}
+
+	// case #2: wrong code
+	postedData = url.Values{"action": {"enable"}, "code": {"00000x"}}
+
+	req, _ = http.NewRequest("POST", "/admin/2fa", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	session.Put(ctx, "user_id", 1)
+	session.Put(ctx, "totp_pending_secret", secret)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if session.GetString(ctx, "error") == "" || session.Exists(ctx, "recovery_codes") {
+		t.Error("failed wrong code: expected an error and no recovery codes")
+	}
+
+	// case #3: disabling of an enrolled user
+	code, _ = totp.Code(dbrepo.TestTOTPSecret, totp.Counter(time.Now()))
+	postedData = url.Values{"action": {"disable"}, "code": {code}}
+
+	req, _ = http.NewRequest("POST", "/admin/2fa", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	session.Put(ctx, "user_id", 2)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if session.GetString(ctx, "success") == "" {
+		t.Errorf("failed disable: expected success, got error %q", session.GetString(ctx, "error"))
+	}
+}
+
+func TestAdminResetTwoFactor(t *testing.T) {
+	for _, e := range []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"2", http.StatusSeeOther},
+		{"99", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	} {
+		postedData := url.Values{"id": {e.id}}
+
+		req, _ := http.NewRequest("POST", "/admin/reset-2fa", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		session.Put(ctx, "user_id", 1)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminResetTwoFactor)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed id %s: expected code %d, but got %d", e.id, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
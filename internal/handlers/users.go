@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jagottsicher/myGoWebApplication/internal/forms"
+	"github.com/jagottsicher/myGoWebApplication/internal/helpers"
+	"github.com/jagottsicher/myGoWebApplication/internal/loginguard"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/render"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// minPasswordLength is the minimum length of user passwords
+const minPasswordLength = 8
+
+// AdminUsers lists all users in the admin area
+func (m *Repository) AdminUsers(w http.ResponseWriter, r *http.Request) {
+
+	users, err := m.DB.AllUsers(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["users"] = users
+	data["role_names"] = models.RoleNames
+
+	render.Template(w, r, "admin-users-page.tpml", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowUser shows the form to edit a user, or to create a new one if there is no id
+func (m *Repository) AdminShowUser(w http.ResponseWriter, r *http.Request) {
+
+	user := models.User{Role: models.RoleStaff, Active: true}
+	var auditLog []models.UserAudit
+
+	if chi.URLParam(r, "id") != "" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		user, err = m.DB.GetUserByID(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		auditLog, err = m.DB.UserAuditLog(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderUserForm(w, r, user, auditLog, forms.New(nil))
+}
+
+// AdminPostShowUser creates a new user or updates an existing one, including role, status and password
+func (m *Repository) AdminPostShowUser(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	actorID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	var old models.User
+	isNew := chi.URLParam(r, "id") == ""
+
+	if !isNew {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		old, err = m.DB.GetUserByID(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	user := old
+	user.FullName = r.Form.Get("full_name")
+	user.Email = helpers.NormalizeEmail(r.Form.Get("email"))
+	user.Role, _ = strconv.Atoi(r.Form.Get("role"))
+	user.Active = r.Form.Get("active") == "1"
+
+	password := r.Form.Get("password")
+
+	form := forms.New(r.PostForm)
+	form.Required("full_name", "email")
+	form.IsEmail("email")
+
+	if !models.ValidRole(user.Role) {
+		form.Errors.Add("role", "Please choose a role.")
+	}
+
+	if isNew {
+		form.Required("password")
+	}
+	if password != "" {
+		form.MinLength("password", minPasswordLength)
+		if password != r.Form.Get("password_confirm") {
+			form.Errors.Add("password_confirm", "The passwords don't match.")
+		}
+	}
+
+	// nobody can lock themselves out
+	if !isNew && user.ID == actorID {
+		if user.Role != old.Role {
+			form.Errors.Add("role", "You can't change your own role.")
+		}
+		if !user.Active {
+			form.Errors.Add("active", "You can't deactivate yourself.")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderUserForm(w, r, user, nil, form)
+		return
+	}
+
+	if isNew {
+		user.ID, err = m.DB.InsertUser(r.Context(), user, password)
+	} else {
+		err = m.DB.UpdateUser(r.Context(), user)
+	}
+	if errors.Is(err, repository.ErrDuplicateEmail) {
+		form.Errors.Add("email", "This e-mail address is already used by another user.")
+		m.renderUserForm(w, r, user, nil, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var audits []models.UserAudit
+	if isNew {
+		audits = append(audits, models.UserAudit{Action: "create", Details: fmt.Sprintf("%s <%s>, role %s", user.FullName, user.Email, models.RoleNames[user.Role])})
+	} else {
+		if changes := userChanges(old, user); len(changes) > 0 {
+			audits = append(audits, models.UserAudit{Action: "update", Details: strings.Join(changes, ", ")})
+		}
+		if old.Active != user.Active {
+			action := "deactivate"
+			if user.Active {
+				action = "activate"
+			}
+			audits = append(audits, models.UserAudit{Action: action})
+		}
+		if password != "" {
+			err = m.DB.UpdatePassword(r.Context(), user.ID, password)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			audits = append(audits, models.UserAudit{Action: "password-reset"})
+		}
+	}
+
+	for _, a := range audits {
+		a.ActorID = actorID
+		a.UserID = user.ID
+		err = m.DB.InsertUserAudit(r.Context(), a)
+		if err != nil {
+			m.App.ErrorLog.Println("can't write user audit log:", err)
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "success", "User successfully saved")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminDeleteUser deletes a user, except the one logged in
+func (m *Repository) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	actorID := m.App.Session.GetInt(r.Context(), "user_id")
+	if id == actorID {
+		m.App.Session.Put(r.Context(), "error", "You can't delete yourself")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteUser(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.InsertUserAudit(r.Context(), models.UserAudit{
+		ActorID: actorID,
+		UserID:  id,
+		Action:  "delete",
+		Details: fmt.Sprintf("%s <%s>", user.FullName, user.Email),
+	})
+	if err != nil {
+		m.App.ErrorLog.Println("can't write user audit log:", err)
+	}
+
+	m.App.Session.Put(r.Context(), "success", "User successfully deleted")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// renderUserForm renders the form to create or edit a user
+func (m *Repository) renderUserForm(w http.ResponseWriter, r *http.Request, user models.User, auditLog []models.UserAudit, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["user"] = user
+	data["audit_log"] = auditLog
+	data["roles"] = models.Roles
+	data["role_names"] = models.RoleNames
+
+	render.Template(w, r, "admin-user-page.tpml", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// userChanges describes the changes of name, e-mail and role for the audit log
+func userChanges(old, user models.User) []string {
+	var changes []string
+
+	if old.FullName != user.FullName {
+		changes = append(changes, fmt.Sprintf("name %q to %q", old.FullName, user.FullName))
+	}
+	if old.Email != user.Email {
+		changes = append(changes, fmt.Sprintf("e-mail %s to %s", old.Email, user.Email))
+	}
+	if old.Role != user.Role {
+		changes = append(changes, fmt.Sprintf("role %s to %s", models.RoleNames[old.Role], models.RoleNames[user.Role]))
+	}
+
+	return changes
+}
+
+// AdminFailedLogins lists the accounts with recent failed logins and whether they are locked
+func (m *Repository) AdminFailedLogins(w http.ResponseWriter, r *http.Request) {
+
+	summaries, err := m.DB.RecentFailedLogins(r.Context(), loginguard.Default.Since(time.Now()))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for i := range summaries {
+		summaries[i].Locked = loginguard.Default.Locked(summaries[i].Failures)
+	}
+
+	data := make(map[string]interface{})
+	data["failed_logins"] = summaries
+
+	render.Template(w, r, "admin-failed-logins-page.tpml", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminUnlockAccount clears the failed logins of an account, so its user can log in again right away
+func (m *Repository) AdminUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	email := r.Form.Get("email")
+	if email == "" {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.ClearFailedLogins(r.Context(), email)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "success", fmt.Sprintf("%s has been unlocked", email))
+	http.Redirect(w, r, "/admin/failed-logins", http.StatusSeeOther)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// adminPostShowUserTests is the data for the AdminPostShowUser handler tests
+var adminPostShowUserTests = []struct {
+	name               string
+	id                 string
+	loggedInAs         int
+	postedData         url.Values
+	expectedStatusCode int
+	expectedHTML       string
+}{
+	{
+		"create",
+		"",
+		1,
+		url.Values{"full_name": {"Sandy Cheeks"}, "email": {"sandy@bikini-bottom.ocean"}, "role": {"2"}, "active": {"1"}, "password": {"karate-chop"}, "password_confirm": {"karate-chop"}},
+		http.StatusSeeOther,
+		"",
+	},
+	{
+		"create-without-password",
+		"",
+		1,
+		url.Values{"full_name": {"Sandy Cheeks"}, "email": {"sandy@bikini-bottom.ocean"}, "role": {"2"}},
+		http.StatusOK,
+		`action="/admin/users/new"`,
+	},
+	{
+		"create-short-password",
+		"",
+		1,
+		url.Values{"full_name": {"Sandy Cheeks"}, "email": {"sandy@bikini-bottom.ocean"}, "role": {"2"}, "password": {"karate"}, "password_confirm": {"karate"}},
+		http.StatusOK,
+		"at least 8 characters",
+	},
+	{
+		"create-duplicate-email",
+		"",
+		1,
+		url.Values{"full_name": {"Sandy Cheeks"}, "email": {"duplicate@bikini-bottom.ocean"}, "role": {"2"}, "password": {"karate-chop"}, "password_confirm": {"karate-chop"}},
+		http.StatusOK,
+		"already used by another user",
+	},
+	{
+		"update-and-reset-password",
+		"2",
+		1,
+		url.Values{"full_name": {"Squidward Tentacles"}, "email": {"squidward@bikini-bottom.ocean"}, "role": {"3"}, "password": {"clarinet-solo"}, "password_confirm": {"clarinet-solo"}},
+		http.StatusSeeOther,
+		"",
+	},
+	{
+		"update-passwords-dont-match",
+		"2",
+		1,
+		url.Values{"full_name": {"Squidward Tentacles"}, "email": {"squidward@bikini-bottom.ocean"}, "role": {"2"}, "password": {"clarinet-solo"}, "password_confirm": {"clarinet"}},
+		http.StatusOK,
+		"don&#39;t match",
+	},
+	{
+		"invalid-role",
+		"2",
+		1,
+		url.Values{"full_name": {"Squidward Tentacles"}, "email": {"squidward@bikini-bottom.ocean"}, "role": {"7"}, "active": {"1"}},
+		http.StatusOK,
+		"Please choose a role",
+	},
+	{
+		"deactivate-yourself",
+		"1",
+		1,
+		url.Values{"full_name": {"Patrick Star"}, "email": {"patrick@bikini-bottom.ocean"}, "role": {"1"}},
+		http.StatusOK,
+		"can&#39;t deactivate yourself",
+	},
+	{
+		"change-own-role",
+		"1",
+		1,
+		url.Values{"full_name": {"Patrick Star"}, "email": {"patrick@bikini-bottom.ocean"}, "role": {"3"}, "active": {"1"}},
+		http.StatusOK,
+		"can&#39;t change your own role",
+	},
+	{
+		"unknown-user",
+		"99",
+		1,
+		url.Values{"full_name": {"Nobody"}, "email": {"nobody@bikini-bottom.ocean"}, "role": {"2"}, "active": {"1"}},
+		http.StatusNotFound,
+		"",
+	},
+}
+
+func TestAdminPostShowUser(t *testing.T) {
+	for _, e := range adminPostShowUserTests {
+		target := "/admin/users/new"
+		if e.id != "" {
+			target = "/admin/users/" + e.id
+		}
+
+		req, _ := http.NewRequest("POST", target, strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		session.Put(ctx, "user_id", e.loggedInAs)
+
+		rctx := chi.NewRouteContext()
+		if e.id != "" {
+			rctx.URLParams.Add("id", e.id)
+		}
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostShowUser)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+	}
+}
+
+// adminDeleteUserTests is the data for the AdminDeleteUser handler tests
+var adminDeleteUserTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+	expectedError      string
+}{
+	{"delete", "2", http.StatusSeeOther, ""},
+	{"delete-yourself", "1", http.StatusSeeOther, "You can't delete yourself"},
+	{"unknown-user", "99", http.StatusNotFound, ""},
+	{"invalid-id", "x", http.StatusBadRequest, ""},
+}
+
+func TestAdminDeleteUser(t *testing.T) {
+	for _, e := range adminDeleteUserTests {
+		req, _ := http.NewRequest("POST", "/admin/delete-user/"+e.id, nil)
+		ctx := getCtx(req)
+		session.Put(ctx, "user_id", 1)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminDeleteUser)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedError != "" && session.GetString(ctx, "error") != e.expectedError {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, session.GetString(ctx, "error"))
+		}
+	}
+}
+
+func TestAdminUnlockAccount(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("email", "locked@bikini-bottom.ocean")
+
+	req, _ := http.NewRequest("POST", "/admin/unlock-account", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AdminUnlockAccount)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("failed unlock-account: expected code %d, but got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	// missing e-mail address
+	req, _ = http.NewRequest("POST", "/admin/unlock-account", strings.NewReader(""))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("failed unlock-account without e-mail: expected code %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -1,11 +1,20 @@
 package helpers
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strings"
 
 	"github.com/jagottsicher/myGoWebApplication/internal/config"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
 )
 
 var app *config.AppConfig
@@ -26,8 +35,115 @@ func ServerError(w http.ResponseWriter, err error) {
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// APIError is the body of the error responses of the json api
+type APIError struct {
+	Error  string              `json:"error"`
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// WriteJSON writes v as json response with the given status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// JSONError writes an error response of the json api
+func JSONError(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, APIError{Error: message})
+}
+
+// APIServerError logs err and writes an internal server error response of the json api
+func APIServerError(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.ErrorLog.Println(trace)
+	JSONError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
 // IsAuthenticated figures determinates if an authenticated user exists in the session data
+// or the request has been authenticated by an api token
 func IsAuthenticated(r *http.Request) bool {
+	if _, ok := APIToken(r); ok {
+		return true
+	}
+
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
 }
+
+// UserRole returns the role of the logged in user, 0 if there is none
+func UserRole(r *http.Request) int {
+	if t, ok := APIToken(r); ok {
+		return t.User.Role
+	}
+
+	return app.Session.GetInt(r.Context(), "user_role")
+}
+
+type contextKey string
+
+const apiTokenKey contextKey = "api_token"
+
+// WithAPIToken returns a copy of ctx carrying the api token a request has been authenticated with
+func WithAPIToken(ctx context.Context, t models.APIToken) context.Context {
+	return context.WithValue(ctx, apiTokenKey, t)
+}
+
+// APIToken returns the api token the request has been authenticated with, if any
+func APIToken(r *http.Request) (models.APIToken, bool) {
+	t, ok := r.Context().Value(apiTokenKey).(models.APIToken)
+	return t, ok
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header, or an empty string
+func BearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// Can reports whether the logged in user has the permission p
+func Can(r *http.Request, p models.Permission) bool {
+	return models.RoleCan(UserRole(r), p)
+}
+
+// NewToken returns a random url-safe token, e.g. for links sent by e-mail, and the hash to store instead of the token
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded sha256 hash of a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientIP returns the ip address of the client without port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// NormalizeEmail returns an e-mail address of a user the way it is stored and compared, trimmed and in lower case
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,294 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localTimeLayout is the format of date-times without time zone or with a TZID parameter
+const localTimeLayout = "20060102T150405"
+
+// maxContentLine is the longest unfolded content line accepted by Decode
+const maxContentLine = 1 << 20
+
+// ErrNoCalendar is returned by Decode for streams without a VCALENDAR object
+var ErrNoCalendar = errors.New("not an iCalendar stream")
+
+// contentLine is a property of an iCalendar object like DTSTART;VALUE=DATE:20261018
+type contentLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Decode reads the events of an iCalendar stream as all-day events. Date-times are cut to
+// their date in their own time zone, so a departure in the morning ends the event on that day.
+// Cancelled events and events without a start are left out, recurrence rules are ignored.
+func Decode(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var stack []string
+	var e *Event
+	var hasEnd, cancelled bool
+	var start time.Time
+	var duration time.Duration
+	found := false
+
+	for i, l := range lines {
+		if l == "" {
+			continue
+		}
+
+		cl, err := parseContentLine(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch cl.name {
+		case "BEGIN":
+			name := strings.ToUpper(cl.value)
+			if name == "VCALENDAR" {
+				found = true
+			}
+			if name == "VEVENT" && len(stack) == 1 && stack[0] == "VCALENDAR" {
+				e = &Event{}
+				hasEnd, cancelled, start, duration = false, false, time.Time{}, 0
+			}
+			stack = append(stack, name)
+			continue
+		case "END":
+			name := strings.ToUpper(cl.value)
+			if len(stack) == 0 || stack[len(stack)-1] != name {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, cl.value)
+			}
+			stack = stack[:len(stack)-1]
+
+			if name == "VEVENT" && e != nil && len(stack) == 1 {
+				if !e.Start.IsZero() && !cancelled {
+					if !hasEnd {
+						// an event without end lasts one day, or as long as its duration
+						e.End = truncateDate(start.Add(duration))
+					}
+					if !e.End.After(e.Start) {
+						e.End = e.Start.AddDate(0, 0, 1)
+					}
+					events = append(events, *e)
+				}
+				e = nil
+			}
+			continue
+		}
+
+		// only the properties of events are of interest, not those of alarms inside them
+		if e == nil || len(stack) != 2 {
+			continue
+		}
+
+		switch cl.name {
+		case "UID":
+			e.UID = cl.value
+		case "SUMMARY":
+			e.Summary = unescape(cl.value)
+		case "STATUS":
+			cancelled = strings.EqualFold(cl.value, "CANCELLED")
+		case "DTSTAMP":
+			e.Stamp, _ = parseTime(cl)
+		case "DTSTART":
+			t, err := parseTime(cl)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			start = t
+			e.Start = truncateDate(t)
+		case "DTEND":
+			t, err := parseTime(cl)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			e.End = truncateDate(t)
+			hasEnd = true
+		case "DURATION":
+			d, err := parseDuration(cl.value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			duration = d
+		}
+	}
+
+	if !found {
+		return nil, ErrNoCalendar
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("missing END:%s", stack[len(stack)-1])
+	}
+
+	return events, nil
+}
+
+// unfold reads the content lines of a stream, joining folded lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxContentLine)
+
+	for scanner.Scan() {
+		l := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseContentLine splits a content line into name, parameters and value.
+// Parameter values may be quoted and contain colons and semicolons then.
+func parseContentLine(l string) (contentLine, error) {
+	cl := contentLine{params: map[string]string{}}
+
+	inQuotes := false
+	colon := -1
+	for i, c := range l {
+		if c == '"' {
+			inQuotes = !inQuotes
+		}
+		if c == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return cl, fmt.Errorf("invalid content line %q", l)
+	}
+
+	cl.value = l[colon+1:]
+
+	parts := splitParams(l[:colon])
+	cl.name = strings.ToUpper(parts[0])
+	if cl.name == "" {
+		return cl, fmt.Errorf("invalid content line %q", l)
+	}
+
+	for _, p := range parts[1:] {
+		name, value, _ := strings.Cut(p, "=")
+		cl.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+
+	return cl, nil
+}
+
+// splitParams splits the name and the parameters of a content line at semicolons outside of quotes
+func splitParams(s string) []string {
+	var parts []string
+
+	inQuotes := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == ';' && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// parseTime parses a date or date-time value. Local times are read in the time zone of
+// the TZID parameter, or in UTC if the zone is unknown or missing.
+func parseTime(cl contentLine) (time.Time, error) {
+	v := cl.value
+
+	if strings.EqualFold(cl.params["VALUE"], "DATE") || len(v) == len(dateLayout) {
+		return time.Parse(dateLayout, v)
+	}
+
+	if strings.HasSuffix(v, "Z") {
+		return time.Parse(timestampLayout, v)
+	}
+
+	loc := time.UTC
+	if tzid := cl.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	return time.ParseInLocation(localTimeLayout, v, loc)
+}
+
+// truncateDate returns the date of t at midnight UTC
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// parseDuration parses a positive duration like P3D, P1W or PT36H
+func parseDuration(v string) (time.Duration, error) {
+	s := strings.TrimPrefix(strings.ToUpper(v), "+")
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+
+	var d time.Duration
+	inTime := false
+	num := ""
+
+	for _, c := range s[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			num += string(c)
+			continue
+		case c == 'T':
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		num = ""
+
+		switch {
+		case c == 'W' && !inTime:
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D' && !inTime:
+			d += time.Duration(n) * 24 * time.Hour
+		case c == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case c == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case c == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+	}
+
+	if num != "" {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+
+	return d, nil
+}
+
+// unescape reverses escape for text values
+func unescape(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
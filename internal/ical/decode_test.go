@@ -0,0 +1,123 @@
+package ical
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPortalCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Jellyfish Fields Rentals//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:booking-1@jellyfish-fields.ocean\r\n" +
+	"DTSTART;VALUE=DATE:20300110\r\n" +
+	"DTEND;VALUE=DATE:20300114\r\n" +
+	"SUMMARY:Reserved\\, Patrick\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"UID:alarm-1\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:booking-2@jellyfish-fields.ocean\r\n" +
+	"DTSTART;TZID=\"Europe/Berlin\":20300201T150000\r\n" +
+	"DTEND;TZID=\"Europe/Berlin\":20300205T100000\r\n" +
+	"SUMMARY:A very long summary which has been folded by the portal because it is lo\r\n" +
+	" nger than 75 octets\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:booking-3@jellyfish-fields.ocean\r\n" +
+	"DTSTART:20300301T140000Z\r\n" +
+	"DURATION:P2DT22H\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:booking-4@jellyfish-fields.ocean\r\n" +
+	"DTSTART;VALUE=DATE:20300401\r\n" +
+	"DTEND;VALUE=DATE:20300403\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:booking-5@jellyfish-fields.ocean\r\n" +
+	"DTSTART;VALUE=DATE:20300501\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDecode(t *testing.T) {
+	events, err := Decode(strings.NewReader(testPortalCalendar))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Event{
+		{UID: "booking-1@jellyfish-fields.ocean", Start: date(2030, 1, 10), End: date(2030, 1, 14), Summary: "Reserved, Patrick"},
+		{UID: "booking-2@jellyfish-fields.ocean", Start: date(2030, 2, 1), End: date(2030, 2, 5), Summary: "A very long summary which has been folded by the portal because it is longer than 75 octets"},
+		{UID: "booking-3@jellyfish-fields.ocean", Start: date(2030, 3, 1), End: date(2030, 3, 4)},
+		{UID: "booking-5@jellyfish-fields.ocean", Start: date(2030, 5, 1), End: date(2030, 5, 2)},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+
+	for i, e := range expected {
+		got := events[i]
+		if got.UID != e.UID || !got.Start.Equal(e.Start) || !got.End.Equal(e.End) || got.Summary != e.Summary {
+			t.Errorf("event %d: expected %+v, got %+v", i, e, got)
+		}
+	}
+}
+
+func TestDecodeEncoded(t *testing.T) {
+	c := Calendar{
+		ProdID: "-//Bungalow Bliss//Test//EN",
+		Events: []Event{
+			{UID: "reservation-1@bikini-bottom.ocean", Start: date(2030, 1, 1), End: date(2030, 1, 5), Summary: "Smith, John; family", Stamp: time.Now()},
+		},
+	}
+
+	var b strings.Builder
+	err := Encode(&b, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := Decode(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != "Smith, John; family" || !events[0].End.Equal(date(2030, 1, 5)) {
+		t.Errorf("decoding the encoded calendar gives %+v", events)
+	}
+}
+
+var decodeErrorTests = []struct {
+	name  string
+	input string
+}{
+	{"html", "<html><body>Not found</body></html>"},
+	{"empty", ""},
+	{"missing-end", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n"},
+	{"mismatched-end", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n"},
+	{"invalid-date", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:2030-01-01\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+	{"invalid-duration", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDURATION:3 days\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, e := range decodeErrorTests {
+		_, err := Decode(strings.NewReader(e.input))
+		if err == nil {
+			t.Errorf("failed %s: expected an error", e.name)
+		}
+	}
+
+	_, err := Decode(strings.NewReader("VERSION:2.0\r\n"))
+	if !errors.Is(err, ErrNoCalendar) {
+		t.Errorf("expected ErrNoCalendar, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar streams
+const ContentType = "text/calendar; charset=utf-8"
+
+// dateLayout is the format of all-day dates (VALUE=DATE)
+const dateLayout = "20060102"
+
+// timestampLayout is the format of utc date-times
+const timestampLayout = "20060102T150405Z"
+
+// maxLineLength is the number of octets after which content lines are folded
+const maxLineLength = 75
+
+// Calendar is an iCalendar object with all-day events
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Event is an all-day event, End is the day after the last day like the departure of a guest
+type Event struct {
+	UID     string
+	Start   time.Time
+	End     time.Time
+	Summary string
+	Stamp   time.Time
+}
+
+// Encode writes c as iCalendar stream following RFC 5545
+func Encode(w io.Writer, c Calendar) error {
+	bw := bufio.NewWriter(w)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + c.ProdID,
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+	}
+	if c.Name != "" {
+		lines = append(lines, "X-WR-CALNAME:"+escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+escape(e.UID),
+			"DTSTAMP:"+e.Stamp.UTC().Format(timestampLayout),
+			"DTSTART;VALUE=DATE:"+e.Start.Format(dateLayout),
+			"DTEND;VALUE=DATE:"+e.End.Format(dateLayout),
+			"SUMMARY:"+escape(e.Summary),
+			"TRANSP:OPAQUE",
+			"END:VEVENT",
+		)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, l := range lines {
+		_, err := bw.WriteString(fold(l))
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// escape escapes a text value
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// fold splits a content line into lines of at most 75 octets without splitting utf-8 characters,
+// continuation lines start with a space. The result ends with CRLF.
+func fold(line string) string {
+	var b strings.Builder
+
+	limit := maxLineLength
+	for len(line) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		b.WriteString(line[:i])
+		b.WriteString("\r\n ")
+		line = line[i:]
+		// the leading space counts towards the length of continuation lines
+		limit = maxLineLength - 1
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// UID returns a globally unique id for an object of the given kind and id
+func UID(kind string, id int, domain string) string {
+	return fmt.Sprintf("%s-%d@%s", kind, id, domain)
+}
@@ -0,0 +1,68 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	c := Calendar{
+		ProdID: "-//Bungalow Bliss//Test//EN",
+		Name:   "Eremite",
+		Events: []Event{
+			{
+				UID:     "reservation-1@bikini-bottom.ocean",
+				Start:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+				End:     time.Date(2030, 1, 5, 0, 0, 0, 0, time.UTC),
+				Summary: "Smith, John; family",
+				Stamp:   time.Date(2029, 12, 24, 18, 30, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	var b strings.Builder
+	err := Encode(&b, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"BEGIN:VEVENT\r\nUID:reservation-1@bikini-bottom.ocean\r\n",
+		"DTSTAMP:20291224T183000Z\r\n",
+		"DTSTART;VALUE=DATE:20300101\r\n",
+		"DTEND;VALUE=DATE:20300105\r\n",
+		`SUMMARY:Smith\, John\; family` + "\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	// case #1: short lines are kept
+	if got := fold("SUMMARY:short"); got != "SUMMARY:short\r\n" {
+		t.Errorf("unexpected folding of a short line: %q", got)
+	}
+
+	// case #2: long lines are folded at 75 octets without splitting characters
+	line := "SUMMARY:" + strings.Repeat("ä", 100)
+	folded := fold(line)
+
+	for _, l := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+		if len(l) > maxLineLength {
+			t.Errorf("line longer than %d octets: %d", maxLineLength, len(l))
+		}
+		if strings.ContainsRune(l, '�') {
+			t.Error("a character has been split")
+		}
+	}
+
+	if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != line+"\r\n" {
+		t.Error("unfolding doesn't give the original line")
+	}
+}
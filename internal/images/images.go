@@ -0,0 +1,265 @@
+// Package images stores the uploaded photos of the bungalows and makes the resized variants shown on the pages.
+// Uploads may be JPEG, PNG or WebP, each variant is written as JPEG and as WebP. WebP is encoded by
+// github.com/gen2brain/webp, which runs libwebp compiled to WebAssembly, so no cgo is needed.
+package images
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/gen2brain/webp"
+	"golang.org/x/image/draw"
+)
+
+// MaxPixels is the largest image, in pixels, which is decoded, to reject images which are
+// small files but would need gigabytes of memory
+const MaxPixels = 50_000_000
+
+// quality is the quality of the jpeg and webp variants
+const quality = 85
+
+// Variants holds the width in pixels of each variant. Wider images are scaled down, smaller ones keep their size.
+var Variants = map[string]int{
+	"thumb": 480,
+	"large": 1600,
+}
+
+// Formats maps the formats of the variants to the extension of their files. Browsers which can't
+// show webp get the jpeg files.
+var Formats = map[string]string{
+	"jpeg": ".jpg",
+	"webp": ".webp",
+}
+
+// errors returned for uploads which are not stored
+var (
+	ErrTooLarge        = errors.New("image is too large")
+	ErrUnsupportedType = errors.New("image is not a jpeg, png or webp file")
+)
+
+// namePattern is the format of the file names of the originals
+var namePattern = regexp.MustCompile(`^[\w-]+\.(jpe?g|png|webp)$`)
+
+// extensions maps the accepted content types to the extension of the stored original
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Store keeps the originals in Dir and the files of each variant in a sub directory named like the variant
+type Store struct {
+	Dir     string
+	MaxSize int64
+}
+
+// ValidName reports whether name is the file name of an original
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Save checks and stores an uploaded image under a new random name and makes its variants.
+// It returns ErrTooLarge or ErrUnsupportedType for images which aren't accepted.
+func (s *Store) Save(r io.Reader) (string, error) {
+	content, err := io.ReadAll(io.LimitReader(r, s.MaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(content)) > s.MaxSize {
+		return "", ErrTooLarge
+	}
+
+	ext, ok := extensions[http.DetectContentType(content)]
+	if !ok {
+		return "", ErrUnsupportedType
+	}
+
+	img, err := decode(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	random := make([]byte, 16)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(random) + ext
+
+	err = os.MkdirAll(s.Dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.WriteFile(filepath.Join(s.Dir, name), content, 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	for variant := range Variants {
+		err = s.writeVariant(img, variant, name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return name, nil
+}
+
+// Variant returns the path of a variant of an image in one of the Formats. A missing variant is
+// made from the original, so originals copied into Dir by hand are served as well. If the original
+// doesn't exist the error matches os.ErrNotExist.
+func (s *Store) Variant(variant, format, name string) (string, error) {
+	_, knownVariant := Variants[variant]
+	_, knownFormat := Formats[format]
+	if !knownVariant || !knownFormat || !ValidName(name) {
+		return "", fmt.Errorf("no %s variant %s of %s: %w", format, variant, name, os.ErrNotExist)
+	}
+
+	path := s.variantPath(variant, format, name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	f, err := os.Open(filepath.Join(s.Dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	img, err := decode(f)
+	if err != nil {
+		return "", err
+	}
+
+	return path, s.writeVariant(img, variant, name)
+}
+
+// Delete removes an original and its variants, missing files are ignored
+func (s *Store) Delete(name string) error {
+	if !ValidName(name) {
+		return fmt.Errorf("invalid image name %q", name)
+	}
+
+	paths := []string{filepath.Join(s.Dir, name)}
+	for variant := range Variants {
+		for format := range Formats {
+			paths = append(paths, s.variantPath(variant, format, name))
+		}
+	}
+
+	var errs []error
+	for _, p := range paths {
+		err := os.Remove(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// variantPath returns the path of a variant in a format, the name of the original is kept to avoid
+// clashes between e.g. photo.png and photo.jpg
+func (s *Store) variantPath(variant, format, name string) string {
+	return filepath.Join(s.Dir, variant, name+Formats[format])
+}
+
+// writeVariant scales img down to the width of the variant and writes it in all Formats. Each file
+// is written under a temporary name first, so no half written variant is ever served.
+func (s *Store) writeVariant(img image.Image, variant, name string) error {
+	dir := filepath.Join(s.Dir, variant)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	scaled := resize(img, Variants[variant])
+
+	for format := range Formats {
+		err = s.writeFile(scaled, variant, format, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFile encodes img in a format and moves it to the path of the variant
+func (s *Store) writeFile(img image.Image, variant, format, name string) error {
+	tmp, err := os.CreateTemp(filepath.Join(s.Dir, variant), name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	switch format {
+	case "webp":
+		err = webp.Encode(tmp, img, webp.Options{Quality: quality, Method: webp.DefaultMethod})
+	default:
+		err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: quality})
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.variantPath(variant, format, name))
+}
+
+// decode decodes an image after checking its size
+func decode(r io.ReadSeeker) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	return img, nil
+}
+
+// resize scales img down to width, keeping its aspect ratio. Transparent parts become white,
+// as jpeg has no transparency.
+func resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() < width {
+		width = b.Dx()
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	return dst
+}
@@ -0,0 +1,148 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gen2brain/webp"
+)
+
+// testPNG returns a png image of the given size
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.NRGBA{R: 255, A: 128})
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// widthOf returns the width of the jpeg or webp file at path
+func widthOf(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	decodeConfig := jpeg.DecodeConfig
+	if filepath.Ext(path) == ".webp" {
+		decodeConfig = webp.DecodeConfig
+	}
+
+	cfg, err := decodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Width
+}
+
+func TestSave(t *testing.T) {
+	s := &Store{Dir: t.TempDir(), MaxSize: 1 << 20}
+
+	name, err := s.Save(bytes.NewReader(testPNG(t, 2000, 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidName(name) || !strings.HasSuffix(name, ".png") {
+		t.Errorf("unexpected name %s", name)
+	}
+
+	if _, err := os.Stat(filepath.Join(s.Dir, name)); err != nil {
+		t.Error("original not stored")
+	}
+	if w := widthOf(t, filepath.Join(s.Dir, "thumb", name+".jpg")); w != Variants["thumb"] {
+		t.Errorf("expected thumbnail of width %d, but got %d", Variants["thumb"], w)
+	}
+	if w := widthOf(t, filepath.Join(s.Dir, "large", name+".jpg")); w != Variants["large"] {
+		t.Errorf("expected large variant of width %d, but got %d", Variants["large"], w)
+	}
+	if w := widthOf(t, filepath.Join(s.Dir, "thumb", name+".webp")); w != Variants["thumb"] {
+		t.Errorf("expected webp thumbnail of width %d, but got %d", Variants["thumb"], w)
+	}
+	if w := widthOf(t, filepath.Join(s.Dir, "large", name+".webp")); w != Variants["large"] {
+		t.Errorf("expected large webp variant of width %d, but got %d", Variants["large"], w)
+	}
+
+	small, err := s.Save(bytes.NewReader(testPNG(t, 300, 200)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := widthOf(t, filepath.Join(s.Dir, "large", small+".jpg")); w != 300 {
+		t.Errorf("expected small image to keep its width, but got %d", w)
+	}
+
+	err = s.Delete(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{name, "thumb/" + name + ".jpg", "large/" + name + ".jpg", "thumb/" + name + ".webp", "large/" + name + ".webp"} {
+		if _, err := os.Stat(filepath.Join(s.Dir, p)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be deleted", p)
+		}
+	}
+}
+
+func TestSaveRejected(t *testing.T) {
+	s := &Store{Dir: t.TempDir(), MaxSize: 1 << 10}
+
+	_, err := s.Save(bytes.NewReader(bytes.Repeat([]byte{0}, 2<<10)))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, but got %v", err)
+	}
+
+	_, err = s.Save(strings.NewReader("GIF89a not really a gif"))
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expected ErrUnsupportedType for a gif, but got %v", err)
+	}
+
+	_, err = s.Save(strings.NewReader("\x89PNG\r\n\x1a\nbroken"))
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expected ErrUnsupportedType for a broken png, but got %v", err)
+	}
+}
+
+func TestVariant(t *testing.T) {
+	s := &Store{Dir: t.TempDir(), MaxSize: 1 << 20}
+
+	// an original copied into the directory by hand, without variants
+	err := os.WriteFile(filepath.Join(s.Dir, "shack-kitchen.png"), testPNG(t, 800, 600), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for format := range Formats {
+		path, err := s.Variant("thumb", format, "shack-kitchen.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := widthOf(t, path); w != Variants["thumb"] {
+			t.Errorf("expected %s thumbnail of width %d, but got %d", format, Variants["thumb"], w)
+		}
+	}
+
+	for _, e := range []struct{ variant, format, name string }{
+		{"thumb", "jpeg", "missing.jpg"},
+		{"huge", "jpeg", "shack-kitchen.png"},
+		{"thumb", "gif", "shack-kitchen.png"},
+		{"thumb", "jpeg", "../secret.png"},
+	} {
+		_, err = s.Variant(e.variant, e.format, e.name)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected os.ErrNotExist for %s/%s/%s, but got %v", e.variant, e.format, e.name, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package loginguard
+
+import (
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+)
+
+// Policy decides when login attempts are refused after failed logins
+type Policy struct {
+	// Window is how long failed logins count, an account or ip address is locked until Window after its last failure
+	Window time.Duration
+	// MaxAccountFailures locks the account
+	MaxAccountFailures int
+	// MaxIPFailures locks the ip address for all accounts
+	MaxIPFailures int
+	// BaseDelay is the wait time after the first failure of an account, doubled with each further failure
+	BaseDelay time.Duration
+	// MaxDelay is the longest wait time between two attempts before the account is locked
+	MaxDelay time.Duration
+}
+
+// Default is the policy used for the login
+var Default = Policy{
+	Window:             15 * time.Minute,
+	MaxAccountFailures: 5,
+	MaxIPFailures:      20,
+	BaseDelay:          time.Second,
+	MaxDelay:           30 * time.Second,
+}
+
+// Since returns the time from which on failed logins have to be counted
+func (p Policy) Since(now time.Time) time.Time {
+	return now.Add(-p.Window)
+}
+
+// RetryAfter returns how long to wait before the next login attempt is allowed, zero if it is allowed now
+func (p Policy) RetryAfter(stats models.FailedLoginStats, now time.Time) time.Duration {
+	var wait time.Duration
+
+	if stats.IPFailures >= p.MaxIPFailures {
+		wait = maxDuration(wait, stats.LastIPFailure.Add(p.Window).Sub(now))
+	}
+
+	if stats.AccountFailures >= p.MaxAccountFailures {
+		wait = maxDuration(wait, stats.LastAccountFailure.Add(p.Window).Sub(now))
+	} else if stats.AccountFailures > 0 {
+		wait = maxDuration(wait, stats.LastAccountFailure.Add(p.Delay(stats.AccountFailures)).Sub(now))
+	}
+
+	return wait
+}
+
+// Locked reports whether an account with the number of failures is locked
+func (p Policy) Locked(failures int) bool {
+	return failures >= p.MaxAccountFailures
+}
+
+// Delay returns the wait time after the given number of failures, doubling with each failure up to MaxDelay
+func (p Policy) Delay(failures int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < failures; i++ {
+		d *= 2
+		if d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return d
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
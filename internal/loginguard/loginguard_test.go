@@ -0,0 +1,44 @@
+package loginguard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+)
+
+var now = time.Date(2038, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var retryAfterTests = []struct {
+	name     string
+	stats    models.FailedLoginStats
+	expected time.Duration
+}{
+	{"no failures", models.FailedLoginStats{}, 0},
+	{"first failure just now", models.FailedLoginStats{AccountFailures: 1, LastAccountFailure: now}, time.Second},
+	{"delay has passed", models.FailedLoginStats{AccountFailures: 1, LastAccountFailure: now.Add(-2 * time.Second)}, 0},
+	{"progressive delay", models.FailedLoginStats{AccountFailures: 3, LastAccountFailure: now.Add(-time.Second)}, 3 * time.Second},
+	{"account locked", models.FailedLoginStats{AccountFailures: 5, LastAccountFailure: now.Add(-5 * time.Minute)}, 10 * time.Minute},
+	{"lock has passed", models.FailedLoginStats{AccountFailures: 5, LastAccountFailure: now.Add(-15 * time.Minute)}, 0},
+	{"ip locked", models.FailedLoginStats{IPFailures: 20, LastIPFailure: now.Add(-time.Minute)}, 14 * time.Minute},
+	{"many ip failures below limit", models.FailedLoginStats{IPFailures: 19, LastIPFailure: now}, 0},
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, e := range retryAfterTests {
+		wait := Default.RetryAfter(e.stats, now)
+		if wait != e.expected {
+			t.Errorf("failed %s: expected %s, got %s", e.name, e.expected, wait)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+
+	for i, want := range expected {
+		if d := Default.Delay(i + 1); d != want {
+			t.Errorf("delay after %d failures: expected %s, got %s", i+1, want, d)
+		}
+	}
+}
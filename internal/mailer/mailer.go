@@ -0,0 +1,127 @@
+package mailer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/config"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// encryption modes which can be configured for the smtp connection
+const (
+	EncryptionNone     = "none"
+	EncryptionSTARTTLS = "starttls"
+	EncryptionSSL      = "ssl"
+)
+
+// Mailer is the interface for everything able to send out an e-mail
+type Mailer interface {
+	Send(m models.MailData) error
+}
+
+// SMTPMailer sends e-mails through a smtp server
+type SMTPMailer struct {
+	cfg config.MailConfig
+}
+
+// NewSMTPMailer returns a mailer using the smtp server from cfg
+func NewSMTPMailer(cfg config.MailConfig) (*SMTPMailer, error) {
+	if _, err := encryption(cfg.Encryption); err != nil {
+		return nil, err
+	}
+
+	return &SMTPMailer{cfg: cfg}, nil
+}
+
+// Send connects to the smtp server and sends the message. If the message has no sender
+// the configured default sender is used.
+func (s *SMTPMailer) Send(m models.MailData) error {
+	enc, err := encryption(s.cfg.Encryption)
+	if err != nil {
+		return err
+	}
+
+	server := mail.NewSMTPClient()
+	server.Host = s.cfg.Host
+	server.Port = s.cfg.Port
+	server.Encryption = enc
+	server.KeepAlive = false
+	server.ConnectTimeout = 10 * time.Second
+	server.SendTimeout = 10 * time.Second
+
+	if s.cfg.Username != "" {
+		server.Username = s.cfg.Username
+		server.Password = s.cfg.Password
+		server.Authentication = mail.AuthAuto
+	} else {
+		server.Authentication = mail.AuthNone
+	}
+
+	client, err := server.Connect()
+	if err != nil {
+		return err
+	}
+
+	from := m.From
+	if from == "" {
+		from = s.cfg.From
+	}
+
+	email := mail.NewMSG()
+	email.SetFrom(from).AddTo(m.To).SetSubject(m.Subject)
+	if m.TextContent != "" {
+		email.SetBody(mail.TextPlain, m.TextContent)
+		email.AddAlternative(mail.TextHTML, m.Content)
+	} else {
+		email.SetBody(mail.TextHTML, m.Content)
+	}
+
+	return email.Send(client)
+}
+
+// encryption translates a configured encryption mode to the one used by the mail package
+func encryption(mode string) (mail.Encryption, error) {
+	switch mode {
+	case "", EncryptionNone:
+		return mail.EncryptionNone, nil
+	case EncryptionSTARTTLS:
+		return mail.EncryptionSTARTTLS, nil
+	case EncryptionSSL:
+		return mail.EncryptionSSLTLS, nil
+	}
+
+	return mail.EncryptionNone, fmt.Errorf("unknown smtp encryption %q (none, starttls, ssl)", mode)
+}
+
+// MemoryMailer keeps all e-mails in memory instead of sending them, e.g. for tests
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []models.MailData
+}
+
+// NewMemoryMailer returns an empty in-memory mailer
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send stores the message
+func (mm *MemoryMailer) Send(m models.MailData) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.messages = append(mm.messages, m)
+	return nil
+}
+
+// Messages returns a copy of all messages sent so far
+func (mm *MemoryMailer) Messages() []models.MailData {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	messages := make([]models.MailData, len(mm.messages))
+	copy(messages, mm.messages)
+	return messages
+}
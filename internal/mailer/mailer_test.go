@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"testing"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/config"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+)
+
+var newSMTPMailerTests = []struct {
+	name       string
+	encryption string
+	expectErr  bool
+}{
+	{"default", "", false},
+	{"none", EncryptionNone, false},
+	{"starttls", EncryptionSTARTTLS, false},
+	{"ssl", EncryptionSSL, false},
+	{"unknown", "carrier-pigeon", true},
+}
+
+func TestNewSMTPMailer(t *testing.T) {
+	for _, e := range newSMTPMailerTests {
+		_, err := NewSMTPMailer(config.MailConfig{Host: "localhost", Port: 25, Encryption: e.encryption})
+		if e.expectErr && err == nil {
+			t.Errorf("failed %s: expected an error but got none", e.name)
+		}
+		if !e.expectErr && err != nil {
+			t.Errorf("failed %s: expected no error but got %s", e.name, err)
+		}
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mm := NewMemoryMailer()
+
+	var m Mailer = mm
+	err := m.Send(models.MailData{To: "patrick@bikini-bottom.ocean", Subject: "Hi"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	messages := mm.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+
+	if messages[0].Subject != "Hi" {
+		t.Errorf("expected subject %q, got %q", "Hi", messages[0].Subject)
+	}
+}
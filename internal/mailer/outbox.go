@@ -0,0 +1,134 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// maxBackoff is the longest time to wait between two delivery attempts
+const maxBackoff = 6 * time.Hour
+
+// directAttempts is the number of attempts to send an e-mail which couldn't be stored in the outbox
+const directAttempts = 3
+
+// directBackoff is the time to wait after the first failed attempt to send an e-mail directly
+const directBackoff = time.Second
+
+// batchSize is the number of e-mails loaded from the outbox per delivery run
+const batchSize = 50
+
+// Worker delivers the e-mails stored in the outbox and retries failed deliveries with exponential backoff
+type Worker struct {
+	DB          repository.DatabaseRepo
+	Mailer      Mailer
+	Queue       <-chan models.MailData
+	Interval    time.Duration
+	MaxAttempts int
+	Backoff     time.Duration
+	InfoLog     *log.Logger
+	ErrorLog    *log.Logger
+}
+
+// Start runs the worker in its own goroutine. Messages from the queue are stored in the outbox
+// and delivered from there, or sent directly if they can't be stored. After the queue has been
+// closed the worker makes a last delivery run and closes the returned channel.
+func (w *Worker) Start() <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case msg, ok := <-w.Queue:
+				if !ok {
+					w.DeliverPending(context.Background())
+					return
+				}
+
+				err := w.DB.InsertMail(context.Background(), msg)
+				if err != nil {
+					w.ErrorLog.Println("can't store e-mail in outbox, sending it directly:", err)
+					w.sendDirectly(msg)
+					continue
+				}
+				w.DeliverPending(context.Background())
+			case <-ticker.C:
+				w.DeliverPending(context.Background())
+			}
+		}
+	}()
+
+	return done
+}
+
+// DeliverPending tries to send all e-mails from the outbox which are due
+func (w *Worker) DeliverPending(ctx context.Context) {
+	mails, err := w.DB.DueMails(ctx, batchSize)
+	if err != nil {
+		w.ErrorLog.Println("can't read outbox:", err)
+		return
+	}
+
+	for _, mail := range mails {
+		err := w.Mailer.Send(mail.MailData)
+		mail.Attempts++
+
+		if err == nil {
+			mail.Status = models.MailSent
+			mail.LastError = ""
+			w.InfoLog.Println("E-Mail sent out!")
+		} else {
+			mail.LastError = err.Error()
+			if mail.Attempts >= w.MaxAttempts {
+				mail.Status = models.MailFailed
+				w.ErrorLog.Printf("giving up on e-mail %d after %d attempts: %s", mail.ID, mail.Attempts, err)
+			} else {
+				mail.NextAttemptAt = time.Now().Add(backoff(w.Backoff, mail.Attempts))
+				w.ErrorLog.Printf("e-mail %d not sent, retrying at %s: %s", mail.ID, mail.NextAttemptAt.Format(time.RFC3339), err)
+			}
+		}
+
+		err = w.DB.UpdateMailDelivery(ctx, mail)
+		if err != nil {
+			w.ErrorLog.Println("can't update outbox:", err)
+		}
+	}
+}
+
+// sendDirectly sends a message which couldn't be stored in the outbox, retrying a few
+// times in case the mail server isn't reachable for a moment
+func (w *Worker) sendDirectly(msg models.MailData) {
+	var err error
+	for attempt := 1; attempt <= directAttempts; attempt++ {
+		err = w.Mailer.Send(msg)
+		if err == nil {
+			w.InfoLog.Println("E-Mail sent out!")
+			return
+		}
+		if attempt < directAttempts {
+			time.Sleep(backoff(directBackoff, attempt))
+		}
+	}
+	w.ErrorLog.Printf("e-mail to %s lost after %d attempts: %s", msg.To, directAttempts, err)
+}
+
+// backoff returns the time to wait after the given number of failed attempts,
+// doubling with each attempt up to maxBackoff
+func backoff(base time.Duration, attempts int) time.Duration {
+	d := base
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/config"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
+)
+
+var backoffTests = []struct {
+	name     string
+	attempts int
+	expected time.Duration
+}{
+	{"first-retry", 1, time.Minute},
+	{"second-retry", 2, 2 * time.Minute},
+	{"fifth-retry", 5, 16 * time.Minute},
+	{"capped", 20, maxBackoff},
+}
+
+func TestBackoff(t *testing.T) {
+	for _, e := range backoffTests {
+		d := backoff(time.Minute, e.attempts)
+		if d != e.expected {
+			t.Errorf("failed %s: expected %s, got %s", e.name, e.expected, d)
+		}
+	}
+}
+
+type failingMailer struct{}
+
+func (fm *failingMailer) Send(m models.MailData) error {
+	return errors.New("connection refused")
+}
+
+func newTestWorker(m Mailer, queue <-chan models.MailData) *Worker {
+	return &Worker{
+		DB:          dbrepo.NewTestingRepo(&config.AppConfig{}),
+		Mailer:      m,
+		Queue:       queue,
+		Interval:    time.Hour,
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		InfoLog:     log.New(io.Discard, "", 0),
+		ErrorLog:    log.New(io.Discard, "", 0),
+	}
+}
+
+func TestWorker_DeliverPending(t *testing.T) {
+	mm := NewMemoryMailer()
+	w := newTestWorker(mm, nil)
+
+	w.DeliverPending(context.Background())
+
+	if len(mm.Messages()) != 1 {
+		t.Errorf("expected 1 delivered e-mail, got %d", len(mm.Messages()))
+	}
+
+	// a failing delivery must not panic and is stored for a retry
+	w = newTestWorker(&failingMailer{}, nil)
+	w.DeliverPending(context.Background())
+}
+
+func TestWorker_Start(t *testing.T) {
+	mm := NewMemoryMailer()
+	queue := make(chan models.MailData)
+	w := newTestWorker(mm, queue)
+
+	done := w.Start()
+
+	queue <- models.MailData{To: "patrick@bikini-bottom.ocean"}
+	close(queue)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop after the queue was closed")
+	}
+
+	if len(mm.Messages()) == 0 {
+		t.Error("expected delivered e-mails, got none")
+	}
+}
+
+func TestWorker_StartUnstorable(t *testing.T) {
+	mm := NewMemoryMailer()
+	queue := make(chan models.MailData)
+	w := newTestWorker(mm, queue)
+
+	done := w.Start()
+
+	// the testing repo can't store e-mails to this address, so it has to be sent directly
+	queue <- models.MailData{To: "unstorable@bikini-bottom.ocean"}
+	close(queue)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop after the queue was closed")
+	}
+
+	found := false
+	for _, msg := range mm.Messages() {
+		if msg.To == "unstorable@bikini-bottom.ocean" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected the e-mail which couldn't be stored to be sent directly")
+	}
+}
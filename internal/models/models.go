@@ -2,6 +2,13 @@ package models
 
 import "time"
 
+// names of the application settings stored in the database
+const (
+	SettingRequire2FA       = "require_2fa"
+	SettingICalGuestNames   = "ical_guest_names"
+	SettingCancellationDays = "cancellation_days"
+)
+
 // User is the model of user data
 type User struct {
 	ID        int
@@ -9,18 +16,116 @@ type User struct {
 	Email     string
 	Password  string
 	Role      int
+	Active    bool
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// two-factor authentication, the last counter prevents using a code twice
+	TOTPSecret      string
+	TOTPEnabled     bool
+	TOTPLastCounter int64
+}
+
+// UserAudit is the model of an entry in the log of changes to users
+type UserAudit struct {
+	ID        int
+	ActorID   int
+	ActorName string
+	UserID    int
+	Action    string
+	Details   string
+	CreatedAt time.Time
 }
 
-// Bungalow is the model of bungalow data
+// FailedLoginStats holds the recent failed logins of an account and an ip address
+type FailedLoginStats struct {
+	AccountFailures    int
+	LastAccountFailure time.Time
+	IPFailures         int
+	LastIPFailure      time.Time
+}
+
+// FailedLoginSummary is the model of the recent failed logins of an account
+type FailedLoginSummary struct {
+	Email       string
+	Failures    int
+	LastAttempt time.Time
+	LastIP      string
+	Locked      bool
+}
+
+// scopes of api tokens
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// APIToken is the model of a token for machine clients of the json api, only its hash is stored
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	Scope      string
+	LastUsedAt time.Time
+	CreatedAt  time.Time
+	User       User
+}
+
+// Bungalow is the model of bungalow data. Prices are in cents, the weekend
+// surcharge is added to the nights from friday and saturday. MaxGuests counts
+// adults and children, Beds describes the bed configuration for guests. Images
+// are only loaded where they are shown.
 type Bungalow struct {
-	ID           int
-	BungalowName string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID               int
+	BungalowName     string
+	Slug             string
+	Description      string
+	Amenities        []string
+	Images           []BungalowImage
+	NightlyRate      int
+	WeekendSurcharge int
+	CleaningFee      int
+	MinNights        int
+	MaxGuests        int
+	Beds             string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// BungalowImage is the model of a photo of a bungalow, FileName is the name of the original
+// in the image directory. The images of a bungalow are shown ordered by SortOrder.
+type BungalowImage struct {
+	ID         int
+	BungalowID int
+	FileName   string
+	Caption    string
+	SortOrder  int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Season is the model of a date range with its own nightly rate and minimum stay for a bungalow.
+// Both dates are included, a minimum stay of 0 keeps the one of the bungalow.
+type Season struct {
+	ID          int
+	BungalowID  int
+	Name        string
+	StartDate   time.Time
+	EndDate     time.Time
+	NightlyRate int
+	MinNights   int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Bungalow    Bungalow
 }
 
+// types of bungalow restrictions
+const (
+	RestrictionReservation = 1
+	RestrictionOwnerBlock  = 2
+	RestrictionExternal    = 3
+)
+
 // Restriction is the model of a restriction
 type Restriction struct {
 	ID              int
@@ -41,7 +146,21 @@ type Reservation struct {
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 	Bungalow   Bungalow
-	Status     int
+	Status     ReservationStatus
+
+	// quoted price in cents at the time of booking
+	TotalPrice int
+
+	Adults   int
+	Children int
+
+	// hash of the secret link the guest manages the reservation with
+	AccessTokenHash string
+}
+
+// Guests returns the number of adults and children of a reservation
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
 }
 
 // BungalowRestriction is a model of a bungalow restriction
@@ -57,12 +176,63 @@ type BungalowRestriction struct {
 	Bungalow      Bungalow
 	Reservation   Reservation
 	Restriction   Restriction
+
+	// restrictions imported from the calendar of another booking portal
+	CalendarImportID int
+	ExternalUID      string
+}
+
+// CalendarImport is the model of a calendar of another booking portal whose events block a bungalow.
+// The calendar is downloaded from URL, or Content holds an uploaded file.
+type CalendarImport struct {
+	ID         int
+	BungalowID int
+	Name       string
+	URL        string
+	Content    string
+	LastSyncAt time.Time
+	LastError  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Bungalow   Bungalow
 }
 
-// MailData is a model of an e-mail message
+// CalendarSyncResult counts the changes to the restrictions of a calendar import.
+// Conflicts are imported events overlapping reservations made with us.
+type CalendarSyncResult struct {
+	Added     int
+	Updated   int
+	Removed   int
+	Conflicts int
+}
+
+// MailData is a model of an e-mail message. If Template is set, Content and TextContent
+// are rendered from the e-mail templates using Data.
 type MailData struct {
-	To      string
-	From    string
-	Subject string
-	Content string
+	To          string
+	From        string
+	Subject     string
+	Content     string
+	TextContent string
+	Template    string
+	Data        map[string]interface{}
+}
+
+// status of an e-mail in the outbox
+const (
+	MailPending = 0
+	MailSent    = 1
+	MailFailed  = 2
+)
+
+// OutboxMail is a model of an e-mail stored in the outbox until it is delivered
+type OutboxMail struct {
+	ID            int
+	MailData      MailData
+	Status        int
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
 }
@@ -0,0 +1,56 @@
+package models
+
+// roles of the users of the admin area, 1 is the default of the users table
+const (
+	RoleOwner    = 1
+	RoleStaff    = 2
+	RoleReadOnly = 3
+)
+
+// Permission is an action in the admin area which isn't allowed for every role
+type Permission string
+
+// permissions checked in the admin area
+const (
+	PermEditReservations   Permission = "edit-reservations"
+	PermDeleteReservations Permission = "delete-reservations"
+	PermBlockDays          Permission = "block-days"
+	PermResendMails        Permission = "resend-mails"
+	PermManageUsers        Permission = "manage-users"
+	PermManageSettings     Permission = "manage-settings"
+	PermManagePrices       Permission = "manage-prices"
+	PermManageBungalows    Permission = "manage-bungalows"
+)
+
+// rolePermissions maps each role to its permissions, every role may view the admin area
+var rolePermissions = map[int][]Permission{
+	RoleOwner:    {PermEditReservations, PermDeleteReservations, PermBlockDays, PermResendMails, PermManageUsers, PermManageSettings, PermManagePrices, PermManageBungalows},
+	RoleStaff:    {PermEditReservations, PermBlockDays, PermResendMails},
+	RoleReadOnly: {},
+}
+
+// Roles lists all roles in the order they are offered in forms
+var Roles = []int{RoleOwner, RoleStaff, RoleReadOnly}
+
+// RoleNames holds a readable name for each role
+var RoleNames = map[int]string{
+	RoleOwner:    "Owner",
+	RoleStaff:    "Staff",
+	RoleReadOnly: "Read-only",
+}
+
+// ValidRole reports whether role is one of the defined roles
+func ValidRole(role int) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleCan reports whether users with role have the permission p
+func RoleCan(role int, p Permission) bool {
+	for _, perm := range rolePermissions[role] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
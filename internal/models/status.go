@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// ReservationStatus is the state of a reservation in its workflow
+type ReservationStatus string
+
+// states of a reservation, new reservations are requested
+const (
+	ReservationRequested  ReservationStatus = "requested"
+	ReservationConfirmed  ReservationStatus = "confirmed"
+	ReservationCheckedIn  ReservationStatus = "checked-in"
+	ReservationCheckedOut ReservationStatus = "checked-out"
+	ReservationCancelled  ReservationStatus = "cancelled"
+	ReservationNoShow     ReservationStatus = "no-show"
+)
+
+// ReservationStatuses lists all states in the order of the workflow
+var ReservationStatuses = []ReservationStatus{
+	ReservationRequested,
+	ReservationConfirmed,
+	ReservationCheckedIn,
+	ReservationCheckedOut,
+	ReservationCancelled,
+	ReservationNoShow,
+}
+
+// reservationStatusNames holds a readable name for each state
+var reservationStatusNames = map[ReservationStatus]string{
+	ReservationRequested:  "Requested",
+	ReservationConfirmed:  "Confirmed",
+	ReservationCheckedIn:  "Checked in",
+	ReservationCheckedOut: "Checked out",
+	ReservationCancelled:  "Cancelled",
+	ReservationNoShow:     "No-show",
+}
+
+// reservationTransitions maps each state to the states a reservation can change to from it.
+// Checked out, cancelled and no-show are final.
+var reservationTransitions = map[ReservationStatus][]ReservationStatus{
+	ReservationRequested: {ReservationConfirmed, ReservationCancelled},
+	ReservationConfirmed: {ReservationCheckedIn, ReservationCancelled, ReservationNoShow},
+	ReservationCheckedIn: {ReservationCheckedOut},
+}
+
+// Valid reports whether s is a known state
+func (s ReservationStatus) Valid() bool {
+	_, ok := reservationStatusNames[s]
+	return ok
+}
+
+// Name returns the readable name of a state, e.g. Checked in
+func (s ReservationStatus) Name() string {
+	if name, ok := reservationStatusNames[s]; ok {
+		return name
+	}
+	return string(s)
+}
+
+// Next returns the states a reservation can change to from s
+func (s ReservationStatus) Next() []ReservationStatus {
+	return reservationTransitions[s]
+}
+
+// CanBecome reports whether a reservation can change from s to next
+func (s ReservationStatus) CanBecome(next ReservationStatus) bool {
+	for _, n := range reservationTransitions[s] {
+		if n == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ReservationStatusChange is an entry of the status history of a reservation. UserID is the user
+// who made the change, 0 for changes made by the guest.
+type ReservationStatusChange struct {
+	ID            int
+	ReservationID int
+	FromStatus    ReservationStatus
+	ToStatus      ReservationStatus
+	UserID        int
+	Reason        string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	User          User
+}
@@ -14,4 +14,10 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	UserRole        int
+}
+
+// Can reports whether the logged in user has the permission p, e.g. {{if .Can "delete-reservations"}}
+func (td *TemplateData) Can(p Permission) bool {
+	return RoleCan(td.UserRole, p)
 }
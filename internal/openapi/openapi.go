@@ -0,0 +1,16 @@
+package openapi
+
+import (
+	_ "embed"
+)
+
+// spec is the OpenAPI 3 document of the json api. It has to be updated with the api routes,
+// cmd/web tests fail for routes missing in it.
+//
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the OpenAPI document of the json api
+func Spec() []byte {
+	return spec
+}
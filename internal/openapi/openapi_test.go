@@ -0,0 +1,36 @@
+package openapi
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSpec(t *testing.T) {
+	var doc struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components map[string]map[string]interface{} `json:"components"`
+	}
+
+	err := json.Unmarshal(Spec(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+	if len(doc.Paths) == 0 {
+		t.Error("expected paths in the document")
+	}
+
+	// every reference has to point to a component
+	refs := regexp.MustCompile(`"\$ref":\s*"#/components/(\w+)/(\w+)"`).FindAllStringSubmatch(string(Spec()), -1)
+	for _, ref := range refs {
+		if _, ok := doc.Components[ref[1]][ref[2]]; !ok {
+			t.Errorf("reference to missing component %s/%s", ref[1], ref[2])
+		}
+	}
+}
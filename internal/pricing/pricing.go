@@ -0,0 +1,220 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
+)
+
+// CurrencySymbol is put in front of formatted prices
+const CurrencySymbol = "€"
+
+// ErrInvalidDates is returned for stays without any night
+var ErrInvalidDates = errors.New("departure must be after arrival")
+
+// MaxNights is the longest stay which can be booked, it also limits the work done for a quote
+const MaxNights = 90
+
+// MaximumStayError is returned for stays longer than MaxNights
+type MaximumStayError struct {
+	MaxNights int
+}
+
+func (e *MaximumStayError) Error() string {
+	return fmt.Sprintf("the maximum stay is %d nights", e.MaxNights)
+}
+
+// MinimumStayError is returned for stays shorter than the minimum stay
+type MinimumStayError struct {
+	MinNights int
+}
+
+func (e *MinimumStayError) Error() string {
+	return fmt.Sprintf("the minimum stay is %d nights", e.MinNights)
+}
+
+// Night is the price of one night, Date is the day of arrival for this night
+type Night struct {
+	Date      time.Time
+	Rate      int
+	Surcharge int
+	Season    string
+}
+
+// Quote is the price of a stay in a bungalow, all prices are in cents
+type Quote struct {
+	BungalowID    int
+	StartDate     time.Time
+	EndDate       time.Time
+	Nights        []Night
+	Accommodation int
+	CleaningFee   int
+	Total         int
+	MinNights     int
+}
+
+// Calculate returns the price of a stay from start to the departure at end. A night in a season
+// costs the rate of the season, if there are several the one starting last wins. The weekend
+// surcharge is added to the nights from friday and saturday. The minimum stay is the longer one of
+// the bungalow and the season of the first night.
+func Calculate(b models.Bungalow, seasons []models.Season, start, end time.Time) (Quote, error) {
+	q := Quote{
+		BungalowID:  b.ID,
+		StartDate:   start,
+		EndDate:     end,
+		CleaningFee: b.CleaningFee,
+		MinNights:   b.MinNights,
+	}
+
+	if err := CheckStay(start, end); err != nil {
+		return q, err
+	}
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		n := Night{Date: d, Rate: b.NightlyRate}
+
+		if s, ok := seasonOf(seasons, d); ok {
+			n.Season = s.Name
+			if s.NightlyRate > 0 {
+				n.Rate = s.NightlyRate
+			}
+			if d.Equal(start) && s.MinNights > q.MinNights {
+				q.MinNights = s.MinNights
+			}
+		}
+
+		if d.Weekday() == time.Friday || d.Weekday() == time.Saturday {
+			n.Surcharge = b.WeekendSurcharge
+		}
+
+		q.Nights = append(q.Nights, n)
+		q.Accommodation += n.Rate + n.Surcharge
+	}
+
+	if len(q.Nights) < q.MinNights {
+		return q, &MinimumStayError{MinNights: q.MinNights}
+	}
+
+	q.Total = q.Accommodation + q.CleaningFee
+
+	return q, nil
+}
+
+// CheckStay returns ErrInvalidDates for a stay from start to end without any night and a
+// *MaximumStayError for a stay longer than MaxNights
+func CheckStay(start, end time.Time) error {
+	if !end.After(start) {
+		return ErrInvalidDates
+	}
+	if end.After(start.AddDate(0, 0, MaxNights)) {
+		return &MaximumStayError{MaxNights: MaxNights}
+	}
+	return nil
+}
+
+// seasonOf returns the season which applies to the night starting on day d
+func seasonOf(seasons []models.Season, d time.Time) (models.Season, bool) {
+	var found models.Season
+	ok := false
+
+	for _, s := range seasons {
+		if d.Before(s.StartDate) || d.After(s.EndDate) {
+			continue
+		}
+		if !ok || s.StartDate.After(found.StartDate) {
+			found = s
+			ok = true
+		}
+	}
+
+	return found, ok
+}
+
+// Service calculates quotes with the rates stored in the database
+type Service struct {
+	DB repository.DatabaseRepo
+}
+
+// NewService returns a pricing service using db
+func NewService(db repository.DatabaseRepo) *Service {
+	return &Service{DB: db}
+}
+
+// Quote returns the price of a stay in a bungalow from start to the departure at end
+func (s *Service) Quote(ctx context.Context, bungalowID int, start, end time.Time) (Quote, error) {
+	if err := CheckStay(start, end); err != nil {
+		return Quote{}, err
+	}
+
+	b, err := s.DB.GetBungalowByID(ctx, bungalowID)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	seasons, err := s.DB.SeasonsForBungalow(ctx, bungalowID, start, end)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Calculate(b, seasons, start, end)
+}
+
+// FormatPrice formats cents like €1,234.50
+func FormatPrice(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	units := strconv.Itoa(cents / 100)
+	var b strings.Builder
+	for i, c := range units {
+		if i > 0 && (len(units)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+
+	return fmt.Sprintf("%s%s%s.%02d", sign, CurrencySymbol, b.String(), cents%100)
+}
+
+// ParsePrice parses an amount like 1234.5 or 1,234.50 into cents, negative amounts are invalid
+func ParsePrice(s string) (int, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), CurrencySymbol)), ",", "")
+	if s == "" {
+		return 0, errors.New("price is empty")
+	}
+
+	units, fraction, hasFraction := strings.Cut(s, ".")
+	if units == "" {
+		units = "0"
+	}
+
+	u, err := strconv.Atoi(units)
+	if err != nil || u < 0 || strings.HasPrefix(units, "+") {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+
+	c := 0
+	if hasFraction {
+		if len(fraction) == 0 || len(fraction) > 2 {
+			return 0, fmt.Errorf("invalid price %q", s)
+		}
+		if len(fraction) == 1 {
+			fraction += "0"
+		}
+		c, err = strconv.Atoi(fraction)
+		if err != nil || c < 0 || strings.HasPrefix(fraction, "+") {
+			return 0, fmt.Errorf("invalid price %q", s)
+		}
+	}
+
+	return u*100 + c, nil
+}
@@ -0,0 +1,138 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/config"
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository/dbrepo"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+var testBungalow = models.Bungalow{ID: 1, NightlyRate: 10000, WeekendSurcharge: 2000, CleaningFee: 5000, MinNights: 2}
+
+var testSeasons = []models.Season{
+	{Name: "Summer", StartDate: date(2030, 7, 1), EndDate: date(2030, 8, 31), NightlyRate: 15000, MinNights: 7},
+	{Name: "Festival", StartDate: date(2030, 7, 10), EndDate: date(2030, 7, 12), NightlyRate: 25000},
+	{Name: "Christmas", StartDate: date(2030, 12, 20), EndDate: date(2030, 12, 27), MinNights: 5},
+}
+
+// 2030-01-07 is a monday, 2030-01-11 a friday
+var calculateTests = []struct {
+	name          string
+	start, end    time.Time
+	expectedTotal int
+	expectedErr   error
+}{
+	{"weekdays", date(2030, 1, 7), date(2030, 1, 10), 3*10000 + 5000, nil},
+	{"weekend", date(2030, 1, 10), date(2030, 1, 14), 4*10000 + 2*2000 + 5000, nil},
+	{"season", date(2030, 7, 1), date(2030, 7, 8), 7*15000 + 2*2000 + 5000, nil},
+	{"season-inside-season", date(2030, 7, 8), date(2030, 7, 15), 4*15000 + 3*25000 + 2*2000 + 5000, nil},
+	{"into-season", date(2030, 6, 28), date(2030, 7, 2), 3*10000 + 15000 + 2*2000 + 5000, nil},
+	{"season-without-rate", date(2030, 12, 20), date(2030, 12, 25), 5*10000 + 2*2000 + 5000, nil},
+	{"minimum-stay", date(2030, 1, 7), date(2030, 1, 8), 0, &MinimumStayError{MinNights: 2}},
+	{"minimum-stay-of-season", date(2030, 7, 1), date(2030, 7, 4), 0, &MinimumStayError{MinNights: 7}},
+	{"departure-before-arrival", date(2030, 1, 7), date(2030, 1, 7), 0, ErrInvalidDates},
+	{"maximum-stay", date(2030, 1, 7), date(2030, 1, 7).AddDate(0, 0, MaxNights), MaxNights*10000 + 26*2000 + 5000, nil},
+	{"longer-than-maximum-stay", date(2030, 1, 7), date(2030, 1, 8).AddDate(0, 0, MaxNights), 0, &MaximumStayError{MaxNights: MaxNights}},
+	{"centuries", date(1, 1, 1), date(9999, 12, 31), 0, &MaximumStayError{MaxNights: MaxNights}},
+}
+
+func TestCalculate(t *testing.T) {
+	for _, e := range calculateTests {
+		q, err := Calculate(testBungalow, testSeasons, e.start, e.end)
+
+		var minStay *MinimumStayError
+		var maxStay *MaximumStayError
+		switch want := e.expectedErr.(type) {
+		case nil:
+			if err != nil {
+				t.Errorf("failed %s: unexpected error %s", e.name, err)
+				continue
+			}
+		case *MinimumStayError:
+			if !errors.As(err, &minStay) || minStay.MinNights != want.MinNights {
+				t.Errorf("failed %s: expected minimum stay of %d, got %v", e.name, want.MinNights, err)
+			}
+			continue
+		case *MaximumStayError:
+			if !errors.As(err, &maxStay) || maxStay.MaxNights != want.MaxNights {
+				t.Errorf("failed %s: expected maximum stay of %d, got %v", e.name, want.MaxNights, err)
+			}
+			continue
+		default:
+			if !errors.Is(err, want) {
+				t.Errorf("failed %s: expected %v, got %v", e.name, want, err)
+			}
+			continue
+		}
+
+		if q.Total != e.expectedTotal {
+			t.Errorf("failed %s: expected total %d, got %d", e.name, e.expectedTotal, q.Total)
+		}
+		if len(q.Nights) != int(e.end.Sub(e.start).Hours()/24) {
+			t.Errorf("failed %s: unexpected number of nights %d", e.name, len(q.Nights))
+		}
+	}
+}
+
+func TestService_Quote(t *testing.T) {
+	s := NewService(dbrepo.NewTestingRepo(&config.AppConfig{}))
+
+	// case #1: the summer season of the test repository applies
+	q, err := s.Quote(context.Background(), 1, date(2030, 7, 1), date(2030, 7, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Nights[0].Season != "Summer" || q.Nights[0].Rate != 15000 {
+		t.Errorf("expected summer rate, got %+v", q.Nights[0])
+	}
+
+	// case #2: unknown bungalow
+	_, err = s.Quote(context.Background(), 4, date(2030, 1, 1), date(2030, 1, 5))
+	if err == nil {
+		t.Error("expected an error for an unknown bungalow")
+	}
+}
+
+func TestFormatPrice(t *testing.T) {
+	for cents, expected := range map[int]string{
+		0:         "€0.00",
+		5:         "€0.05",
+		12050:     "€120.50",
+		123456789: "€1,234,567.89",
+		-1500:     "-€15.00",
+	} {
+		if got := FormatPrice(cents); got != expected {
+			t.Errorf("expected %s for %d, got %s", expected, cents, got)
+		}
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	for s, expected := range map[string]int{
+		"120":       12000,
+		"120.5":     12050,
+		"120.05":    12005,
+		"€1,234.50": 123450,
+		".5":        50,
+		" 89 ":      8900,
+	} {
+		got, err := ParsePrice(s)
+		if err != nil || got != expected {
+			t.Errorf("expected %d for %q, got %d (%v)", expected, s, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "-5", "12.345", "twelve", "1.x", "+5", "1."} {
+		if _, err := ParsePrice(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
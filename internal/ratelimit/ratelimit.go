@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows a number of events per key within a time window, e.g. requests per ip address.
+// The counts are kept in memory, so they are lost on restart and not shared between instances.
+type Limiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// window counts the events of a key since start
+type window struct {
+	start time.Time
+	count int
+}
+
+// New returns a limiter allowing limit events per key within period
+func New(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		window:  period,
+		now:     time.Now,
+		windows: map[string]*window{},
+	}
+}
+
+// Allow counts an event for key and reports whether it is within the limit
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.removeExpired(now)
+
+	w, ok := l.windows[key]
+	if !ok {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.limit {
+		return false
+	}
+
+	w.count++
+	return true
+}
+
+// removeExpired forgets all windows which have ended, so the map doesn't grow forever
+func (l *Limiter) removeExpired(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+}
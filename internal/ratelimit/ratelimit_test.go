@@ -0,0 +1,34 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2038, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	l := New(2, time.Hour)
+	l.now = func() time.Time { return now }
+
+	// case #1: events within the limit
+	if !l.Allow("patrick") || !l.Allow("patrick") {
+		t.Error("expected the first two events to be allowed")
+	}
+
+	// case #2: limit reached
+	if l.Allow("patrick") {
+		t.Error("expected the third event to be denied")
+	}
+
+	// case #3: other keys are counted separately
+	if !l.Allow("sandy") {
+		t.Error("expected an event of another key to be allowed")
+	}
+
+	// case #4: new window
+	now = now.Add(time.Hour)
+	if !l.Allow("patrick") {
+		t.Error("expected an event in a new window to be allowed")
+	}
+}
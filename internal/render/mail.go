@@ -0,0 +1,141 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/jagottsicher/myGoWebApplication/internal/models"
+)
+
+var pathToMailTemplates = "./static/email/templates"
+
+// Mail renders the html and plain text content of an e-mail from the template named in m.Template,
+// e.g. "reservation-guest" uses reservation-guest-mail.html and reservation-guest-mail.txt.
+// A message without template is returned unchanged.
+func Mail(m models.MailData) (models.MailData, error) {
+	if m.Template == "" {
+		return m, nil
+	}
+
+	htmlCache, textCache := app.MailTemplateCache, app.MailTextTemplateCache
+	if !app.UseCache {
+		var err error
+		htmlCache, textCache, err = CreateMailTemplateCache()
+		if err != nil {
+			return m, err
+		}
+	}
+
+	t, ok := htmlCache[m.Template]
+	if !ok {
+		return m, fmt.Errorf("e-mail template %s not in cache", m.Template)
+	}
+
+	buf := new(bytes.Buffer)
+	err := t.Execute(buf, m.Data)
+	if err != nil {
+		return m, err
+	}
+	m.Content = buf.String()
+
+	// the plain text alternative is optional
+	if tt, ok := textCache[m.Template]; ok {
+		buf.Reset()
+		err = tt.Execute(buf, m.Data)
+		if err != nil {
+			return m, err
+		}
+		m.TextContent = strings.TrimSpace(buf.String())
+	}
+
+	return m, nil
+}
+
+// CreateMailTemplateCache creates the caches for the html and plain text e-mail templates.
+// Files *-mail.html and *-mail.txt are the e-mails, all other *.html and *.txt files are their layouts.
+func CreateMailTemplateCache() (map[string]*template.Template, map[string]*texttemplate.Template, error) {
+	htmlCache := map[string]*template.Template{}
+	textCache := map[string]*texttemplate.Template{}
+
+	htmlLayouts, err := mailLayouts("html")
+	if err != nil {
+		return htmlCache, textCache, err
+	}
+
+	mails, err := filepath.Glob(fmt.Sprintf("%s/*-mail.html", pathToMailTemplates))
+	if err != nil {
+		return htmlCache, textCache, err
+	}
+
+	for _, mail := range mails {
+		name := strings.TrimSuffix(filepath.Base(mail), "-mail.html")
+
+		// layouts are parsed first, so the blocks defined in the e-mail replace their defaults
+		ts := template.New(name).Funcs(functions)
+		if len(htmlLayouts) > 0 {
+			ts, err = ts.ParseFiles(htmlLayouts...)
+			if err != nil {
+				return htmlCache, textCache, err
+			}
+		}
+
+		ts, err = ts.ParseFiles(mail)
+		if err != nil {
+			return htmlCache, textCache, err
+		}
+
+		htmlCache[name] = ts.Lookup(filepath.Base(mail))
+	}
+
+	textLayouts, err := mailLayouts("txt")
+	if err != nil {
+		return htmlCache, textCache, err
+	}
+
+	mails, err = filepath.Glob(fmt.Sprintf("%s/*-mail.txt", pathToMailTemplates))
+	if err != nil {
+		return htmlCache, textCache, err
+	}
+
+	for _, mail := range mails {
+		name := strings.TrimSuffix(filepath.Base(mail), "-mail.txt")
+
+		ts := texttemplate.New(name).Funcs(texttemplate.FuncMap(functions))
+		if len(textLayouts) > 0 {
+			ts, err = ts.ParseFiles(textLayouts...)
+			if err != nil {
+				return htmlCache, textCache, err
+			}
+		}
+
+		ts, err = ts.ParseFiles(mail)
+		if err != nil {
+			return htmlCache, textCache, err
+		}
+
+		textCache[name] = ts.Lookup(filepath.Base(mail))
+	}
+
+	return htmlCache, textCache, nil
+}
+
+// mailLayouts returns all e-mail layout files with the given extension
+func mailLayouts(ext string) ([]string, error) {
+	files, err := filepath.Glob(fmt.Sprintf("%s/*.%s", pathToMailTemplates, ext))
+	if err != nil {
+		return nil, err
+	}
+
+	var layouts []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, "-mail."+ext) {
+			layouts = append(layouts, f)
+		}
+	}
+
+	return layouts, nil
+}
@@ -8,10 +8,12 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/jagottsicher/myGoWebApplication/internal/config"
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/pricing"
 	"github.com/justinas/nosurf"
 )
 
@@ -20,6 +22,8 @@ var functions = template.FuncMap{
 	"formatDate":        FormatDate,
 	"iterate":           Iterate,
 	"add":               Add,
+	"formatPrice":       pricing.FormatPrice,
+	"paragraphs":        Paragraphs,
 }
 
 // HumanReadableDate returns a time value in the YYYY-MM-DD format
@@ -47,6 +51,17 @@ func Add(a, b int) int {
 	return a + b
 }
 
+// Paragraphs splits a text into the paragraphs separated by blank lines
+func Paragraphs(text string) []string {
+	var p []string
+	for _, s := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if s = strings.TrimSpace(s); s != "" {
+			p = append(p, s)
+		}
+	}
+	return p
+}
+
 // AddDefaultData contains Data which will be added to data sent to templates
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
 	td.Success = app.Session.PopString(r.Context(), "success")
@@ -55,6 +70,7 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.CSRFToken = nosurf.Token(r)
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
+		td.UserRole = app.Session.GetInt(r.Context(), "user_role")
 	}
 	return td
 }
@@ -2,6 +2,7 @@ package render
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
@@ -77,3 +78,61 @@ func TestCreateTemplateCache(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestMail(t *testing.T) {
+	pathToMailTemplates = "./../../static/email/templates"
+
+	mtc, mttc, err := CreateMailTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.MailTemplateCache = mtc
+	app.MailTextTemplateCache = mttc
+	app.UseCache = true
+
+	data := make(map[string]interface{})
+	data["reservation"] = models.Reservation{
+		FullName: "Patrick Star",
+		Bungalow: models.Bungalow{BungalowName: "The Solitude Shack"},
+	}
+	data["link"] = "https://bikini-bottom.ocean/my-reservation?token=secret"
+
+	m, err := Mail(models.MailData{Template: "reservation-guest", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(m.Content, "Patrick Star") || !strings.Contains(m.Content, "<html") {
+		t.Error("html content of e-mail not rendered into layout")
+	}
+
+	if !strings.Contains(m.TextContent, "Patrick Star") || strings.Contains(m.TextContent, "<") {
+		t.Error("plain text content of e-mail not rendered")
+	}
+
+	if !strings.Contains(m.TextContent, "/my-reservation?token=secret") {
+		t.Error("link to the reservation missing in e-mail")
+	}
+
+	_, err = Mail(models.MailData{Template: "does-not-exist", Data: data})
+	if err == nil {
+		t.Error("expected an error for a not existing e-mail template")
+	}
+
+	m, err = Mail(models.MailData{Content: "no template"})
+	if err != nil || m.Content != "no template" {
+		t.Error("e-mail without template should be returned unchanged")
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	p := Paragraphs("First paragraph\nstill the first.\r\n\r\nSecond one.\n\n\n\nThird one.\n")
+	if len(p) != 3 || p[0] != "First paragraph\nstill the first." || p[2] != "Third one." {
+		t.Errorf("unexpected paragraphs %q", p)
+	}
+
+	if len(Paragraphs("  ")) != 0 {
+		t.Error("expected no paragraphs for an empty text")
+	}
+}
@@ -1,12 +1,22 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	"github.com/jagottsicher/myGoWebApplication/internal/config"
 	"github.com/jagottsicher/myGoWebApplication/internal/repository"
 )
 
+// execer is implemented by *sql.DB and *sql.Tx, so statements can be run inside or outside a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// defaultQueryTimeout is used if no timeout for database queries is configured
+const defaultQueryTimeout = 3 * time.Second
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
@@ -19,6 +29,16 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 	}
 }
 
+// withTimeout derives a context from ctx which is cancelled after the configured query timeout
+func (m *postgresDBRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := m.App.DBTimeout
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
 type testDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
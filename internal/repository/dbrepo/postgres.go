@@ -2,31 +2,38 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
-	return true
-}
+// passwordCost is the bcrypt cost for hashing passwords
+const passwordCost = 12
+
+// uniqueViolation is the postgres error code for a violated unique index
+const uniqueViolation = "23505"
 
 // InsertReservation stores a reservation in the database
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *postgresDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var newID int
 
 	stmt := `
 		insert into reservations 
-			(full_name, email, phone, start_date, end_date, bungalow_id, created_at, updated_at)
+			(full_name, email, phone, start_date, end_date, bungalow_id, total_price, adults, children, created_at, updated_at)
 		values
-			($1, $2, $3, $4, $5, $6, $7, $8) returning id
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id
 	`
 
 	err := m.DB.QueryRowContext(ctx, stmt,
@@ -36,6 +43,9 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.BungalowID,
+		res.TotalPrice,
+		res.Adults,
+		res.Children,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -48,9 +58,9 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 }
 
 // InsertBungalowRestriction places a restriction in the database
-func (m *postgresDBRepo) InsertBungalowRestriction(r models.BungalowRestriction) error {
+func (m *postgresDBRepo) InsertBungalowRestriction(ctx context.Context, r models.BungalowRestriction) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	stmt := `
@@ -77,10 +87,117 @@ func (m *postgresDBRepo) InsertBungalowRestriction(r models.BungalowRestriction)
 	return nil
 }
 
+// BookReservation stores a reservation, the matching bungalow restriction and the e-mails about it in one transaction.
+// The bungalow row is locked while checking availability, so two concurrent bookings
+// for the same bungalow cannot both succeed. Returns repository.ErrNotAvailable if the
+// requested dates have been taken in the meantime.
+func (m *postgresDBRepo) BookReservation(ctx context.Context, res models.Reservation, mails []models.MailData) (int, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// lock the bungalow so concurrent bookings for it are serialized
+	var bungalowID int
+	err = tx.QueryRowContext(ctx, `select id from bungalows where id = $1 for update`, res.BungalowID).Scan(&bungalowID)
+	if err != nil {
+		return 0, err
+	}
+
+	var numRows int
+
+	query := `
+		select
+			count(id)
+		from
+			bungalow_restrictions
+		where
+			bungalow_id = $1
+			and $2 <= end_date and $3 >= start_date;
+	`
+
+	err = tx.QueryRowContext(ctx, query, res.BungalowID, res.StartDate, res.EndDate).Scan(&numRows)
+	if err != nil {
+		return 0, err
+	}
+
+	if numRows > 0 {
+		return 0, repository.ErrNotAvailable
+	}
+
+	var newID int
+
+	stmt := `
+		insert into reservations
+			(full_name, email, phone, start_date, end_date, bungalow_id, total_price, adults, children, access_token_hash, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id
+	`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FullName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.BungalowID,
+		res.TotalPrice,
+		res.Adults,
+		res.Children,
+		res.AccessTokenHash,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `
+		insert into bungalow_restrictions
+			(start_date, end_date, bungalow_id, reservation_id, created_at, updated_at, restriction_id)
+		values
+			($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		res.StartDate,
+		res.EndDate,
+		res.BungalowID,
+		newID,
+		time.Now(),
+		time.Now(),
+		models.RestrictionReservation,
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, mail := range mails {
+		err = insertMail(ctx, tx, mail)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
 // SearchAvailabilityByDatesByBungalowID returns true if there is availablity for a bungalowID for a date range, false if not
-func (m *postgresDBRepo) SearchAvailabilityByDatesByBungalowID(start, end time.Time, bungalowID int) (bool, error) {
+func (m *postgresDBRepo) SearchAvailabilityByDatesByBungalowID(ctx context.Context, start, end time.Time, bungalowID int) (bool, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var numRows int
@@ -108,30 +225,32 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByBungalowID(start, end time.T
 	return false, nil
 }
 
-// SearchAvailabilityByDatesForAllBungalows returns a slice of available bungalows, if any for a queried date range
-func (m *postgresDBRepo) SearchAvailabilityByDatesForAllBungalows(start, end time.Time) ([]models.Bungalow, error) {
+// SearchAvailabilityByDatesForAllBungalows returns a slice of available bungalows with room for
+// the number of guests, if any for a queried date range
+func (m *postgresDBRepo) SearchAvailabilityByDatesForAllBungalows(ctx context.Context, start, end time.Time, guests int) ([]models.Bungalow, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var bungalows []models.Bungalow
 
 	query := `
 		select 
-			b.id, b.bungalow_name
+			b.id, b.bungalow_name, b.max_guests, b.beds
 		from
 			bungalows b 
-		where b.id not in 
+		where b.max_guests >= $3 and b.id not in 
 			(select 
 				bungalow_id
 			from
 				bungalow_restrictions br
 			where 
 			$1 <= br.end_date and $2 >= br.start_date
-			);
+			)
+		order by b.max_guests, b.id;
 	`
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	rows, err := m.DB.QueryContext(ctx, query, start, end, guests)
 	if err != nil {
 		return bungalows, err
 	}
@@ -142,6 +261,8 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesForAllBungalows(start, end tim
 		err := rows.Scan(
 			&bungalow.ID,
 			&bungalow.BungalowName,
+			&bungalow.MaxGuests,
+			&bungalow.Beds,
 		)
 		if err != nil {
 			return bungalows, err
@@ -157,242 +278,1319 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesForAllBungalows(start, end tim
 	return bungalows, nil
 }
 
+// bungalowColumns are the columns read by scanBungalow
+const bungalowColumns = `id, bungalow_name, slug, description, amenities, nightly_rate, weekend_surcharge,
+	cleaning_fee, min_nights, max_guests, beds, created_at, updated_at`
+
+// scanBungalow reads the bungalowColumns of a row into b, amenities are stored one per line
+func scanBungalow(row interface{ Scan(...interface{}) error }, b *models.Bungalow) error {
+	var amenities string
+
+	err := row.Scan(
+		&b.ID,
+		&b.BungalowName,
+		&b.Slug,
+		&b.Description,
+		&amenities,
+		&b.NightlyRate,
+		&b.WeekendSurcharge,
+		&b.CleaningFee,
+		&b.MinNights,
+		&b.MaxGuests,
+		&b.Beds,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	b.Amenities = splitLines(amenities)
+
+	return nil
+}
+
+// splitLines returns the non-empty lines of s
+func splitLines(s string) []string {
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
 // GetBungalowByID gets a bungalow by id
-func (m *postgresDBRepo) GetBungalowByID(id int) (models.Bungalow, error) {
+func (m *postgresDBRepo) GetBungalowByID(ctx context.Context, id int) (models.Bungalow, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var bungalow models.Bungalow
 
-	query := `
-	select 
-		id, bungalow_name, created_at, updated_at
-	from
-		bungalows
-	where
-		id = $1
-	`
+	query := `select ` + bungalowColumns + ` from bungalows where id = $1`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&bungalow.ID,
-		&bungalow.BungalowName,
-		&bungalow.CreatedAt,
-		&bungalow.UpdatedAt,
-	)
+	err := scanBungalow(m.DB.QueryRowContext(ctx, query, id), &bungalow)
+	return bungalow, err
+}
 
-	if err != nil {
-		return bungalow, err
-	}
+// GetBungalowBySlug gets a bungalow by the slug used in its url
+func (m *postgresDBRepo) GetBungalowBySlug(ctx context.Context, slug string) (models.Bungalow, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var bungalow models.Bungalow
+
+	query := `select ` + bungalowColumns + ` from bungalows where slug = $1`
 
-	return bungalow, nil
+	err := scanBungalow(m.DB.QueryRowContext(ctx, query, slug), &bungalow)
+	return bungalow, err
 }
 
-// GetUserByID returns user data by id
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
+// InsertBungalow adds a bungalow and returns its id, repository.ErrDuplicateSlug is returned if the slug is taken
+func (m *postgresDBRepo) InsertBungalow(ctx context.Context, b models.Bungalow) (int, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `select id, full_name, email, password, role, created_at, updated_at
-	from users where id = $1
-	`
-	row := m.DB.QueryRowContext(ctx, query, id)
+	var newID int
 
-	var u models.User
-	err := row.Scan(
-		&u.ID,
-		&u.FullName,
-		&u.Email,
-		&u.Password,
-		&u.Role,
-		&u.CreatedAt,
-		&u.UpdatedAt,
-	)
+	stmt := `
+		insert into bungalows (bungalow_name, slug, description, amenities, nightly_rate, weekend_surcharge,
+			cleaning_fee, min_nights, max_guests, beds, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id
+	`
 
-	if err != nil {
-		return u, err
-	}
+	err := m.DB.QueryRowContext(ctx, stmt,
+		b.BungalowName,
+		b.Slug,
+		b.Description,
+		strings.Join(b.Amenities, "\n"),
+		b.NightlyRate,
+		b.WeekendSurcharge,
+		b.CleaningFee,
+		b.MinNights,
+		b.MaxGuests,
+		b.Beds,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
 
-	return u, nil
+	return newID, uniqueSlug(err)
 }
 
-// UpdateUser updates basic user data in the database
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
+// UpdateBungalow updates all data of a bungalow, repository.ErrDuplicateSlug is returned if the slug is taken
+func (m *postgresDBRepo) UpdateBungalow(ctx context.Context, b models.Bungalow) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `
-		update users set full_name = $1, email = $2, role = $3, updated_at = $4
-`
-	_, err := m.DB.ExecContext(ctx, query,
-		u.FullName,
-		u.Email,
-		u.Role,
+	stmt := `
+		update bungalows set bungalow_name = $1, slug = $2, description = $3, amenities = $4,
+			nightly_rate = $5, weekend_surcharge = $6, cleaning_fee = $7, min_nights = $8, max_guests = $9,
+			beds = $10, updated_at = $11
+		where id = $12
+	`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		b.BungalowName,
+		b.Slug,
+		b.Description,
+		strings.Join(b.Amenities, "\n"),
+		b.NightlyRate,
+		b.WeekendSurcharge,
+		b.CleaningFee,
+		b.MinNights,
+		b.MaxGuests,
+		b.Beds,
 		time.Now(),
+		b.ID,
 	)
 
-	if err != nil {
-		return err
-	}
+	return uniqueSlug(err)
+}
 
-	return nil
+// uniqueSlug translates the violation of the unique index on bungalows.slug to repository.ErrDuplicateSlug
+func uniqueSlug(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return repository.ErrDuplicateSlug
+	}
+	return err
 }
 
-// Authenticate authenticates a user by data
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+// DeleteBungalow deletes a bungalow together with its restrictions, seasons, calendars and images. A bungalow
+// with reservations isn't deleted, repository.ErrBungalowInUse is returned instead.
+func (m *postgresDBRepo) DeleteBungalow(ctx context.Context, id int) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var id int
-	var passwordHash string
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
 
-	row := m.DB.QueryRowContext(ctx, "select id, password from users where email =$1", email)
+	// the bungalow is locked, so no reservation can be added while checking
+	var lockedID int
+	err = tx.QueryRowContext(ctx, `select id from bungalows where id = $1 for update`, id).Scan(&lockedID)
+	if err != nil {
+		return err
+	}
 
-	err := row.Scan(&id, &passwordHash)
+	var reservations int
+	err = tx.QueryRowContext(ctx, `select count(*) from reservations where bungalow_id = $1`, id).Scan(&reservations)
 	if err != nil {
-		return id, "", err
+		return err
+	}
+	if reservations > 0 {
+		return repository.ErrBungalowInUse
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(testPassword))
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return 0, "", errors.New("wrong password")
-	} else if err != nil {
-		return 0, "", err
+	_, err = tx.ExecContext(ctx, `delete from bungalows where id = $1`, id)
+	if err != nil {
+		return err
 	}
 
-	return id, passwordHash, nil
+	return tx.Commit()
 }
 
-// AllReservations builds and returns a slice of all reservations from the database
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+// UpdateBungalowRates updates the nightly rate, weekend surcharge, cleaning fee and minimum stay of a bungalow
+func (m *postgresDBRepo) UpdateBungalowRates(ctx context.Context, b models.Bungalow) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var reservations []models.Reservation
-
-	query := `
-		select r.id, r.full_name, r.email, r.phone, r.start_date, 
-		r.end_date, r.bungalow_id, r.created_at, r.updated_at, r.status,
-		b.id, b.bungalow_name
-		from reservations r
-		left join bungalows b on (r.bungalow_id = b.id)
-		order by r.start_date asc
+	stmt := `
+		update bungalows set nightly_rate = $1, weekend_surcharge = $2, cleaning_fee = $3, min_nights = $4, updated_at = $5
+		where id = $6
 	`
 
-	rows, err := m.DB.QueryContext(ctx, query)
-	if err != nil {
-		return reservations, err
-	}
-	defer rows.Close()
+	_, err := m.DB.ExecContext(ctx, stmt,
+		b.NightlyRate,
+		b.WeekendSurcharge,
+		b.CleaningFee,
+		b.MinNights,
+		time.Now(),
+		b.ID,
+	)
+	return err
+}
 
-	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FullName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.BungalowID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Status,
-			&i.Bungalow.ID,
-			&i.Bungalow.BungalowName,
-		)
+// BungalowImages returns the images of a bungalow in the order they are shown
+func (m *postgresDBRepo) BungalowImages(ctx context.Context, bungalowID int) ([]models.BungalowImage, error) {
 
-		if err != nil {
-			return reservations, err
-		}
-		reservations = append(reservations, i)
-	}
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
 
-	if err = rows.Err(); err != nil {
-		return reservations, err
-	}
+	query := `
+		select id, bungalow_id, file_name, caption, sort_order, created_at, updated_at
+		from bungalow_images
+		where bungalow_id = $1
+		order by sort_order, id
+	`
 
-	return reservations, nil
+	return m.queryBungalowImages(ctx, query, bungalowID)
 }
 
-// AllNewReservations builds and returns a slice of all new reservations from the database
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
+// AllBungalowImages returns the images of all bungalows ordered by bungalow and the order they are shown
+func (m *postgresDBRepo) AllBungalowImages(ctx context.Context) ([]models.BungalowImage, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var reservations []models.Reservation
-
 	query := `
-		select r.id, r.full_name, r.email, r.phone, r.start_date, 
-		r.end_date, r.bungalow_id, r.created_at, r.updated_at, r.status,
-		b.id, b.bungalow_name
-		from reservations r
-		left join bungalows b on (r.bungalow_id = b.id)
-		where status = 0
-		order by r.start_date asc
+		select id, bungalow_id, file_name, caption, sort_order, created_at, updated_at
+		from bungalow_images
+		order by bungalow_id, sort_order, id
 	`
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	return m.queryBungalowImages(ctx, query)
+}
+
+// queryBungalowImages returns the images selected by query
+func (m *postgresDBRepo) queryBungalowImages(ctx context.Context, query string, args ...any) ([]models.BungalowImage, error) {
+	var images []models.BungalowImage
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return reservations, err
+		return images, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var i models.Reservation
+		var img models.BungalowImage
 		err := rows.Scan(
-			&i.ID,
-			&i.FullName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.BungalowID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Status,
-			&i.Bungalow.ID,
-			&i.Bungalow.BungalowName,
+			&img.ID,
+			&img.BungalowID,
+			&img.FileName,
+			&img.Caption,
+			&img.SortOrder,
+			&img.CreatedAt,
+			&img.UpdatedAt,
 		)
-
 		if err != nil {
-			return reservations, err
+			return images, err
 		}
-		reservations = append(reservations, i)
+		images = append(images, img)
 	}
 
 	if err = rows.Err(); err != nil {
-		return reservations, err
+		return images, err
 	}
 
-	return reservations, nil
+	return images, nil
 }
 
-// GetReservationByID returns a reservation by ID
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+// InsertBungalowImage adds an image after the other images of its bungalow and returns its id
+func (m *postgresDBRepo) InsertBungalowImage(ctx context.Context, img models.BungalowImage) (int, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var res models.Reservation
+	var newID int
 
-	query := `
-		select r.id, r.full_name, r.email, r.phone, r.start_date, 
-		r.end_date, r.bungalow_id, r.created_at, r.updated_at, r.status,
-		b.id, b.bungalow_name
-		from reservations r
-		left join bungalows b on (r.bungalow_id = b.id)
-		where r.id = $1
+	stmt := `
+		insert into bungalow_images (bungalow_id, file_name, caption, sort_order, created_at, updated_at)
+		values ($1, $2, $3,
+			(select coalesce(max(sort_order), 0) + 1 from bungalow_images where bungalow_id = $1),
+			$4, $5)
+		returning id
 	`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
+	err := m.DB.QueryRowContext(ctx, stmt,
+		img.BungalowID,
+		img.FileName,
+		img.Caption,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	return newID, err
+}
+
+// UpdateBungalowImages updates the captions and the order of images of a bungalow, images of other
+// bungalows are left unchanged
+func (m *postgresDBRepo) UpdateBungalowImages(ctx context.Context, bungalowID int, images []models.BungalowImage) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	stmt := `
+		update bungalow_images set caption = $1, sort_order = $2, updated_at = $3
+		where id = $4 and bungalow_id = $5
+	`
+
+	for _, img := range images {
+		_, err = tx.ExecContext(ctx, stmt, img.Caption, img.SortOrder, time.Now(), img.ID, bungalowID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteBungalowImage deletes an image and returns it, so its files can be removed.
+// sql.ErrNoRows is returned if there is no image with this id.
+func (m *postgresDBRepo) DeleteBungalowImage(ctx context.Context, id int) (models.BungalowImage, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var img models.BungalowImage
+
+	stmt := `
+		delete from bungalow_images where id = $1
+		returning id, bungalow_id, file_name, caption, sort_order, created_at, updated_at
+	`
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(
+		&img.ID,
+		&img.BungalowID,
+		&img.FileName,
+		&img.Caption,
+		&img.SortOrder,
+		&img.CreatedAt,
+		&img.UpdatedAt,
+	)
+
+	return img, err
+}
+
+// AllSeasons returns the seasons of all bungalows ordered by bungalow and start date
+func (m *postgresDBRepo) AllSeasons(ctx context.Context) ([]models.Season, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select s.id, s.bungalow_id, s.name, s.start_date, s.end_date, s.nightly_rate, s.min_nights,
+			s.created_at, s.updated_at, b.id, b.bungalow_name
+		from seasons s
+		left join bungalows b on (s.bungalow_id = b.id)
+		order by s.bungalow_id, s.start_date
+	`
+
+	return m.querySeasons(ctx, query)
+}
+
+// SeasonsForBungalow returns the seasons of a bungalow which overlap the nights from start to the departure at end
+func (m *postgresDBRepo) SeasonsForBungalow(ctx context.Context, bungalowID int, start, end time.Time) ([]models.Season, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select s.id, s.bungalow_id, s.name, s.start_date, s.end_date, s.nightly_rate, s.min_nights,
+			s.created_at, s.updated_at, b.id, b.bungalow_name
+		from seasons s
+		left join bungalows b on (s.bungalow_id = b.id)
+		where s.bungalow_id = $1 and s.start_date < $3 and s.end_date >= $2
+		order by s.start_date
+	`
+
+	return m.querySeasons(ctx, query, bungalowID, start, end)
+}
+
+// querySeasons returns the seasons selected by query
+func (m *postgresDBRepo) querySeasons(ctx context.Context, query string, args ...any) ([]models.Season, error) {
+	var seasons []models.Season
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return seasons, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.Season
+		err := rows.Scan(
+			&s.ID,
+			&s.BungalowID,
+			&s.Name,
+			&s.StartDate,
+			&s.EndDate,
+			&s.NightlyRate,
+			&s.MinNights,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+			&s.Bungalow.ID,
+			&s.Bungalow.BungalowName,
+		)
+		if err != nil {
+			return seasons, err
+		}
+		seasons = append(seasons, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return seasons, err
+	}
+
+	return seasons, nil
+}
+
+// InsertSeason stores a season and returns its id
+func (m *postgresDBRepo) InsertSeason(ctx context.Context, s models.Season) (int, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	stmt := `
+		insert into seasons (bungalow_id, name, start_date, end_date, nightly_rate, min_nights, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id
+	`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		s.BungalowID,
+		s.Name,
+		s.StartDate,
+		s.EndDate,
+		s.NightlyRate,
+		s.MinNights,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	return newID, err
+}
+
+// DeleteSeason deletes a season, sql.ErrNoRows is returned if it doesn't exist
+func (m *postgresDBRepo) DeleteSeason(ctx context.Context, id int) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from seasons where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetUserByID returns user data by id
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select id, full_name, email, password, role, active, created_at, updated_at,
+		totp_secret, totp_enabled, totp_last_counter
+	from users where id = $1
+	`
+	row := m.DB.QueryRowContext(ctx, query, id)
+
+	var u models.User
+	err := row.Scan(
+		&u.ID,
+		&u.FullName,
+		&u.Email,
+		&u.Password,
+		&u.Role,
+		&u.Active,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+		&u.TOTPSecret,
+		&u.TOTPEnabled,
+		&u.TOTPLastCounter,
+	)
+
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+// UpdateUser updates basic user data in the database
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		update users set full_name = $1, email = $2, role = $3, active = $4, updated_at = $5
+		where id = $6
+`
+	_, err := m.DB.ExecContext(ctx, query,
+		u.FullName,
+		u.Email,
+		u.Role,
+		u.Active,
+		time.Now(),
+		u.ID,
+	)
+
+	if err != nil {
+		return uniqueEmail(err)
+	}
+
+	return nil
+}
+
+// Authenticate authenticates a user by data
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+	var passwordHash string
+	var active bool
+
+	row := m.DB.QueryRowContext(ctx, "select id, password, active from users where lower(email) = lower($1)", email)
+
+	err := row.Scan(&id, &passwordHash, &active)
+	if err != nil {
+		return id, "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("wrong password")
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	if !active {
+		return 0, "", repository.ErrUserInactive
+	}
+
+	return id, passwordHash, nil
+}
+
+// AllUsers returns all users ordered by name
+func (m *postgresDBRepo) AllUsers(ctx context.Context) ([]models.User, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var users []models.User
+
+	query := `select id, full_name, email, role, active, totp_enabled, created_at, updated_at
+	from users order by full_name, email`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		err := rows.Scan(
+			&u.ID,
+			&u.FullName,
+			&u.Email,
+			&u.Role,
+			&u.Active,
+			&u.TOTPEnabled,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+		)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+// InsertUser stores a new user with the bcrypt hash of password and returns its id
+func (m *postgresDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `
+		insert into users (full_name, email, password, role, active, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id
+	`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		u.FullName,
+		u.Email,
+		string(hash),
+		u.Role,
+		u.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, uniqueEmail(err)
+	}
+
+	return newID, nil
+}
+
+// UpdatePassword replaces the password of a user with the bcrypt hash of password
+func (m *postgresDBRepo) UpdatePassword(ctx context.Context, id int, password string) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, "update users set password = $1, updated_at = $2 where id = $3", string(hash), time.Now(), id)
+	return err
+}
+
+// DeleteUser deletes a user by id
+func (m *postgresDBRepo) DeleteUser(ctx context.Context, id int) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from users where id = $1", id)
+	return err
+}
+
+// InsertUserAudit stores an entry in the log of changes to users
+func (m *postgresDBRepo) InsertUserAudit(ctx context.Context, a models.UserAudit) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `
+		insert into user_audit_log (actor_id, user_id, action, details, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		a.ActorID,
+		a.UserID,
+		a.Action,
+		a.Details,
+		time.Now(),
+		time.Now(),
+	)
+
+	return err
+}
+
+// UserAuditLog returns the changes made to a user, newest first. The actor's name is empty if the actor has been deleted.
+func (m *postgresDBRepo) UserAuditLog(ctx context.Context, userID int) ([]models.UserAudit, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var entries []models.UserAudit
+
+	query := `
+		select a.id, a.actor_id, coalesce(u.full_name, ''), a.user_id, a.action, a.details, a.created_at
+		from user_audit_log a
+		left join users u on (u.id = a.actor_id)
+		where a.user_id = $1
+		order by a.created_at desc, a.id desc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.UserAudit
+		err := rows.Scan(
+			&a.ID,
+			&a.ActorID,
+			&a.ActorName,
+			&a.UserID,
+			&a.Action,
+			&a.Details,
+			&a.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// GetUserByEmail returns user data by e-mail address
+func (m *postgresDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select id, full_name, email, password, role, active, created_at, updated_at,
+		totp_secret, totp_enabled, totp_last_counter
+	from users where lower(email) = lower($1)
+	`
+	row := m.DB.QueryRowContext(ctx, query, email)
+
+	var u models.User
+	err := row.Scan(
+		&u.ID,
+		&u.FullName,
+		&u.Email,
+		&u.Password,
+		&u.Role,
+		&u.Active,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+		&u.TOTPSecret,
+		&u.TOTPEnabled,
+		&u.TOTPLastCounter,
+	)
+
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+// InsertPasswordReset stores the hash of a password reset token for a user and puts the e-mails
+// with the link into the outbox in the same transaction
+func (m *postgresDBRepo) InsertPasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time, mails []models.MailData) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	stmt := `
+		insert into password_resets (user_id, token_hash, expires_at, created_at, updated_at)
+		values ($1, $2, $3, $4, $5)
+	`
+
+	_, err = tx.ExecContext(ctx, stmt, userID, tokenHash, expiresAt, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, mail := range mails {
+		err = insertMail(ctx, tx, mail)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PasswordResetUserID returns the user of an unused and unexpired password reset token,
+// or repository.ErrInvalidToken
+func (m *postgresDBRepo) PasswordResetUserID(ctx context.Context, tokenHash string) (int, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var userID int
+
+	query := `
+		select user_id from password_resets
+		where token_hash = $1 and used_at is null and expires_at > $2
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ResetPassword uses up a password reset token and sets the new password of its user.
+// All other open tokens of the user become invalid. Returns the user id or repository.ErrInvalidToken.
+func (m *postgresDBRepo) ResetPassword(ctx context.Context, tokenHash, password string) (int, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	var userID int
+
+	// the update makes sure a token can only be used once, even by concurrent requests
+	stmt := `
+		update password_resets set used_at = $1, updated_at = $1
+		where token_hash = $2 and used_at is null and expires_at > $1
+		returning user_id
+	`
+
+	err = tx.QueryRowContext(ctx, stmt, time.Now(), tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "update users set password = $1, updated_at = $2 where id = $3", string(hash), time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "update password_resets set used_at = $1, updated_at = $1 where user_id = $2 and used_at is null", time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// RecordLoginAttempt counts the failed logins since a point in time for an account which haven't been
+// cleared by a successful login or an admin, and all failed logins from the ip address. Then it records
+// the new attempt as a failed login and returns its id. Attempts for the same account or from the same ip
+// address are recorded one after another, so parallel attempts count each other.
+func (m *postgresDBRepo) RecordLoginAttempt(ctx context.Context, email, ip string, since time.Time) (int, models.FailedLoginStats, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var stats models.FailedLoginStats
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, stats, err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// the locks are released at the end of the transaction
+	_, err = tx.ExecContext(ctx, "select pg_advisory_xact_lock(hashtext($1))", "login-account:"+email)
+	if err != nil {
+		return 0, stats, err
+	}
+	_, err = tx.ExecContext(ctx, "select pg_advisory_xact_lock(hashtext($1))", "login-ip:"+ip)
+	if err != nil {
+		return 0, stats, err
+	}
+
+	var lastAccountFailure, lastIPFailure sql.NullTime
+
+	query := `
+		select
+			count(*) filter (where email = $1 and cleared_at is null),
+			max(created_at) filter (where email = $1 and cleared_at is null),
+			count(*) filter (where ip = $2),
+			max(created_at) filter (where ip = $2)
+		from failed_logins
+		where (email = $1 or ip = $2) and created_at > $3
+	`
+
+	err = tx.QueryRowContext(ctx, query, email, ip, since).Scan(
+		&stats.AccountFailures,
+		&lastAccountFailure,
+		&stats.IPFailures,
+		&lastIPFailure,
+	)
+	if err != nil {
+		return 0, stats, err
+	}
+
+	stats.LastAccountFailure = lastAccountFailure.Time
+	stats.LastIPFailure = lastIPFailure.Time
+
+	var id int
+
+	stmt := `insert into failed_logins (email, ip, created_at, updated_at) values ($1, $2, $3, $4) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt, email, ip, time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, stats, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, stats, err
+	}
+
+	return id, stats, nil
+}
+
+// DeleteLoginAttempt removes an attempt recorded by RecordLoginAttempt which turned out not to be
+// a failed login, because it has been refused or has succeeded
+func (m *postgresDBRepo) DeleteLoginAttempt(ctx context.Context, id int) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from failed_logins where id = $1", id)
+	return err
+}
+
+// ClearFailedLogins unlocks an account, the failed logins are kept for the record
+func (m *postgresDBRepo) ClearFailedLogins(ctx context.Context, email string) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `update failed_logins set cleared_at = $1, updated_at = $1 where email = $2 and cleared_at is null`
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), email)
+	return err
+}
+
+// RecentFailedLogins returns the not cleared failed logins since a point in time per account, latest first
+func (m *postgresDBRepo) RecentFailedLogins(ctx context.Context, since time.Time) ([]models.FailedLoginSummary, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var summaries []models.FailedLoginSummary
+
+	query := `
+		select email, count(*), max(created_at), (array_agg(ip order by created_at desc))[1]
+		from failed_logins
+		where cleared_at is null and created_at > $1
+		group by email
+		order by max(created_at) desc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, since)
+	if err != nil {
+		return summaries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.FailedLoginSummary
+		err := rows.Scan(
+			&s.Email,
+			&s.Failures,
+			&s.LastAttempt,
+			&s.LastIP,
+		)
+		if err != nil {
+			return summaries, err
+		}
+		summaries = append(summaries, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return summaries, err
+	}
+
+	return summaries, nil
+}
+
+// EnableTOTP turns on two-factor authentication for a user and replaces the recovery codes
+func (m *postgresDBRepo) EnableTOTP(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	stmt := `update users set totp_secret = $1, totp_enabled = true, totp_last_counter = 0, updated_at = $2 where id = $3`
+
+	_, err = tx.ExecContext(ctx, stmt, secret, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	err = insertRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication for a user and deletes the recovery codes
+func (m *postgresDBRepo) DisableTOTP(ctx context.Context, userID int) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	stmt := `update users set totp_secret = '', totp_enabled = false, totp_last_counter = 0, updated_at = $1 where id = $2`
+
+	_, err = tx.ExecContext(ctx, stmt, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from recovery_codes where user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPCounter stores the counter of a used code. It returns false if the counter
+// isn't newer than the last one, i.e. the code has been used before.
+func (m *postgresDBRepo) UseTOTPCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `update users set totp_last_counter = $1 where id = $2 and totp_last_counter < $1`
+
+	result, err := m.DB.ExecContext(ctx, stmt, counter, userID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// ReplaceRecoveryCodes deletes the recovery codes of a user and stores new ones
+func (m *postgresDBRepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = insertRecoveryCodes(ctx, tx, userID, codeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertRecoveryCodes replaces the recovery codes of a user within a transaction
+func insertRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	_, err := tx.ExecContext(ctx, "delete from recovery_codes where user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into recovery_codes (user_id, code_hash, created_at, updated_at) values ($1, $2, $3, $4)`
+
+	for _, hash := range codeHashes {
+		_, err = tx.ExecContext(ctx, stmt, userID, hash, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used and reports whether there was one
+func (m *postgresDBRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `update recovery_codes set used_at = $1, updated_at = $1 where user_id = $2 and code_hash = $3 and used_at is null`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// uniqueEmail translates the violation of the unique index on users.email to repository.ErrDuplicateEmail
+func uniqueEmail(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return repository.ErrDuplicateEmail
+	}
+	return err
+}
+
+// AllReservations builds and returns a slice of all reservations from the database, only those
+// with the status if it isn't empty
+func (m *postgresDBRepo) AllReservations(ctx context.Context, status models.ReservationStatus) ([]models.Reservation, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select r.id, r.full_name, r.email, r.phone, r.start_date, 
+		r.end_date, r.bungalow_id, r.created_at, r.updated_at, r.status, r.total_price, r.adults, r.children,
+		b.id, b.bungalow_name
+		from reservations r
+		left join bungalows b on (r.bungalow_id = b.id)
+		where $1 = '' or r.status = $1
+		order by r.start_date asc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, status)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FullName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.BungalowID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.TotalPrice,
+			&i.Adults,
+			&i.Children,
+			&i.Bungalow.ID,
+			&i.Bungalow.BungalowName,
+		)
+
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// AllNewReservations builds and returns a slice of all new reservations from the database
+func (m *postgresDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select r.id, r.full_name, r.email, r.phone, r.start_date, 
+		r.end_date, r.bungalow_id, r.created_at, r.updated_at, r.status, r.total_price, r.adults, r.children,
+		b.id, b.bungalow_name
+		from reservations r
+		left join bungalows b on (r.bungalow_id = b.id)
+		where r.status = $1
+		order by r.start_date asc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.ReservationRequested)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FullName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.BungalowID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.TotalPrice,
+			&i.Adults,
+			&i.Children,
+			&i.Bungalow.ID,
+			&i.Bungalow.BungalowName,
+		)
+
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// GetReservationByID returns a reservation by ID
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	return m.getReservation(ctx, "r.id = $1", id)
+}
+
+// GetReservationByAccessToken returns the reservation with the hash of a guest link, sql.ErrNoRows if there is none
+func (m *postgresDBRepo) GetReservationByAccessToken(ctx context.Context, tokenHash string) (models.Reservation, error) {
+	if tokenHash == "" {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+
+	return m.getReservation(ctx, "r.access_token_hash = $1", tokenHash)
+}
+
+// getReservation returns the reservation matching condition, which takes one argument
+func (m *postgresDBRepo) getReservation(ctx context.Context, condition string, arg any) (models.Reservation, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var res models.Reservation
+
+	query := `
+		select r.id, r.full_name, r.email, r.phone, r.start_date, 
+		r.end_date, r.bungalow_id, r.created_at, r.updated_at, r.status, r.total_price, r.adults, r.children,
+		b.id, b.bungalow_name
+		from reservations r
+		left join bungalows b on (r.bungalow_id = b.id)
+		where ` + condition
+
+	row := m.DB.QueryRowContext(ctx, query, arg)
+	err := row.Scan(
 		&res.ID,
 		&res.FullName,
 		&res.Email,
@@ -403,186 +1601,990 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Status,
+		&res.TotalPrice,
+		&res.Adults,
+		&res.Children,
 		&res.Bungalow.ID,
 		&res.Bungalow.BungalowName,
 	)
 
 	if err != nil {
-		return res, err
+		return res, err
+	}
+
+	return res, nil
+}
+
+// ChangeReservationDates moves a reservation and its restriction to new dates and stores the e-mails
+// about it in one transaction. Like BookReservation it locks the bungalow while checking availability,
+// the days of the reservation itself don't count as taken. Returns repository.ErrNotAvailable if the
+// new dates are taken and repository.ErrReservationCancelled for a cancelled reservation.
+func (m *postgresDBRepo) ChangeReservationDates(ctx context.Context, res models.Reservation, mails []models.MailData) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// lock the bungalow so concurrent bookings for it are serialized
+	var bungalowID int
+	err = tx.QueryRowContext(ctx, `select id from bungalows where id = $1 for update`, res.BungalowID).Scan(&bungalowID)
+	if err != nil {
+		return err
+	}
+
+	var status models.ReservationStatus
+	err = tx.QueryRowContext(ctx, `select status from reservations where id = $1 for update`, res.ID).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status == models.ReservationCancelled {
+		return repository.ErrReservationCancelled
+	}
+
+	var numRows int
+
+	query := `
+		select
+			count(id)
+		from
+			bungalow_restrictions
+		where
+			bungalow_id = $1
+			and $2 <= end_date and $3 >= start_date
+			and (reservation_id is null or reservation_id <> $4);
+	`
+
+	err = tx.QueryRowContext(ctx, query, res.BungalowID, res.StartDate, res.EndDate, res.ID).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrNotAvailable
+	}
+
+	stmt := `
+		update reservations set start_date = $1, end_date = $2, total_price = $3, updated_at = $4
+		where id = $5
+	`
+
+	_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.TotalPrice, time.Now(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `
+		update bungalow_restrictions set start_date = $1, end_date = $2, updated_at = $3
+		where reservation_id = $4
+	`
+
+	_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, time.Now(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, mail := range mails {
+		err = insertMail(ctx, tx, mail)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateReservation updates the data of a reservation in the database
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, r models.Reservation) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return updateReservation(ctx, m.DB, r)
+}
+
+// UpdateReservationAndStatus updates the contact details of a reservation and changes its status like
+// ChangeReservationStatus in one transaction, so the details aren't saved if the status can't change
+func (m *postgresDBRepo) UpdateReservationAndStatus(ctx context.Context, r models.Reservation, c models.ReservationStatusChange, mails []models.MailData) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = changeReservationStatus(ctx, tx, c, mails)
+	if err != nil {
+		return err
+	}
+
+	err = updateReservation(ctx, tx, r)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateReservation updates the contact details of a reservation
+func updateReservation(ctx context.Context, db execer, r models.Reservation) error {
+	query := `
+		update reservations set full_name = $1, email = $2, phone = $3, updated_at = $4
+		where id = $5
+`
+	_, err := db.ExecContext(ctx, query,
+		r.FullName,
+		r.Email,
+		r.Phone,
+		time.Now(),
+		r.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteReservation by id deletes an entry of a reservation dron the database
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		delete from reservations
+		where id = $1
+`
+	_, err := m.DB.ExecContext(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ChangeReservationStatus changes the status of a reservation to c.ToStatus and records the change in
+// its history, together with the e-mails about it in one transaction. A cancelled reservation frees
+// its days. Returns repository.ErrInvalidStatusChange if the reservation can't change to the status.
+func (m *postgresDBRepo) ChangeReservationStatus(ctx context.Context, c models.ReservationStatusChange, mails []models.MailData) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = changeReservationStatus(ctx, tx, c, mails)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// changeReservationStatus does the work of ChangeReservationStatus inside the transaction tx
+func changeReservationStatus(ctx context.Context, tx *sql.Tx, c models.ReservationStatusChange, mails []models.MailData) error {
+	var from models.ReservationStatus
+	err := tx.QueryRowContext(ctx, `select status from reservations where id = $1 for update`, c.ReservationID).Scan(&from)
+	if err != nil {
+		return err
+	}
+
+	if !from.CanBecome(c.ToStatus) {
+		return fmt.Errorf("%w: %s to %s", repository.ErrInvalidStatusChange, from, c.ToStatus)
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set status = $1, updated_at = $2 where id = $3`, c.ToStatus, time.Now(), c.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	if c.ToStatus == models.ReservationCancelled {
+		_, err = tx.ExecContext(ctx, `delete from bungalow_restrictions where reservation_id = $1`, c.ReservationID)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmt := `
+		insert into reservation_status_history
+			(reservation_id, from_status, to_status, user_id, reason, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err = tx.ExecContext(ctx, stmt, c.ReservationID, from, c.ToStatus, c.UserID, c.Reason, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, mail := range mails {
+		err = insertMail(ctx, tx, mail)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReservationStatusHistory returns the status changes of a reservation, oldest first
+func (m *postgresDBRepo) ReservationStatusHistory(ctx context.Context, reservationID int) ([]models.ReservationStatusChange, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var history []models.ReservationStatusChange
+
+	query := `
+		select h.id, h.reservation_id, h.from_status, h.to_status, h.user_id, h.reason, h.created_at, h.updated_at,
+		coalesce(u.full_name, '')
+		from reservation_status_history h
+		left join users u on (h.user_id = u.id)
+		where h.reservation_id = $1
+		order by h.created_at asc, h.id asc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return history, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.ReservationStatusChange
+		err := rows.Scan(
+			&c.ID,
+			&c.ReservationID,
+			&c.FromStatus,
+			&c.ToStatus,
+			&c.UserID,
+			&c.Reason,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&c.User.FullName,
+		)
+		if err != nil {
+			return history, err
+		}
+		c.User.ID = c.UserID
+		history = append(history, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return history, err
+	}
+
+	return history, nil
+}
+
+// AllBungalows returns a slice of all bungalows
+func (m *postgresDBRepo) AllBungalows(ctx context.Context) ([]models.Bungalow, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var bungalows []models.Bungalow
+
+	query := `select ` + bungalowColumns + ` from bungalows order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return bungalows, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b models.Bungalow
+		err := scanBungalow(rows, &b)
+		if err != nil {
+			return bungalows, err
+		}
+		bungalows = append(bungalows, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return bungalows, err
+	}
+
+	return bungalows, nil
+}
+
+// GetRestrictionsForBungalowByDate returns restrictions for a bungalow by date range, with the name
+// of the guest for reservations
+func (m *postgresDBRepo) GetRestrictionsForBungalowByDate(ctx context.Context, bungalowID int, start, end time.Time) ([]models.BungalowRestriction, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var restrictions []models.BungalowRestriction
+
+	query := `
+		select br.id, coalesce(br.reservation_id, 0), br.restriction_id, br.bungalow_id, br.start_date, br.end_date,
+		coalesce(r.full_name, '')
+		from bungalow_restrictions br
+		left join reservations r on (r.id = br.reservation_id)
+		where $1 < br.end_date and $2 >= br.start_date
+		and br.bungalow_id = $3
+	`
+	rows, err := m.DB.QueryContext(ctx, query, start, end, bungalowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.BungalowRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.BungalowID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.Reservation.FullName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+
+}
+
+// InsertBlockForBungalow inserts a bungalow restriction by bungalow id for a specific day
+func (m *postgresDBRepo) InsertBlockForBungalow(ctx context.Context, id int, startDate time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `insert into bungalow_restrictions (start_date, end_date, bungalow_id, restriction_id,
+			created_at, updated_at) values ($1, $2, $3, $4, $5, $6)`
+
+	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteBlockByID deletes a bungalow restriction by id
+func (m *postgresDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `delete from bungalow_restrictions where id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		log.Println(err)
+		return err
 	}
+	return nil
+}
 
-	return res, nil
+// insertMail stores an e-mail in the outbox
+func insertMail(ctx context.Context, db execer, m models.MailData) error {
+	stmt := `
+		insert into email_outbox
+			(to_address, from_address, subject, content, text_content, status, attempts, next_attempt_at, last_error, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, 0, $7, '', $8, $9)
+	`
+
+	_, err := db.ExecContext(ctx, stmt,
+		m.To,
+		m.From,
+		m.Subject,
+		m.Content,
+		m.TextContent,
+		models.MailPending,
+		time.Now(),
+		time.Now(),
+		time.Now(),
+	)
+
+	return err
 }
 
-// UpdateReservation updates the data of a reservation in the database
-func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
+// InsertMail stores an e-mail in the outbox to be delivered by the mail worker
+func (m *postgresDBRepo) InsertMail(ctx context.Context, mail models.MailData) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return insertMail(ctx, m.DB, mail)
+}
+
+// mailClaimTimeout is the time an e-mail claimed by a mail worker is hidden from other workers. If the
+// worker doesn't store the result of the delivery until then, e.g. because it crashed, the e-mail is due again.
+const mailClaimTimeout = 10 * time.Minute
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// DueMails claims and returns up to limit pending e-mails from the outbox which are due for delivery.
+// Claimed e-mails are due again only after mailClaimTimeout, so several instances of the application
+// never deliver the same e-mail twice.
+func (m *postgresDBRepo) DueMails(ctx context.Context, limit int) ([]models.OutboxMail, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
+	// rows locked by another instance are skipped instead of waited for
 	query := `
-		update reservations set full_name = $1, email = $2, phone = $3, updated_at = $4
-		where id = $5
+		with due as (
+			select id from email_outbox
+			where status = $1 and next_attempt_at <= $2
+			order by next_attempt_at asc
+			limit $3
+			for update skip locked
+		)
+		update email_outbox o set next_attempt_at = $4, updated_at = $2
+		from due
+		where o.id = due.id
+		returning o.id, o.to_address, o.from_address, o.subject, o.content, o.text_content, o.status, o.attempts,
+		o.next_attempt_at, o.last_error, o.created_at, o.updated_at
+	`
+
+	now := time.Now()
+	rows, err := m.DB.QueryContext(ctx, query, models.MailPending, now, limit, now.Add(mailClaimTimeout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxMails(rows)
+}
+
+// UpdateMailDelivery stores the result of a delivery attempt of an e-mail from the outbox
+func (m *postgresDBRepo) UpdateMailDelivery(ctx context.Context, mail models.OutboxMail) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		update email_outbox set status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, updated_at = $5
+		where id = $6
 `
 	_, err := m.DB.ExecContext(ctx, query,
-		r.FullName,
-		r.Email,
-		r.Phone,
+		mail.Status,
+		mail.Attempts,
+		mail.NextAttemptAt,
+		mail.LastError,
 		time.Now(),
-		r.ID,
+		mail.ID,
 	)
 
+	return err
+}
+
+// FailedMails returns all e-mails from the outbox which could not be delivered
+func (m *postgresDBRepo) FailedMails(ctx context.Context) ([]models.OutboxMail, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select id, to_address, from_address, subject, content, text_content, status, attempts,
+		next_attempt_at, last_error, created_at, updated_at
+		from email_outbox
+		where status = $1
+		order by updated_at desc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.MailFailed)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	return scanOutboxMails(rows)
 }
 
-// DeleteReservation by id deletes an entry of a reservation dron the database
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// ResendMail puts a failed e-mail back into the outbox for immediate delivery. It returns
+// sql.ErrNoRows if there is no failed e-mail with the id.
+func (m *postgresDBRepo) ResendMail(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `
-		delete from reservations
-		where id = $1
+		update email_outbox set status = $1, attempts = 0, next_attempt_at = $2, updated_at = $3
+		where id = $4 and status = $5
 `
-	_, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, models.MailPending, time.Now(), time.Now(), id, models.MailFailed)
+	if err != nil {
+		return err
+	}
 
+	n, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
 
 	return nil
 }
 
-// UpdateStatusOfReservation by id updates the status of a reservation
-func (m *postgresDBRepo) UpdateStatusOfReservation(id, status int) error {
+// scanOutboxMails reads all rows of an outbox query
+func scanOutboxMails(rows *sql.Rows) ([]models.OutboxMail, error) {
+	var mails []models.OutboxMail
+
+	for rows.Next() {
+		var i models.OutboxMail
+		err := rows.Scan(
+			&i.ID,
+			&i.MailData.To,
+			&i.MailData.From,
+			&i.MailData.Subject,
+			&i.MailData.Content,
+			&i.MailData.TextContent,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		)
+		if err != nil {
+			return mails, err
+		}
+		mails = append(mails, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return mails, err
+	}
+
+	return mails, nil
+}
+
+// GetSetting returns the value of an application setting, empty if it has never been set
+func (m *postgresDBRepo) GetSetting(ctx context.Context, name string) (string, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `
-		update reservations set status = $1
-		where id = $2
-`
-	_, err := m.DB.ExecContext(ctx, query, status, id)
+	var value string
 
+	err := m.DB.QueryRowContext(ctx, "select value from settings where name = $1", name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return value, nil
 }
 
-// AllBungalows returns a slice of all bungalows
-func (m *postgresDBRepo) AllBungalows() ([]models.Bungalow, error) {
+// SetSetting stores the value of an application setting
+func (m *postgresDBRepo) SetSetting(ctx context.Context, name, value string) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var bungalows []models.Bungalow
+	stmt := `
+		insert into settings (name, value, created_at, updated_at) values ($1, $2, $3, $3)
+		on conflict (name) do update set value = excluded.value, updated_at = excluded.updated_at
+	`
 
-	query := `select id, bungalow_name, created_at, updated_at from bungalows order by id`
+	_, err := m.DB.ExecContext(ctx, stmt, name, value, time.Now())
+	return err
+}
 
-	rows, err := m.DB.QueryContext(ctx, query)
+// InsertAPIToken stores the hash of a new api token and returns its id
+func (m *postgresDBRepo) InsertAPIToken(ctx context.Context, t models.APIToken, tokenHash string) (int, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+
+	stmt := `
+		insert into api_tokens (user_id, name, token_hash, scope, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $5) returning id
+	`
+
+	err := m.DB.QueryRowContext(ctx, stmt, t.UserID, t.Name, tokenHash, t.Scope, time.Now()).Scan(&id)
+	return id, err
+}
+
+// APITokens returns the api tokens of a user, newest first
+func (m *postgresDBRepo) APITokens(ctx context.Context, userID int) ([]models.APIToken, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var tokens []models.APIToken
+
+	query := `
+		select id, user_id, name, scope, coalesce(last_used_at, '0001-01-01'), created_at
+		from api_tokens where user_id = $1 order by created_at desc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
 	if err != nil {
-		return bungalows, err
+		return tokens, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var b models.Bungalow
+		var t models.APIToken
 		err := rows.Scan(
-			&b.ID,
-			&b.BungalowName,
-			&b.CreatedAt,
-			&b.UpdatedAt,
+			&t.ID,
+			&t.UserID,
+			&t.Name,
+			&t.Scope,
+			&t.LastUsedAt,
+			&t.CreatedAt,
 		)
 		if err != nil {
-			return bungalows, err
+			return tokens, err
 		}
-		bungalows = append(bungalows, b)
+		tokens = append(tokens, t)
 	}
 
 	if err = rows.Err(); err != nil {
-		return bungalows, err
+		return tokens, err
 	}
 
-	return bungalows, nil
+	return tokens, nil
 }
 
-// GetRestrictionsForBungalowByDate returns restrictions for a bungalow by date range
-func (m *postgresDBRepo) GetRestrictionsForBungalowByDate(bungalowID int, start, end time.Time) ([]models.BungalowRestriction, error) {
+// APITokenByHash returns an api token with its user, or repository.ErrInvalidToken if there is none
+func (m *postgresDBRepo) APITokenByHash(ctx context.Context, tokenHash string) (models.APIToken, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var restrictions []models.BungalowRestriction
+	var t models.APIToken
 
 	query := `
-		select id, coalesce(reservation_id, 0), restriction_id, bungalow_id, start_date, end_date
-		from bungalow_restrictions where $1 < end_date and $2 >= start_date
-		and bungalow_id = $3
+		select t.id, t.user_id, t.name, t.scope, coalesce(t.last_used_at, '0001-01-01'), t.created_at,
+		u.id, u.full_name, u.email, u.role, u.active
+		from api_tokens t
+		join users u on (u.id = t.user_id)
+		where t.token_hash = $1
 	`
-	rows, err := m.DB.QueryContext(ctx, query, start, end, bungalowID)
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		&t.Scope,
+		&t.LastUsedAt,
+		&t.CreatedAt,
+		&t.User.ID,
+		&t.User.FullName,
+		&t.User.Email,
+		&t.User.Role,
+		&t.User.Active,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, repository.ErrInvalidToken
+	}
+
+	return t, err
+}
+
+// TouchAPIToken records that an api token has just been used
+func (m *postgresDBRepo) TouchAPIToken(ctx context.Context, id int) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update api_tokens set last_used_at = $1 where id = $2`, time.Now(), id)
+	return err
+}
+
+// DeleteAPIToken revokes an api token of a user
+func (m *postgresDBRepo) DeleteAPIToken(ctx context.Context, id, userID int) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from api_tokens where id = $1 and user_id = $2`, id, userID)
+	return err
+}
+
+// ICalTokenHash returns the hash of the token of a bungalow's calendar feed, empty if there is none
+func (m *postgresDBRepo) ICalTokenHash(ctx context.Context, bungalowID int) (string, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var hash string
+
+	err := m.DB.QueryRowContext(ctx, `select ical_token_hash from bungalows where id = $1`, bungalowID).Scan(&hash)
+	return hash, err
+}
+
+// SetICalTokenHash replaces the hash of the token of a bungalow's calendar feed
+func (m *postgresDBRepo) SetICalTokenHash(ctx context.Context, bungalowID int, hash string) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `update bungalows set ical_token_hash = $1, updated_at = $2 where id = $3`
+
+	_, err := m.DB.ExecContext(ctx, stmt, hash, time.Now(), bungalowID)
+	return err
+}
+
+// AllCalendarImports returns the calendar imports of all bungalows ordered by bungalow and name
+func (m *postgresDBRepo) AllCalendarImports(ctx context.Context) ([]models.CalendarImport, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var imports []models.CalendarImport
+
+	query := `
+		select c.id, c.bungalow_id, c.name, c.url, c.content, coalesce(c.last_sync_at, '0001-01-01'),
+			c.last_error, c.created_at, c.updated_at, b.id, b.bungalow_name
+		from calendar_imports c
+		left join bungalows b on (c.bungalow_id = b.id)
+		order by b.bungalow_name, c.name
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
-		return nil, err
+		return imports, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var r models.BungalowRestriction
+		var c models.CalendarImport
 		err := rows.Scan(
-			&r.ID,
-			&r.ReservationID,
-			&r.RestrictionID,
-			&r.BungalowID,
-			&r.StartDate,
-			&r.EndDate,
+			&c.ID,
+			&c.BungalowID,
+			&c.Name,
+			&c.URL,
+			&c.Content,
+			&c.LastSyncAt,
+			&c.LastError,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&c.Bungalow.ID,
+			&c.Bungalow.BungalowName,
 		)
 		if err != nil {
-			return nil, err
+			return imports, err
 		}
-		restrictions = append(restrictions, r)
+		imports = append(imports, c)
 	}
+
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return imports, err
 	}
 
-	return restrictions, nil
+	return imports, nil
+}
+
+// GetCalendarImportByID returns a calendar import
+func (m *postgresDBRepo) GetCalendarImportByID(ctx context.Context, id int) (models.CalendarImport, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
 
+	var c models.CalendarImport
+
+	query := `
+		select c.id, c.bungalow_id, c.name, c.url, c.content, coalesce(c.last_sync_at, '0001-01-01'),
+			c.last_error, c.created_at, c.updated_at, b.id, b.bungalow_name
+		from calendar_imports c
+		left join bungalows b on (c.bungalow_id = b.id)
+		where c.id = $1
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&c.ID,
+		&c.BungalowID,
+		&c.Name,
+		&c.URL,
+		&c.Content,
+		&c.LastSyncAt,
+		&c.LastError,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.Bungalow.ID,
+		&c.Bungalow.BungalowName,
+	)
+
+	return c, err
 }
 
-// InsertBlockForBungalow inserts a bungalow restriction by bungalow id for a specific day
-func (m *postgresDBRepo) InsertBlockForBungalow(id int, startDate time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// InsertCalendarImport stores a calendar import and returns its id
+func (m *postgresDBRepo) InsertCalendarImport(ctx context.Context, c models.CalendarImport) (int, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `insert into bungalow_restrictions (start_date, end_date, bungalow_id, restriction_id,
-			created_at, updated_at) values ($1, $2, $3, $4, $5, $6)`
+	var newID int
 
-	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-	return nil
+	stmt := `
+		insert into calendar_imports (bungalow_id, name, url, content, last_error, created_at, updated_at)
+		values ($1, $2, $3, $4, '', $5, $6) returning id
+	`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		c.BungalowID,
+		c.Name,
+		c.URL,
+		c.Content,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	return newID, err
 }
 
-// DeleteBlockByID deletes a bungalow restriction by id
-func (m *postgresDBRepo) DeleteBlockByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// DeleteCalendarImport deletes a calendar import, its restrictions are deleted by the foreign key
+func (m *postgresDBRepo) DeleteCalendarImport(ctx context.Context, id int) error {
+
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `delete from bungalow_restrictions where id = $1`
+	_, err := m.DB.ExecContext(ctx, `delete from calendar_imports where id = $1`, id)
+	return err
+}
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+// UpdateCalendarImportStatus records the time and the error, empty on success, of the last sync of a calendar import
+func (m *postgresDBRepo) UpdateCalendarImportStatus(ctx context.Context, id int, syncedAt time.Time, lastError string) error {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `update calendar_imports set last_sync_at = $1, last_error = $2, updated_at = $3 where id = $4`
+
+	_, err := m.DB.ExecContext(ctx, stmt, syncedAt, lastError, time.Now(), id)
+	return err
+}
+
+// SyncCalendarImport makes the external restrictions of a calendar import match the given ones,
+// which are identified by their ExternalUID. Restrictions with changed dates are updated and
+// restrictions missing from the given ones are deleted, all in one transaction.
+func (m *postgresDBRepo) SyncCalendarImport(ctx context.Context, importID int, restrictions []models.BungalowRestriction) (models.CalendarSyncResult, error) {
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var result models.CalendarSyncResult
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println(err)
-		return err
+		return result, err
 	}
-	return nil
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// lock the import and its bungalow, so syncs of the import and bookings of the bungalow are serialized
+	var bungalowID int
+	err = tx.QueryRowContext(ctx, `select bungalow_id from calendar_imports where id = $1 for update`, importID).Scan(&bungalowID)
+	if err != nil {
+		return result, err
+	}
+
+	_, err = tx.ExecContext(ctx, `select id from bungalows where id = $1 for update`, bungalowID)
+	if err != nil {
+		return result, err
+	}
+
+	type existing struct {
+		id         int
+		start, end time.Time
+	}
+	current := make(map[string]existing)
+
+	rows, err := tx.QueryContext(ctx, `
+		select id, external_uid, start_date, end_date
+		from bungalow_restrictions where calendar_import_id = $1
+	`, importID)
+	if err != nil {
+		return result, err
+	}
+
+	for rows.Next() {
+		var uid string
+		var e existing
+		err = rows.Scan(&e.id, &uid, &e.start, &e.end)
+		if err != nil {
+			rows.Close()
+			return result, err
+		}
+		current[uid] = e
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+
+	for _, r := range restrictions {
+		e, ok := current[r.ExternalUID]
+		delete(current, r.ExternalUID)
+
+		switch {
+		case !ok:
+			_, err = tx.ExecContext(ctx, `
+				insert into bungalow_restrictions
+					(start_date, end_date, bungalow_id, restriction_id, calendar_import_id, external_uid, created_at, updated_at)
+				values
+					($1, $2, $3, $4, $5, $6, $7, $8)
+			`, r.StartDate, r.EndDate, bungalowID, models.RestrictionExternal, importID, r.ExternalUID, time.Now(), time.Now())
+			result.Added++
+		case !e.start.Equal(r.StartDate) || !e.end.Equal(r.EndDate):
+			_, err = tx.ExecContext(ctx, `
+				update bungalow_restrictions set start_date = $1, end_date = $2, updated_at = $3 where id = $4
+			`, r.StartDate, r.EndDate, time.Now(), e.id)
+			result.Updated++
+		}
+		if err != nil {
+			return models.CalendarSyncResult{}, err
+		}
+	}
+
+	// the events left over have disappeared from the calendar
+	for _, e := range current {
+		_, err = tx.ExecContext(ctx, `delete from bungalow_restrictions where id = $1`, e.id)
+		if err != nil {
+			return models.CalendarSyncResult{}, err
+		}
+		result.Removed++
+	}
+
+	query := `
+		select count(distinct e.id)
+		from bungalow_restrictions e
+		join bungalow_restrictions r on (r.bungalow_id = e.bungalow_id and r.reservation_id is not null)
+		where e.calendar_import_id = $1
+			and e.start_date < r.end_date and e.end_date > r.start_date
+	`
+
+	err = tx.QueryRowContext(ctx, query, importID).Scan(&result.Conflicts)
+	if err != nil {
+		return models.CalendarSyncResult{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.CalendarSyncResult{}, err
+	}
+
+	return result, nil
 }
@@ -1,19 +1,62 @@
 package dbrepo
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
+	"github.com/jagottsicher/myGoWebApplication/internal/repository"
 )
 
-func (m *testDBRepo) AllUsers() bool {
-	return true
+func (m *testDBRepo) AllUsers(ctx context.Context) ([]models.User, error) {
+	users := []models.User{
+		{ID: 1, FullName: "Patrick Star", Email: "patrick@bikini-bottom.ocean", Role: models.RoleOwner, Active: true},
+		{ID: 2, FullName: "Squidward Tentacles", Email: "squidward@bikini-bottom.ocean", Role: models.RoleStaff, Active: true, TOTPEnabled: true},
+	}
+
+	return users, nil
+}
+
+func (m *testDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+	if u.Email == "duplicate@bikini-bottom.ocean" {
+		return 0, repository.ErrDuplicateEmail
+	}
+
+	return 3, nil
+}
+
+func (m *testDBRepo) UpdatePassword(ctx context.Context, id int, password string) error {
+	return nil
+}
+
+func (m *testDBRepo) DeleteUser(ctx context.Context, id int) error {
+	if id == 99 {
+		return errors.New("some error")
+	}
+
+	return nil
+}
+
+func (m *testDBRepo) InsertUserAudit(ctx context.Context, a models.UserAudit) error {
+	return nil
+}
+
+func (m *testDBRepo) UserAuditLog(ctx context.Context, userID int) ([]models.UserAudit, error) {
+	entries := []models.UserAudit{
+		{ID: 1, ActorID: 1, ActorName: "Patrick Star", UserID: userID, Action: "create", CreatedAt: time.Now()},
+	}
+
+	return entries, nil
 }
 
 // InsertReservation stores a reservation in the database
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *testDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
 	if res.BungalowID == 99 {
 		return 0, errors.New("some error")
 	}
@@ -22,7 +65,7 @@ func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
 }
 
 // InsertBungalowRestriction places a restriction in the database
-func (m *testDBRepo) InsertBungalowRestriction(r models.BungalowRestriction) error {
+func (m *testDBRepo) InsertBungalowRestriction(ctx context.Context, r models.BungalowRestriction) error {
 	if r.BungalowID == 999 {
 		return errors.New("just because")
 	}
@@ -30,8 +73,23 @@ func (m *testDBRepo) InsertBungalowRestriction(r models.BungalowRestriction) err
 	return nil
 }
 
+// BookReservation stores a reservation and the matching bungalow restriction in one transaction
+func (m *testDBRepo) BookReservation(ctx context.Context, res models.Reservation, mails []models.MailData) (int, error) {
+	switch res.BungalowID {
+	case 99:
+		return 0, errors.New("some error")
+	case 999:
+		return 0, errors.New("just because")
+	case 9999:
+		// somebody else was faster
+		return 0, repository.ErrNotAvailable
+	}
+
+	return 1, nil
+}
+
 // SearchAvailabilityByDatesByBungalowID returns true if there is availablity for a bungalowID for a date range, false if not
-func (m *testDBRepo) SearchAvailabilityByDatesByBungalowID(start, end time.Time, bungalowID int) (bool, error) {
+func (m *testDBRepo) SearchAvailabilityByDatesByBungalowID(ctx context.Context, start, end time.Time, bungalowID int) (bool, error) {
 	// set up a test time
 	layout := "2006-01-02"
 	str := "2036-12-31"
@@ -60,8 +118,9 @@ func (m *testDBRepo) SearchAvailabilityByDatesByBungalowID(start, end time.Time,
 	return true, nil
 }
 
-// SearchAvailabilityByDatesForAllBungalows returns a slice of available bungalows, if any for a queried date range
-func (m *testDBRepo) SearchAvailabilityByDatesForAllBungalows(start, end time.Time) ([]models.Bungalow, error) {
+// SearchAvailabilityByDatesForAllBungalows returns a slice of available bungalows with room for
+// the number of guests, if any for a queried date range
+func (m *testDBRepo) SearchAvailabilityByDatesForAllBungalows(ctx context.Context, start, end time.Time, guests int) ([]models.Bungalow, error) {
 	var bungalows []models.Bungalow
 
 	// if the start date is after 2036-12-31, then return empty slice,
@@ -82,14 +141,16 @@ func (m *testDBRepo) SearchAvailabilityByDatesForAllBungalows(start, end time.Ti
 		return bungalows, errors.New("some error")
 	}
 
-	if start.After(t) {
+	// no bungalow is large enough for more than 5 guests
+	if start.After(t) || guests > 5 {
 		return bungalows, nil
 	}
 
 	// otherwise, put an entry into the slice, indicating that some bungalow is
 	// available for search dates
 	bungalow := models.Bungalow{
-		ID: 1,
+		ID:        1,
+		MaxGuests: 2,
 	}
 	bungalows = append(bungalows, bungalow)
 
@@ -97,77 +158,289 @@ func (m *testDBRepo) SearchAvailabilityByDatesForAllBungalows(start, end time.Ti
 }
 
 // GetBungalowByID gets a bungalow by id
-func (m *testDBRepo) GetBungalowByID(id int) (models.Bungalow, error) {
+func (m *testDBRepo) GetBungalowByID(ctx context.Context, id int) (models.Bungalow, error) {
 	var bungalow models.Bungalow
-	if id > 3 {
-		return bungalow, errors.New("an error occured")
+	// 999 and 9999 exist to let BookReservation fail later on
+	if id > 3 && id != 999 && id != 9999 {
+		return bungalow, sql.ErrNoRows
+	}
+
+	bungalow.ID = id
+	if id <= len(testBungalowSlugs) {
+		bungalow.Slug = testBungalowSlugs[id-1]
+		bungalow.BungalowName = testBungalowNames[id-1]
+		bungalow.Description = "Far far away, behind the word mountains.\n\nA small river named Duden flows by."
+		bungalow.Amenities = []string{"Kitchen", "Terrace"}
+	}
+	bungalow.NightlyRate = 10000
+	bungalow.WeekendSurcharge = 2000
+	bungalow.CleaningFee = 5000
+	bungalow.MinNights = 1
+	bungalow.MaxGuests = 2
+
+	// the family bungalow needs a longer stay and has room for more guests
+	if id == 3 {
+		bungalow.MinNights = 3
+		bungalow.MaxGuests = 5
 	}
 
 	return bungalow, nil
 }
 
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
-	var u models.User
+// names and slugs of the bungalows 1 to 3
+var (
+	testBungalowNames = []string{"The Solitude Shack", "The Couple's Cove", "The Family Fiesta Bungalow"}
+	testBungalowSlugs = []string{"eremite", "couple", "family"}
+)
+
+// GetBungalowBySlug gets a bungalow by its slug
+func (m *testDBRepo) GetBungalowBySlug(ctx context.Context, slug string) (models.Bungalow, error) {
+	for i, s := range testBungalowSlugs {
+		if s == slug {
+			return m.GetBungalowByID(ctx, i+1)
+		}
+	}
+
+	return models.Bungalow{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertBungalow(ctx context.Context, b models.Bungalow) (int, error) {
+	if b.Slug == "eremite" {
+		return 0, repository.ErrDuplicateSlug
+	}
+
+	return 4, nil
+}
+
+func (m *testDBRepo) UpdateBungalow(ctx context.Context, b models.Bungalow) error {
+	if b.Slug == "couple" && b.ID != 2 {
+		return repository.ErrDuplicateSlug
+	}
+
+	return nil
+}
+
+// DeleteBungalow refuses to delete bungalow 1, which has reservations
+func (m *testDBRepo) DeleteBungalow(ctx context.Context, id int) error {
+	switch {
+	case id == 1:
+		return repository.ErrBungalowInUse
+	case id > 3:
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// BungalowImages returns two images for each of the bungalows 1 to 3
+func (m *testDBRepo) BungalowImages(ctx context.Context, bungalowID int) ([]models.BungalowImage, error) {
+	var images []models.BungalowImage
+	if bungalowID < 1 || bungalowID > len(testBungalowSlugs) {
+		return images, nil
+	}
+
+	for i := 1; i <= 2; i++ {
+		images = append(images, models.BungalowImage{
+			ID:         bungalowID*10 + i,
+			BungalowID: bungalowID,
+			FileName:   fmt.Sprintf("%s-%d.jpg", testBungalowSlugs[bungalowID-1], i),
+			SortOrder:  i,
+		})
+	}
+
+	return images, nil
+}
+
+func (m *testDBRepo) AllBungalowImages(ctx context.Context) ([]models.BungalowImage, error) {
+	return m.BungalowImages(ctx, 1)
+}
+
+func (m *testDBRepo) InsertBungalowImage(ctx context.Context, img models.BungalowImage) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) UpdateBungalowImages(ctx context.Context, bungalowID int, images []models.BungalowImage) error {
+	return nil
+}
+
+// DeleteBungalowImage deletes the images returned by BungalowImages
+func (m *testDBRepo) DeleteBungalowImage(ctx context.Context, id int) (models.BungalowImage, error) {
+	images, _ := m.BungalowImages(ctx, id/10)
+	for _, img := range images {
+		if img.ID == id {
+			return img, nil
+		}
+	}
+
+	return models.BungalowImage{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	if id == 99 {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	u := models.User{ID: id, FullName: "Patrick Star", Email: "patrick@bikini-bottom.ocean", Role: models.RoleOwner, Active: true}
+	switch id {
+	case 2:
+		u = models.User{ID: id, FullName: "Squidward Tentacles", Email: "squidward@bikini-bottom.ocean", Role: models.RoleStaff, Active: true,
+			TOTPSecret: TestTOTPSecret, TOTPEnabled: true}
+	case 3:
+		u = models.User{ID: id, FullName: "Sandy Cheeks", Email: "sandy@bikini-bottom.ocean", Role: models.RoleReadOnly, Active: true}
+	case 4:
+		u = models.User{ID: id, FullName: "Gary", Email: "gary@bikini-bottom.ocean", Role: models.RoleStaff, Active: false}
+	}
 
 	return u, nil
 }
 
-func (m *testDBRepo) UpdateUser(u models.User) error {
+func (m *testDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	if u.Email == "duplicate@bikini-bottom.ocean" {
+		return repository.ErrDuplicateEmail
+	}
+
 	return nil
 }
 
-func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+func (m *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
 	if email == "patrick@bikini-bottom.ocean" {
 		return 1, "", nil
 	}
 
+	// uses two-factor authentication
+	if email == "squidward@bikini-bottom.ocean" {
+		return 2, "", nil
+	}
+
 	return 0, "", errors.New("there was an error")
 }
 
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) AllReservations(ctx context.Context, status models.ReservationStatus) ([]models.Reservation, error) {
 
 	var reservations []models.Reservation
 
 	return reservations, nil
 }
 
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
 
 	var reservations []models.Reservation
 
 	return reservations, nil
 }
 
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+// testReservationStatuses are the statuses of the test reservations, all others are requested
+var testReservationStatuses = map[int]models.ReservationStatus{
+	2: models.ReservationConfirmed,
+	3: models.ReservationCheckedOut,
+	4: models.ReservationCancelled,
+}
+
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
 
 	var res models.Reservation
+	if id == 99 {
+		return res, sql.ErrNoRows
+	}
 
+	res.ID = id
+	res.Status = models.ReservationRequested
+	if status, ok := testReservationStatuses[id]; ok {
+		res.Status = status
+	}
 	return res, nil
 }
 
-func (m *testDBRepo) UpdateReservation(r models.Reservation) error {
+// tokens of the guest links of the test reservations: one which can still be changed, one which
+// starts too soon to be changed and a cancelled one
+const (
+	TestAccessToken          = "guest-token"
+	TestLateAccessToken      = "late-guest-token"
+	TestCancelledAccessToken = "cancelled-guest-token"
+)
+
+func (m *testDBRepo) GetReservationByAccessToken(ctx context.Context, tokenHash string) (models.Reservation, error) {
+	res := models.Reservation{
+		ID:         1,
+		FullName:   "Sandy Cheeks",
+		Email:      "sandy@treedome.ocean",
+		StartDate:  time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2030, 1, 14, 0, 0, 0, 0, time.UTC),
+		BungalowID: 1,
+		Bungalow:   models.Bungalow{ID: 1, BungalowName: "The Solitude Shack"},
+		TotalPrice: 49000,
+		Adults:     2,
+		Status:     models.ReservationConfirmed,
+	}
+
+	switch tokenHash {
+	case hashToken(TestAccessToken):
+		return res, nil
+	case hashToken(TestLateAccessToken):
+		res.StartDate = time.Now().AddDate(0, 0, 2)
+		res.EndDate = time.Now().AddDate(0, 0, 5)
+		return res, nil
+	case hashToken(TestCancelledAccessToken):
+		res.ID = 4
+		res.Status = models.ReservationCancelled
+		return res, nil
+	}
+
+	return models.Reservation{}, sql.ErrNoRows
+}
+
+// ChangeReservationDates fails like SearchAvailabilityByDatesByBungalowID for stays starting after 2036-12-31
+func (m *testDBRepo) ChangeReservationDates(ctx context.Context, res models.Reservation, mails []models.MailData) error {
+	if res.StartDate.After(time.Date(2036, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		return repository.ErrNotAvailable
+	}
+
+	return nil
+}
+
+func (m *testDBRepo) UpdateReservation(ctx context.Context, r models.Reservation) error {
 
 	return nil
 }
 
-func (m *testDBRepo) DeleteReservation(id int) error {
+// UpdateReservationAndStatus checks the status change like ChangeReservationStatus
+func (m *testDBRepo) UpdateReservationAndStatus(ctx context.Context, r models.Reservation, c models.ReservationStatusChange, mails []models.MailData) error {
+	return m.ChangeReservationStatus(ctx, c, mails)
+}
+
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
 
 	return nil
 }
 
-func (m *testDBRepo) UpdateStatusOfReservation(id, status int) error {
+// ChangeReservationStatus checks the transition from the status of the test reservation like the database does
+func (m *testDBRepo) ChangeReservationStatus(ctx context.Context, c models.ReservationStatusChange, mails []models.MailData) error {
+	res, err := m.GetReservationByID(ctx, c.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	if !res.Status.CanBecome(c.ToStatus) {
+		return repository.ErrInvalidStatusChange
+	}
 
 	return nil
 }
 
-func (m *testDBRepo) AllBungalows() ([]models.Bungalow, error) {
+func (m *testDBRepo) ReservationStatusHistory(ctx context.Context, reservationID int) ([]models.ReservationStatusChange, error) {
+	return []models.ReservationStatusChange{
+		{ID: 1, ReservationID: reservationID, FromStatus: models.ReservationRequested, ToStatus: models.ReservationConfirmed, UserID: 1, Reason: "Deposit paid", User: models.User{ID: 1, FullName: "Patrick Star"}},
+	}, nil
+}
+
+func (m *testDBRepo) AllBungalows(ctx context.Context) ([]models.Bungalow, error) {
 
 	var bungalows []models.Bungalow
 	bungalows = append(bungalows, models.Bungalow{ID: 1})
 	return bungalows, nil
 }
 
-func (m *testDBRepo) GetRestrictionsForBungalowByDate(bungalowID int, start, end time.Time) ([]models.BungalowRestriction, error) {
+func (m *testDBRepo) GetRestrictionsForBungalowByDate(ctx context.Context, bungalowID int, start, end time.Time) ([]models.BungalowRestriction, error) {
 
 	var restrictions []models.BungalowRestriction
 	// add a block
@@ -188,16 +461,334 @@ func (m *testDBRepo) GetRestrictionsForBungalowByDate(bungalowID int, start, end
 		BungalowID:    1,
 		ReservationID: 1,
 		RestrictionID: 1,
+		Reservation:   models.Reservation{ID: 1, FullName: "Patrick Star"},
+	})
+
+	// add a restriction imported from another portal
+	restrictions = append(restrictions, models.BungalowRestriction{
+		ID:               3,
+		StartDate:        time.Now().AddDate(0, 0, 5),
+		EndDate:          time.Now().AddDate(0, 0, 7),
+		BungalowID:       1,
+		RestrictionID:    3,
+		CalendarImportID: 1,
 	})
 	return restrictions, nil
 }
 
-func (m *testDBRepo) InsertBlockForBungalow(id int, startDate time.Time) error {
+func (m *testDBRepo) InsertBlockForBungalow(ctx context.Context, id int, startDate time.Time) error {
+
+	return nil
+}
+
+func (m *testDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+
+	return nil
+}
+
+func (m *testDBRepo) InsertMail(ctx context.Context, mail models.MailData) error {
+	if mail.To == "unstorable@bikini-bottom.ocean" {
+		return errors.New("can't store e-mail")
+	}
+
+	return nil
+}
+
+func (m *testDBRepo) DueMails(ctx context.Context, limit int) ([]models.OutboxMail, error) {
+
+	var mails []models.OutboxMail
+	mails = append(mails, models.OutboxMail{
+		ID: 1,
+		MailData: models.MailData{
+			To:      "patrick@bikini-bottom.ocean",
+			Subject: "Receipt of a request for a reservation",
+		},
+		Status:        models.MailPending,
+		NextAttemptAt: time.Now(),
+	})
+	return mails, nil
+}
+
+func (m *testDBRepo) UpdateMailDelivery(ctx context.Context, mail models.OutboxMail) error {
+
+	return nil
+}
+
+func (m *testDBRepo) FailedMails(ctx context.Context) ([]models.OutboxMail, error) {
+
+	var mails []models.OutboxMail
+	mails = append(mails, models.OutboxMail{
+		ID: 2,
+		MailData: models.MailData{
+			To:      "patrick@bikini-bottom.ocean",
+			Subject: "New Reservation Request",
+		},
+		Status:    models.MailFailed,
+		Attempts:  8,
+		LastError: "dial tcp: connection refused",
+	})
+	return mails, nil
+}
+
+func (m *testDBRepo) ResendMail(ctx context.Context, id int) error {
+	// only the e-mail from FailedMails has failed
+	if id != 2 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (m *testDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	switch email {
+	case "patrick@bikini-bottom.ocean":
+		return models.User{ID: 1, FullName: "Patrick Star", Email: email, Role: models.RoleOwner, Active: true}, nil
+	case "gary@bikini-bottom.ocean":
+		return models.User{ID: 4, FullName: "Gary", Email: email, Role: models.RoleStaff, Active: false}, nil
+	}
+
+	return models.User{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertPasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time, mails []models.MailData) error {
+	return nil
+}
+
+// validTestTokenHash is the hash of the token "valid-token", all other tokens are invalid
+const validTestTokenHash = "397a2a9c5bf5e2ccec38c2596b682bb1bd05fe6e4ecea6c10cf42755ff225403"
+
+func (m *testDBRepo) PasswordResetUserID(ctx context.Context, tokenHash string) (int, error) {
+	if tokenHash == validTestTokenHash {
+		return 1, nil
+	}
+
+	return 0, repository.ErrInvalidToken
+}
+
+func (m *testDBRepo) ResetPassword(ctx context.Context, tokenHash, password string) (int, error) {
+	if tokenHash == validTestTokenHash {
+		return 1, nil
+	}
+
+	return 0, repository.ErrInvalidToken
+}
+
+// RecordLoginAttempt returns a locked account for locked@bikini-bottom.ocean and a locked ip address for 10.0.0.66
+func (m *testDBRepo) RecordLoginAttempt(ctx context.Context, email, ip string, since time.Time) (int, models.FailedLoginStats, error) {
+	var stats models.FailedLoginStats
+
+	if email == "locked@bikini-bottom.ocean" {
+		stats.AccountFailures = 5
+		stats.LastAccountFailure = time.Now()
+	}
+
+	if ip == "10.0.0.66" {
+		stats.IPFailures = 100
+		stats.LastIPFailure = time.Now()
+	}
+
+	return 1, stats, nil
+}
 
+func (m *testDBRepo) DeleteLoginAttempt(ctx context.Context, id int) error {
 	return nil
 }
 
-func (m *testDBRepo) DeleteBlockByID(id int) error {
+func (m *testDBRepo) ClearFailedLogins(ctx context.Context, email string) error {
+	return nil
+}
+
+func (m *testDBRepo) RecentFailedLogins(ctx context.Context, since time.Time) ([]models.FailedLoginSummary, error) {
+	summaries := []models.FailedLoginSummary{
+		{Email: "locked@bikini-bottom.ocean", Failures: 5, LastAttempt: time.Now(), LastIP: "10.0.0.1"},
+		{Email: "patrick@bikini-bottom.ocean", Failures: 1, LastAttempt: time.Now(), LastIP: "10.0.0.2"},
+	}
+
+	return summaries, nil
+}
+
+// TestTOTPSecret is the two-factor secret of the test user with id 2
+const TestTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// validTestRecoveryCodeHash is the hash of the recovery code "aaaaa-bbbbb"
+const validTestRecoveryCodeHash = "ed74b5c9ceaa577420d8ec549a9e55c9480ea02f6718c4095687f67e4ab220d4"
+
+func (m *testDBRepo) EnableTOTP(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error {
+	return nil
+}
+
+func (m *testDBRepo) DisableTOTP(ctx context.Context, userID int) error {
+	return nil
+}
+
+func (m *testDBRepo) UseTOTPCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+	return true, nil
+}
+
+func (m *testDBRepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	return nil
+}
+
+func (m *testDBRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	return codeHash == validTestRecoveryCodeHash, nil
+}
+
+func (m *testDBRepo) GetSetting(ctx context.Context, name string) (string, error) {
+	return "", nil
+}
+
+func (m *testDBRepo) SetSetting(ctx context.Context, name, value string) error {
+	return nil
+}
+
+// TestAPIToken is a valid api token with write scope of the test user with id 1,
+// TestReadOnlyAPIToken one with read scope
+const (
+	TestAPIToken         = "bbt_write-token"
+	TestReadOnlyAPIToken = "bbt_read-token"
+)
+
+func (m *testDBRepo) InsertAPIToken(ctx context.Context, t models.APIToken, tokenHash string) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) APITokens(ctx context.Context, userID int) ([]models.APIToken, error) {
+	return []models.APIToken{
+		{ID: 1, UserID: userID, Name: "channel manager", Scope: models.ScopeWrite},
+	}, nil
+}
+
+func (m *testDBRepo) APITokenByHash(ctx context.Context, tokenHash string) (models.APIToken, error) {
+	user := models.User{ID: 1, FullName: "Patrick Star", Email: "patrick@bikini-bottom.ocean", Role: models.RoleOwner, Active: true}
+
+	switch tokenHash {
+	case hashToken(TestAPIToken):
+		return models.APIToken{ID: 1, UserID: 1, Name: "channel manager", Scope: models.ScopeWrite, User: user}, nil
+	case hashToken(TestReadOnlyAPIToken):
+		return models.APIToken{ID: 2, UserID: 1, Name: "reporting", Scope: models.ScopeRead, User: user}, nil
+	}
+
+	return models.APIToken{}, repository.ErrInvalidToken
+}
+
+func (m *testDBRepo) TouchAPIToken(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *testDBRepo) DeleteAPIToken(ctx context.Context, id, userID int) error {
+	return nil
+}
+
+// hashToken returns the hex encoded sha256 hash of a token like helpers.HashToken
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TestICalToken is the token of the calendar feed of bungalow 1
+const TestICalToken = "ical-token"
+
+func (m *testDBRepo) ICalTokenHash(ctx context.Context, bungalowID int) (string, error) {
+	switch {
+	case bungalowID == 1:
+		return hashToken(TestICalToken), nil
+	case bungalowID > 3:
+		return "", sql.ErrNoRows
+	}
+
+	// no feed yet
+	return "", nil
+}
+
+func (m *testDBRepo) SetICalTokenHash(ctx context.Context, bungalowID int, hash string) error {
+	return nil
+}
+
+// testCalendarImports are the calendar imports of the test repository, one downloaded and one uploaded
+var testCalendarImports = []models.CalendarImport{
+	{ID: 1, BungalowID: 1, Name: "Jellyfish Fields Rentals", URL: "https://jellyfish-fields.ocean/calendars/eremite.ics", Bungalow: models.Bungalow{ID: 1, BungalowName: "The Solitude Shack"}},
+	{ID: 2, BungalowID: 2, Name: "Goo Lagoon Stays", Content: "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nEND:VCALENDAR\r\n", Bungalow: models.Bungalow{ID: 2, BungalowName: "The Couple's Cove"}},
+}
+
+func (m *testDBRepo) AllCalendarImports(ctx context.Context) ([]models.CalendarImport, error) {
+	return testCalendarImports, nil
+}
+
+func (m *testDBRepo) GetCalendarImportByID(ctx context.Context, id int) (models.CalendarImport, error) {
+	for _, c := range testCalendarImports {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+
+	return models.CalendarImport{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertCalendarImport(ctx context.Context, c models.CalendarImport) (int, error) {
+	if c.BungalowID > 3 {
+		return 0, errors.New("some error")
+	}
+
+	return 3, nil
+}
+
+func (m *testDBRepo) DeleteCalendarImport(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *testDBRepo) UpdateCalendarImportStatus(ctx context.Context, id int, syncedAt time.Time, lastError string) error {
+	return nil
+}
+
+func (m *testDBRepo) SyncCalendarImport(ctx context.Context, importID int, restrictions []models.BungalowRestriction) (models.CalendarSyncResult, error) {
+	if importID == 99 {
+		return models.CalendarSyncResult{}, sql.ErrNoRows
+	}
+
+	return models.CalendarSyncResult{Added: len(restrictions)}, nil
+}
+
+// testSeasons are the seasons of the test repository, summer 2030 of bungalow 1
+var testSeasons = []models.Season{
+	{
+		ID:          1,
+		BungalowID:  1,
+		Name:        "Summer",
+		StartDate:   time.Date(2030, 7, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2030, 8, 31, 0, 0, 0, 0, time.UTC),
+		NightlyRate: 15000,
+		MinNights:   7,
+		Bungalow:    models.Bungalow{ID: 1, BungalowName: "The Solitude Shack"},
+	},
+}
+
+func (m *testDBRepo) UpdateBungalowRates(ctx context.Context, b models.Bungalow) error {
+	return nil
+}
+
+func (m *testDBRepo) AllSeasons(ctx context.Context) ([]models.Season, error) {
+	return testSeasons, nil
+}
+
+func (m *testDBRepo) SeasonsForBungalow(ctx context.Context, bungalowID int, start, end time.Time) ([]models.Season, error) {
+	var seasons []models.Season
+	for _, s := range testSeasons {
+		if s.BungalowID == bungalowID && s.StartDate.Before(end) && !s.EndDate.Before(start) {
+			seasons = append(seasons, s)
+		}
+	}
+
+	return seasons, nil
+}
+
+func (m *testDBRepo) InsertSeason(ctx context.Context, s models.Season) (int, error) {
+	return 2, nil
+}
+
+func (m *testDBRepo) DeleteSeason(ctx context.Context, id int) error {
+	if id == 99 {
+		return sql.ErrNoRows
+	}
 
 	return nil
 }
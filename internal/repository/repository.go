@@ -1,30 +1,121 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/jagottsicher/myGoWebApplication/internal/models"
 )
 
+// ErrNotAvailable is returned when a bungalow has been booked or blocked for the requested dates in the meantime
+var ErrNotAvailable = errors.New("bungalow is no longer available for the requested dates")
+
+// ErrDuplicateEmail is returned when another user already has the e-mail address
+var ErrDuplicateEmail = errors.New("e-mail address is already used by another user")
+
+// ErrDuplicateSlug is returned when another bungalow already has the slug
+var ErrDuplicateSlug = errors.New("slug is already used by another bungalow")
+
+// ErrBungalowInUse is returned when a bungalow with reservations is to be deleted
+var ErrBungalowInUse = errors.New("bungalow has reservations")
+
+// ErrReservationCancelled is returned when the dates of a cancelled reservation are to be changed
+var ErrReservationCancelled = errors.New("reservation has been cancelled")
+
+// ErrInvalidStatusChange is returned when a reservation can't change from its status to the requested one
+var ErrInvalidStatusChange = errors.New("reservation can't change to this status")
+
+// ErrInvalidToken is returned for tokens which are unknown, expired or already used
+var ErrInvalidToken = errors.New("token is invalid or expired")
+
+// ErrUserInactive is returned when a deactivated user tries to log in
+var ErrUserInactive = errors.New("user is deactivated")
+
 type DatabaseRepo interface {
-	AllUsers() bool
-
-	InsertReservation(res models.Reservation) (int, error)
-	InsertBungalowRestriction(r models.BungalowRestriction) error
-	SearchAvailabilityByDatesByBungalowID(start, end time.Time, bungalowID int) (bool, error)
-	SearchAvailabilityByDatesForAllBungalows(start, end time.Time) ([]models.Bungalow, error)
-	GetBungalowByID(id int) (models.Bungalow, error)
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(u models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(r models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateStatusOfReservation(id, status int) error
-	AllBungalows() ([]models.Bungalow, error)
-	GetRestrictionsForBungalowByDate(bungalowID int, start, end time.Time) ([]models.BungalowRestriction, error)
-	InsertBlockForBungalow(id int, startDate time.Time) error
-	DeleteBlockByID(id int) error
+	AllUsers(ctx context.Context) ([]models.User, error)
+	InsertUser(ctx context.Context, u models.User, password string) (int, error)
+	UpdatePassword(ctx context.Context, id int, password string) error
+	DeleteUser(ctx context.Context, id int) error
+	InsertUserAudit(ctx context.Context, a models.UserAudit) error
+	UserAuditLog(ctx context.Context, userID int) ([]models.UserAudit, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	InsertPasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time, mails []models.MailData) error
+	PasswordResetUserID(ctx context.Context, tokenHash string) (int, error)
+	ResetPassword(ctx context.Context, tokenHash, password string) (int, error)
+
+	RecordLoginAttempt(ctx context.Context, email, ip string, since time.Time) (int, models.FailedLoginStats, error)
+	DeleteLoginAttempt(ctx context.Context, id int) error
+	ClearFailedLogins(ctx context.Context, email string) error
+	RecentFailedLogins(ctx context.Context, since time.Time) ([]models.FailedLoginSummary, error)
+
+	EnableTOTP(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID int) error
+	UseTOTPCounter(ctx context.Context, userID int, counter int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+
+	GetSetting(ctx context.Context, name string) (string, error)
+	SetSetting(ctx context.Context, name, value string) error
+
+	InsertAPIToken(ctx context.Context, t models.APIToken, tokenHash string) (int, error)
+	APITokens(ctx context.Context, userID int) ([]models.APIToken, error)
+	APITokenByHash(ctx context.Context, tokenHash string) (models.APIToken, error)
+	TouchAPIToken(ctx context.Context, id int) error
+	DeleteAPIToken(ctx context.Context, id, userID int) error
+
+	ICalTokenHash(ctx context.Context, bungalowID int) (string, error)
+	SetICalTokenHash(ctx context.Context, bungalowID int, hash string) error
+
+	AllCalendarImports(ctx context.Context) ([]models.CalendarImport, error)
+	GetCalendarImportByID(ctx context.Context, id int) (models.CalendarImport, error)
+	InsertCalendarImport(ctx context.Context, c models.CalendarImport) (int, error)
+	DeleteCalendarImport(ctx context.Context, id int) error
+	UpdateCalendarImportStatus(ctx context.Context, id int, syncedAt time.Time, lastError string) error
+	SyncCalendarImport(ctx context.Context, importID int, restrictions []models.BungalowRestriction) (models.CalendarSyncResult, error)
+
+	GetBungalowBySlug(ctx context.Context, slug string) (models.Bungalow, error)
+	InsertBungalow(ctx context.Context, b models.Bungalow) (int, error)
+	UpdateBungalow(ctx context.Context, b models.Bungalow) error
+	DeleteBungalow(ctx context.Context, id int) error
+	BungalowImages(ctx context.Context, bungalowID int) ([]models.BungalowImage, error)
+	AllBungalowImages(ctx context.Context) ([]models.BungalowImage, error)
+	InsertBungalowImage(ctx context.Context, img models.BungalowImage) (int, error)
+	UpdateBungalowImages(ctx context.Context, bungalowID int, images []models.BungalowImage) error
+	DeleteBungalowImage(ctx context.Context, id int) (models.BungalowImage, error)
+	UpdateBungalowRates(ctx context.Context, b models.Bungalow) error
+	AllSeasons(ctx context.Context) ([]models.Season, error)
+	SeasonsForBungalow(ctx context.Context, bungalowID int, start, end time.Time) ([]models.Season, error)
+	InsertSeason(ctx context.Context, s models.Season) (int, error)
+	DeleteSeason(ctx context.Context, id int) error
+
+	InsertReservation(ctx context.Context, res models.Reservation) (int, error)
+	InsertBungalowRestriction(ctx context.Context, r models.BungalowRestriction) error
+	BookReservation(ctx context.Context, res models.Reservation, mails []models.MailData) (int, error)
+	SearchAvailabilityByDatesByBungalowID(ctx context.Context, start, end time.Time, bungalowID int) (bool, error)
+	SearchAvailabilityByDatesForAllBungalows(ctx context.Context, start, end time.Time, guests int) ([]models.Bungalow, error)
+	GetBungalowByID(ctx context.Context, id int) (models.Bungalow, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	UpdateUser(ctx context.Context, u models.User) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+	AllReservations(ctx context.Context, status models.ReservationStatus) ([]models.Reservation, error)
+	AllNewReservations(ctx context.Context) ([]models.Reservation, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	GetReservationByAccessToken(ctx context.Context, tokenHash string) (models.Reservation, error)
+	ChangeReservationDates(ctx context.Context, res models.Reservation, mails []models.MailData) error
+	UpdateReservation(ctx context.Context, r models.Reservation) error
+	UpdateReservationAndStatus(ctx context.Context, r models.Reservation, c models.ReservationStatusChange, mails []models.MailData) error
+	DeleteReservation(ctx context.Context, id int) error
+	ChangeReservationStatus(ctx context.Context, c models.ReservationStatusChange, mails []models.MailData) error
+	ReservationStatusHistory(ctx context.Context, reservationID int) ([]models.ReservationStatusChange, error)
+	AllBungalows(ctx context.Context) ([]models.Bungalow, error)
+	GetRestrictionsForBungalowByDate(ctx context.Context, bungalowID int, start, end time.Time) ([]models.BungalowRestriction, error)
+	InsertBlockForBungalow(ctx context.Context, id int, startDate time.Time) error
+	DeleteBlockByID(ctx context.Context, id int) error
+
+	InsertMail(ctx context.Context, m models.MailData) error
+	DueMails(ctx context.Context, limit int) ([]models.OutboxMail, error)
+	UpdateMailDelivery(ctx context.Context, m models.OutboxMail) error
+	FailedMails(ctx context.Context) ([]models.OutboxMail, error)
+	ResendMail(ctx context.Context, id int) error
 }
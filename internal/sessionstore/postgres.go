@@ -0,0 +1,118 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// PostgresStore keeps the session data in the sessions table, so sessions survive a restart
+type PostgresStore struct {
+	db          *sql.DB
+	errorLog    *log.Logger
+	stopCleanup chan struct{}
+	cleanupDone chan struct{}
+}
+
+// NewPostgresStore returns a session store using db. Expired sessions are deleted
+// every cleanupInterval, a zero interval disables the cleanup.
+func NewPostgresStore(db *sql.DB, cleanupInterval time.Duration, errorLog *log.Logger) *PostgresStore {
+	p := &PostgresStore{db: db, errorLog: errorLog}
+
+	if cleanupInterval > 0 {
+		p.stopCleanup = make(chan struct{})
+		p.cleanupDone = make(chan struct{})
+		go p.cleanup(cleanupInterval)
+	}
+
+	return p
+}
+
+// Find returns the data of an unexpired session
+func (p *PostgresStore) Find(token string) ([]byte, bool, error) {
+	return p.FindCtx(context.Background(), token)
+}
+
+// FindCtx returns the data of an unexpired session
+func (p *PostgresStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	var b []byte
+
+	query := `select data from sessions where token = $1 and expiry > current_timestamp`
+
+	err := p.db.QueryRowContext(ctx, query, token).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit stores the session data, replacing the data of an existing session
+func (p *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	return p.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// CommitCtx stores the session data, replacing the data of an existing session
+func (p *PostgresStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	stmt := `insert into sessions (token, data, expiry) values ($1, $2, $3)
+			on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`
+
+	_, err := p.db.ExecContext(ctx, stmt, token, b, expiry)
+	return err
+}
+
+// Delete removes a session
+func (p *PostgresStore) Delete(token string) error {
+	return p.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx removes a session
+func (p *PostgresStore) DeleteCtx(ctx context.Context, token string) error {
+	_, err := p.db.ExecContext(ctx, `delete from sessions where token = $1`, token)
+	return err
+}
+
+// StopCleanup stops deleting expired sessions, it has to be called before the database is closed
+func (p *PostgresStore) StopCleanup() {
+	if p.stopCleanup == nil {
+		return
+	}
+
+	close(p.stopCleanup)
+	<-p.cleanupDone
+	p.stopCleanup = nil
+}
+
+// cleanup deletes expired sessions every interval until StopCleanup is called
+func (p *PostgresStore) cleanup(interval time.Duration) {
+	defer close(p.cleanupDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := p.deleteExpired()
+			if err != nil && p.errorLog != nil {
+				p.errorLog.Println("can't delete expired sessions:", err)
+			}
+		case <-p.stopCleanup:
+			return
+		}
+	}
+}
+
+// deleteExpired removes all expired sessions
+func (p *PostgresStore) deleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `delete from sessions where expiry < current_timestamp`)
+	return err
+}
@@ -0,0 +1,110 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the sha1 secret of the test vectors in RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// the RFC lists 8 digit codes, these are their last 6 digits
+var codeTests = []struct {
+	unix     int64
+	expected string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, e := range codeTests {
+		code, err := Code(rfcSecret, Counter(time.Unix(e.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != e.expected {
+			t.Errorf("failed at %d: expected %s, got %s", e.unix, e.expected, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	// case #1: current code
+	counter, ok := Validate(rfcSecret, "050471", now)
+	if !ok || counter != Counter(now) {
+		t.Error("expected the current code to be valid")
+	}
+
+	// case #2: code of the previous period
+	if _, ok := Validate(rfcSecret, "081804", now); !ok {
+		t.Error("expected the code of the previous period to be valid")
+	}
+
+	// case #3: code from long ago
+	if _, ok := Validate(rfcSecret, "287082", now); ok {
+		t.Error("expected an old code to be invalid")
+	}
+
+	// case #4: malformed codes
+	for _, code := range []string{"", "12345", "abcdef", "0504711"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("expected code %q to be invalid", code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(secret) != 32 {
+		t.Errorf("expected 32 characters, got %d", len(secret))
+	}
+
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("generated secret can't be used: %s", err)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Bungalow Bliss", "patrick@bikini-bottom.ocean", "JBSWY3DPEHPK3PXP")
+
+	for _, want := range []string{"otpauth://totp/Bungalow%20Bliss:patrick@bikini-bottom.ocean?", "secret=JBSWY3DPEHPK3PXP", "issuer=Bungalow+Bliss", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("expected %s in %s", want, uri)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := RecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected format of recovery code %q", code)
+		}
+		if seen[code] {
+			t.Errorf("recovery code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+
+	if NormalizeRecoveryCode(" K3X9Q-7mz2p ") != "k3x9q7mz2p" {
+		t.Errorf("unexpected normalized code %q", NormalizeRecoveryCode(" K3X9Q-7mz2p "))
+	}
+}
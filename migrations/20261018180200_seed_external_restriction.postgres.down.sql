@@ -0,0 +1 @@
+delete from restrictions where id = 3;
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO public.restrictions (id,restriction_name,created_at,updated_at) VALUES
+	 (3,'External Calendar',now(),now());
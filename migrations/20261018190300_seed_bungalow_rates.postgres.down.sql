@@ -0,0 +1 @@
+UPDATE public.bungalows SET nightly_rate = 0, weekend_surcharge = 0, cleaning_fee = 0, min_nights = 1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+UPDATE public.bungalows SET nightly_rate = 8900, weekend_surcharge = 1500, cleaning_fee = 4000, min_nights = 2 WHERE bungalow_name = 'The Solitude Shack';
+UPDATE public.bungalows SET nightly_rate = 12900, weekend_surcharge = 2000, cleaning_fee = 5000, min_nights = 2 WHERE bungalow_name = 'The Couple''s Cove';
+UPDATE public.bungalows SET nightly_rate = 17900, weekend_surcharge = 3000, cleaning_fee = 7000, min_nights = 3 WHERE bungalow_name = 'The Family Fiesta Bungalow';
@@ -0,0 +1 @@
+UPDATE public.bungalows SET max_guests = 2, beds = '';
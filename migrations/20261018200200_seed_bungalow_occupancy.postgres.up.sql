@@ -0,0 +1,3 @@
+UPDATE public.bungalows SET max_guests = 1, beds = '1 single bed' WHERE bungalow_name = 'The Solitude Shack';
+UPDATE public.bungalows SET max_guests = 2, beds = '1 double bed' WHERE bungalow_name = 'The Couple''s Cove';
+UPDATE public.bungalows SET max_guests = 5, beds = '1 double bed, 1 bunk bed, 1 sofa bed' WHERE bungalow_name = 'The Family Fiesta Bungalow';
@@ -0,0 +1 @@
+UPDATE public.bungalows SET slug = '', description = '', amenities = '', photos = '';
@@ -0,0 +1,5 @@
+UPDATE public.bungalows b SET photos = coalesce((
+    SELECT string_agg(i.file_name, E'\n' ORDER BY i.sort_order, i.id)
+    FROM public.bungalow_images i
+    WHERE i.bungalow_id = b.id), '');
+DELETE FROM public.bungalow_images;
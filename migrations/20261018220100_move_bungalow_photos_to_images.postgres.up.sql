@@ -0,0 +1,4 @@
+INSERT INTO public.bungalow_images (bungalow_id, file_name, caption, sort_order, created_at, updated_at)
+    SELECT b.id, p.file_name, '', p.sort_order, now(), now()
+    FROM public.bungalows b, unnest(string_to_array(b.photos, E'\n')) WITH ORDINALITY AS p(file_name, sort_order)
+    WHERE p.file_name <> '';
@@ -0,0 +1,11 @@
+UPDATE public.reservations SET cancelled_at = updated_at WHERE status = 'cancelled';
+
+ALTER TABLE public.reservations ALTER COLUMN status DROP DEFAULT;
+
+ALTER TABLE public.reservations ALTER COLUMN status TYPE integer USING
+    CASE
+        WHEN status IN ('confirmed', 'checked-in', 'checked-out') THEN 1
+        ELSE 0
+    END;
+
+ALTER TABLE public.reservations ALTER COLUMN status SET DEFAULT 0;
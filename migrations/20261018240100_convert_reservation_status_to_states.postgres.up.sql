@@ -0,0 +1,15 @@
+ALTER TABLE public.reservations ALTER COLUMN status DROP DEFAULT;
+
+ALTER TABLE public.reservations ALTER COLUMN status TYPE character varying(20) USING
+    CASE
+        WHEN cancelled_at IS NOT NULL THEN 'cancelled'
+        WHEN status = 1 THEN 'confirmed'
+        ELSE 'requested'
+    END;
+
+ALTER TABLE public.reservations ALTER COLUMN status SET DEFAULT 'requested';
+
+INSERT INTO public.reservation_status_history (reservation_id, from_status, to_status, user_id, reason, created_at, updated_at)
+    SELECT id, 'requested', 'cancelled', 0, 'Cancelled by the guest', cancelled_at, cancelled_at
+    FROM public.reservations
+    WHERE cancelled_at IS NOT NULL;